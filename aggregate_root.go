@@ -55,7 +55,7 @@ var DefaultReducer = func(initialState Entity, event *Event, next Reducer) Entit
 	//if it's an aggregate root then let's set the user and account based on the event meta details
 	if aggregateRoot, ok := initialState.(WeOSEntity); ok {
 		aggregateRoot.SetUser(User{
-			BasicEntity{
+			BasicEntity: BasicEntity{
 				ID: event.Meta.User,
 			},
 		})
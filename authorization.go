@@ -0,0 +1,125 @@
+package weos
+
+import (
+	"fmt"
+	"golang.org/x/net/context"
+	"sync"
+)
+
+//Authorizer decides if the user may issue the command. It's consulted by the command dispatcher before any handlers run
+type Authorizer interface {
+	//Authorize returns an error if the user (nil if the request isn't authenticated) is not allowed to issue the command
+	Authorize(ctx context.Context, user *User, command *Command) error
+}
+
+//AuthorizerFunc is a function that can be used as an Authorizer
+type AuthorizerFunc func(ctx context.Context, user *User, command *Command) error
+
+func (f AuthorizerFunc) Authorize(ctx context.Context, user *User, command *Command) error {
+	return f(ctx, user, command)
+}
+
+//Policy returns whether the user is allowed to issue the command
+type Policy func(ctx context.Context, user *User, command *Command) bool
+
+//RequireRoles allows users that have at least one of the roles
+func RequireRoles(roles ...string) Policy {
+	return func(ctx context.Context, user *User, command *Command) bool {
+		if user == nil {
+			return false
+		}
+		for _, role := range roles {
+			if user.HasRole(role) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+//RequirePermissions allows users that have all of the permissions
+func RequirePermissions(permissions ...string) Policy {
+	return func(ctx context.Context, user *User, command *Command) bool {
+		if user == nil {
+			return false
+		}
+		for _, permission := range permissions {
+			if !user.HasPermission(permission) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+//RequireUser allows any authenticated user
+func RequireUser() Policy {
+	return func(ctx context.Context, user *User, command *Command) bool {
+		return user != nil
+	}
+}
+
+//PolicyAuthorizer checks commands against the policy set for the command type. Policies can be set for an account to
+//override the policy all accounts use. The "*" command type is the policy for command types without their own policy
+type PolicyAuthorizer struct {
+	policies map[string]Policy
+	mutex    sync.RWMutex
+	//DenyUnlisted rejects commands that have no policy instead of allowing them
+	DenyUnlisted bool
+}
+
+func NewPolicyAuthorizer() *PolicyAuthorizer {
+	return &PolicyAuthorizer{policies: make(map[string]Policy)}
+}
+
+//SetPolicy sets the policy for the command type for all accounts
+func (a *PolicyAuthorizer) SetPolicy(commandType string, policy Policy) {
+	a.SetAccountPolicy("", commandType, policy)
+}
+
+//SetAccountPolicy sets the policy for the command type for an account
+func (a *PolicyAuthorizer) SetAccountPolicy(accountID string, commandType string, policy Policy) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.policies == nil {
+		a.policies = make(map[string]Policy)
+	}
+	a.policies[accountID+"/"+commandType] = policy
+}
+
+func (a *PolicyAuthorizer) Authorize(ctx context.Context, user *User, command *Command) error {
+	policy := a.policy(GetAccount(ctx), command.Type)
+	if policy == nil {
+		if a.DenyUnlisted {
+			return a.deny(ctx, user, command)
+		}
+		return nil
+	}
+	if !policy(ctx, user, command) {
+		return a.deny(ctx, user, command)
+	}
+	return nil
+}
+
+//policy finds the most specific policy for the command type, checking the account's policies first
+func (a *PolicyAuthorizer) policy(accountID string, commandType string) Policy {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	keys := []string{"/" + commandType, "/*"}
+	if accountID != "" {
+		keys = append([]string{accountID + "/" + commandType, accountID + "/*"}, keys...)
+	}
+	for _, key := range keys {
+		if policy, ok := a.policies[key]; ok {
+			return policy
+		}
+	}
+	return nil
+}
+
+func (a *PolicyAuthorizer) deny(ctx context.Context, user *User, command *Command) error {
+	if user == nil {
+		return NewUnauthorizedError(ctx, "unauthenticated", fmt.Sprintf("command '%s' requires an authenticated user", command.Type), nil)
+	}
+	return NewForbiddenError(ctx, fmt.Sprintf("user '%s' is not allowed to issue command '%s'", user.ID, command.Type), "Command", command.ID)
+}
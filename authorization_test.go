@@ -0,0 +1,150 @@
+package weos_test
+
+import (
+	"errors"
+	"github.com/wepala/weos"
+	"golang.org/x/net/context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUser_HasPermission(t *testing.T) {
+	user := &weos.User{Roles: []string{"editor"}, Permissions: []string{"posts:write"}}
+	if !user.HasRole("editor") || user.HasRole("admin") {
+		t.Error("expected the user to only have the editor role")
+	}
+	if !user.HasPermission("posts:write") || user.HasPermission("posts:delete") {
+		t.Error("expected the user to only have the posts:write permission")
+	}
+	admin := &weos.User{Permissions: []string{"*"}}
+	if !admin.HasPermission("posts:delete") {
+		t.Error("expected the * permission to grant all permissions")
+	}
+}
+
+func TestPolicyAuthorizer_Authorize(t *testing.T) {
+	authorizer := weos.NewPolicyAuthorizer()
+	authorizer.SetPolicy("PUBLISH_POST", weos.RequireRoles("editor", "admin"))
+	authorizer.SetPolicy("DELETE_POST", weos.RequirePermissions("posts:delete"))
+	authorizer.SetAccountPolicy("account-1", "PUBLISH_POST", weos.RequireRoles("admin"))
+	authorizer.SetPolicy("*", weos.RequireUser())
+
+	editor := &weos.User{BasicEntity: weos.BasicEntity{ID: "editor-1"}, Roles: []string{"editor"}}
+	accountCtx := context.WithValue(context.TODO(), weos.ACCOUNT_ID, "account-1")
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		user     *weos.User
+		command  string
+		category weos.ErrorCategory
+	}{
+		{"user with the role", context.TODO(), editor, "PUBLISH_POST", ""},
+		{"user without the permission", context.TODO(), editor, "DELETE_POST", weos.ErrorCategoryForbidden},
+		{"account policy overrides the default", accountCtx, editor, "PUBLISH_POST", weos.ErrorCategoryForbidden},
+		{"wildcard policy for other commands", context.TODO(), editor, "CREATE_POST", ""},
+		{"anonymous user", context.TODO(), nil, "CREATE_POST", weos.ErrorCategoryUnauthorized},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := authorizer.Authorize(test.ctx, test.user, &weos.Command{Type: test.command})
+			if test.category == "" {
+				if err != nil {
+					t.Errorf("expected the command to be allowed, got '%s'", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected the command to be denied")
+			}
+			if weos.GetErrorCategory(err) != test.category {
+				t.Errorf("expected the error category to be '%s', got '%s'", test.category, weos.GetErrorCategory(err))
+			}
+		})
+	}
+
+	t.Run("unlisted commands can be denied", func(t *testing.T) {
+		strict := &weos.PolicyAuthorizer{DenyUnlisted: true}
+		err := strict.Authorize(context.TODO(), editor, &weos.Command{Type: "CREATE_POST"})
+		var domainError *weos.DomainError
+		if !errors.As(err, &domainError) {
+			t.Fatalf("expected a domain error, got '%v'", err)
+		}
+		if weos.HTTPStatus(err) != http.StatusForbidden {
+			t.Errorf("expected the status to be %d, got %d", http.StatusForbidden, weos.HTTPStatus(err))
+		}
+	})
+}
+
+func TestPolicyAuthorizer_MetadataAccount(t *testing.T) {
+	authorizer := weos.NewPolicyAuthorizer()
+	authorizer.SetPolicy("PUBLISH_POST", weos.RequireRoles("editor"))
+	authorizer.SetAccountPolicy("account-1", "PUBLISH_POST", weos.RequireUser())
+	user := &weos.User{BasicEntity: weos.BasicEntity{ID: "user-1"}}
+	//the metadata names an account with a more lenient policy but the request isn't authenticated for it
+	ctx := context.WithValue(context.TODO(), weos.COMMAND_METADATA, weos.CommandMetadata{AccountID: "account-1"})
+	if err := authorizer.Authorize(ctx, user, &weos.Command{Type: "PUBLISH_POST"}); err == nil {
+		t.Error("expected the policy of the metadata account not to be used")
+	}
+}
+
+func TestRequireUser_UserWithoutID(t *testing.T) {
+	authorizer := weos.NewPolicyAuthorizer()
+	authorizer.SetPolicy("PUBLISH_POST", weos.RequireUser())
+	ctx := context.WithValue(context.TODO(), weos.CURRENT_USER, &weos.User{Roles: []string{"editor"}})
+	if err := authorizer.Authorize(ctx, weos.GetCurrentUser(ctx), &weos.Command{Type: "PUBLISH_POST"}); err == nil {
+		t.Error("expected a user without an id not to be authenticated")
+	}
+}
+
+func TestCommandDisptacher_Authorizer(t *testing.T) {
+	authorizer := weos.NewPolicyAuthorizer()
+	authorizer.SetPolicy("PUBLISH_POST", weos.RequireRoles("editor"))
+	dispatcher := &weos.DefaultCommandDispatcher{Authorizer: authorizer}
+	handlerCalled := false
+	dispatcher.AddSubscriber(&weos.Command{Type: "PUBLISH_POST"}, func(ctx context.Context, command *weos.Command) error {
+		handlerCalled = true
+		return nil
+	})
+
+	t.Run("user without the role is forbidden", func(t *testing.T) {
+		ctx := context.WithValue(context.TODO(), weos.CURRENT_USER, &weos.User{BasicEntity: weos.BasicEntity{ID: "user-1"}})
+		err := dispatcher.Dispatch(ctx, &weos.Command{Type: "PUBLISH_POST"})
+		if weos.GetErrorCategory(err) != weos.ErrorCategoryForbidden {
+			t.Fatalf("expected a forbidden error, got '%v'", err)
+		}
+		if handlerCalled {
+			t.Error("expected the handler not to be called")
+		}
+	})
+
+	t.Run("user with the role is allowed", func(t *testing.T) {
+		ctx := context.WithValue(context.TODO(), weos.CURRENT_USER, &weos.User{BasicEntity: weos.BasicEntity{ID: "user-2"}, Roles: []string{"editor"}})
+		if err := dispatcher.Dispatch(ctx, &weos.Command{Type: "PUBLISH_POST"}); err != nil {
+			t.Fatalf("unexpected error dispatching command '%s'", err)
+		}
+		if !handlerCalled {
+			t.Error("expected the handler to be called")
+		}
+	})
+
+	t.Run("anonymous requests to the http endpoint are unauthorized", func(t *testing.T) {
+		app := &ApplicationMock{
+			DispatcherFunc: func() weos.Dispatcher {
+				return dispatcher
+			},
+			LoggerFunc: func() weos.Log {
+				return &LogMock{ErrorfFunc: func(format string, args ...interface{}) {}}
+			},
+		}
+		rw := httptest.NewRecorder()
+		weos.NewCommandHandler(app)(rw, httptest.NewRequest(http.MethodPost, "/command", strings.NewReader(`{"type":"PUBLISH_POST"}`)))
+		if rw.Code != http.StatusUnauthorized {
+			t.Errorf("expected the status to be %d, got %d", http.StatusUnauthorized, rw.Code)
+		}
+		if !strings.Contains(rw.Body.String(), `"code":"unauthenticated"`) {
+			t.Errorf("expected the error code in the response, got '%s'", rw.Body.String())
+		}
+	})
+}
@@ -0,0 +1,173 @@
+package weos
+
+import (
+	"golang.org/x/net/context"
+	"gorm.io/gorm"
+	"time"
+)
+
+//Checkpoint is the last event processed by a projection
+type Checkpoint struct {
+	Projection   string `gorm:"primaryKey"`
+	EventID      string
+	EventCreated time.Time
+	UpdatedAt    time.Time
+}
+
+func (Checkpoint) TableName() string {
+	return "projection_checkpoints"
+}
+
+//CheckpointStore remembers which events projections have processed so that they can continue where they left off
+//after a restart
+type CheckpointStore interface {
+	//GetCheckpoint returns the checkpoint of the projection or nil if it hasn't processed any events
+	GetCheckpoint(ctx context.Context, projection string) (*Checkpoint, error)
+	SaveCheckpoint(ctx context.Context, projection string, event Event) error
+	//ResetCheckpoint removes the checkpoint so that the projection processes all the events again
+	ResetCheckpoint(ctx context.Context, projection string) error
+}
+
+//GormCheckpointStore stores checkpoints in a database table. Projections that are stored in the same database should
+//use Apply so that the checkpoint is saved in the same transaction as the projection changes
+type GormCheckpointStore struct {
+	db     *gorm.DB
+	logger Log
+}
+
+func NewGormCheckpointStore(db *gorm.DB, logger Log) *GormCheckpointStore {
+	return &GormCheckpointStore{db: db, logger: logger}
+}
+
+func (c *GormCheckpointStore) GetCheckpoint(ctx context.Context, projection string) (*Checkpoint, error) {
+	var checkpoints []Checkpoint
+	result := c.db.WithContext(ctx).Where("projection = ?", projection).Limit(1).Find(&checkpoints)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if len(checkpoints) == 0 {
+		return nil, nil
+	}
+	return &checkpoints[0], nil
+}
+
+func (c *GormCheckpointStore) SaveCheckpoint(ctx context.Context, projection string, event Event) error {
+	checkpoint := &Checkpoint{
+		Projection: projection,
+		EventID:    event.ID,
+	}
+	if created, err := time.Parse(time.RFC3339Nano, event.Meta.Created); err == nil {
+		checkpoint.EventCreated = created
+	}
+	return c.db.WithContext(ctx).Save(checkpoint).Error
+}
+
+func (c *GormCheckpointStore) ResetCheckpoint(ctx context.Context, projection string) error {
+	return c.db.WithContext(ctx).Where("projection = ?", projection).Delete(&Checkpoint{}).Error
+}
+
+//Apply runs the projection changes for the event and saves the checkpoint in one transaction so that the event is
+//either processed and recorded or neither
+func (c *GormCheckpointStore) Apply(ctx context.Context, projection string, event Event, apply func(tx *gorm.DB) error) error {
+	return c.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := apply(tx); err != nil {
+			return err
+		}
+		return NewGormCheckpointStore(tx, c.logger).SaveCheckpoint(ctx, projection, event)
+	})
+}
+
+//CatchUp sends the events the projection hasn't processed yet to the handler and saves the checkpoint after each one.
+//The events are read a page at a time. It returns the number of events processed even if there is an error
+func (c *GormCheckpointStore) CatchUp(ctx context.Context, projection string, repository EventRepository, handler EventHandler) (int, error) {
+	checkpoint, err := c.GetCheckpoint(ctx, projection)
+	if err != nil {
+		return 0, err
+	}
+	processed := 0
+	process := func(event *Event) error {
+		handler(ctx, *event)
+		if err := c.SaveCheckpoint(ctx, projection, *event); err != nil {
+			return err
+		}
+		processed += 1
+		return nil
+	}
+	filter := EventFilter{}
+	//events created at the same time as the checkpoint are skipped up to the checkpoint event. They are kept until the
+	//checkpoint event is found in case it isn't in the store anymore
+	skipping := checkpoint != nil
+	var pending []*Event
+	if checkpoint != nil {
+		filter.From = checkpoint.EventCreated
+	}
+	_, err = ForEachEvent(repository, filter, DefaultEventPageSize, func(event *Event) error {
+		if skipping {
+			if event.ID == checkpoint.EventID {
+				skipping = false
+				pending = nil
+				return nil
+			}
+			if created, err := time.Parse(time.RFC3339Nano, event.Meta.Created); err == nil && !created.After(checkpoint.EventCreated) {
+				pending = append(pending, event)
+				return nil
+			}
+			skipping = false
+			for _, pendingEvent := range pending {
+				if err := process(pendingEvent); err != nil {
+					return err
+				}
+			}
+			pending = nil
+		}
+		return process(event)
+	})
+	for _, pendingEvent := range pending {
+		if err != nil {
+			break
+		}
+		err = process(pendingEvent)
+	}
+	return processed, err
+}
+
+func (c *GormCheckpointStore) Migrate(ctx context.Context) error {
+	migrator := NewMigrator(c.db, c.logger)
+	if err := migrator.RegisterProvider(c); err != nil {
+		return err
+	}
+	return migrator.Up(ctx)
+}
+
+//checkpointV1 is a snapshot of the checkpoint table used by the migrations
+type checkpointV1 struct {
+	Projection   string `gorm:"primaryKey"`
+	EventID      string
+	EventCreated time.Time
+	UpdatedAt    time.Time
+}
+
+func (checkpointV1) TableName() string {
+	return "projection_checkpoints"
+}
+
+//MigrationNamespace is the namespace the checkpoint store migrations are tracked under
+func (c *GormCheckpointStore) MigrationNamespace() string {
+	return "projection_checkpoints"
+}
+
+//Migrations are the versioned changes to the checkpoint table
+func (c *GormCheckpointStore) Migrations() []*Migration {
+	return []*Migration{
+		{
+			Version: 1,
+			Name:    "create projection checkpoints table",
+			Up: func(tx *gorm.DB) error {
+				return tx.Migrator().CreateTable(&checkpointV1{})
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable(&checkpointV1{})
+			},
+		},
+	}
+}
@@ -0,0 +1,179 @@
+package weos_test
+
+import (
+	"errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/wepala/weos"
+	"golang.org/x/net/context"
+	"gorm.io/gorm"
+	"testing"
+	"time"
+)
+
+type postTitle struct {
+	ID    string `gorm:"primaryKey"`
+	Title string
+}
+
+func TestGormCheckpointStore(t *testing.T) {
+	db := newMigrationTestDB(t)
+	repository, err := weos.NewBasicEventRepository(db, log.New(), false, "", "")
+	if err != nil {
+		t.Fatalf("unexpected error creating repository '%s'", err)
+	}
+	if err = repository.Migrate(context.TODO()); err != nil {
+		t.Fatalf("unexpected error migrating repository '%s'", err)
+	}
+	checkpoints := weos.NewGormCheckpointStore(db, log.New())
+	if err = checkpoints.Migrate(context.TODO()); err != nil {
+		t.Fatalf("unexpected error migrating checkpoints '%s'", err)
+	}
+	if err = db.AutoMigrate(&postTitle{}); err != nil {
+		t.Fatalf("unexpected error migrating projection '%s'", err)
+	}
+	persistPosts(t, repository, "post1", "POST_CREATED", "POST_UPDATED")
+	persistPosts(t, repository, "post2", "POST_CREATED")
+	events, err := repository.GetEvents(weos.EventFilter{})
+	if err != nil {
+		t.Fatalf("unexpected error getting events '%s'", err)
+	}
+
+	checkpoint, err := checkpoints.GetCheckpoint(context.TODO(), "titles")
+	if err != nil {
+		t.Fatalf("unexpected error getting checkpoint '%s'", err)
+	}
+	if checkpoint != nil {
+		t.Fatal("expected no checkpoint before any events are processed")
+	}
+
+	t.Run("apply saves the checkpoint with the projection changes", func(t *testing.T) {
+		err := checkpoints.Apply(context.TODO(), "titles", *events[0], func(tx *gorm.DB) error {
+			return tx.Create(&postTitle{ID: events[0].Meta.RootID, Title: events[0].Type}).Error
+		})
+		if err != nil {
+			t.Fatalf("unexpected error applying event '%s'", err)
+		}
+		checkpoint, err := checkpoints.GetCheckpoint(context.TODO(), "titles")
+		if err != nil {
+			t.Fatalf("unexpected error getting checkpoint '%s'", err)
+		}
+		if checkpoint == nil || checkpoint.EventID != events[0].ID {
+			t.Errorf("expected the checkpoint to be at '%s', got '%v'", events[0].ID, checkpoint)
+		}
+	})
+
+	t.Run("a failed change doesn't move the checkpoint", func(t *testing.T) {
+		err := checkpoints.Apply(context.TODO(), "titles", *events[1], func(tx *gorm.DB) error {
+			tx.Model(&postTitle{}).Where("id = ?", events[1].Meta.RootID).Update("title", events[1].Type)
+			return errors.New("some error")
+		})
+		if err == nil {
+			t.Fatal("expected the error to be returned")
+		}
+		checkpoint, _ := checkpoints.GetCheckpoint(context.TODO(), "titles")
+		if checkpoint.EventID != events[0].ID {
+			t.Errorf("expected the checkpoint to stay at '%s', got '%s'", events[0].ID, checkpoint.EventID)
+		}
+		var title postTitle
+		db.First(&title, "id = ?", events[1].Meta.RootID)
+		if title.Title != events[0].Type {
+			t.Errorf("expected the projection change to be rolled back, got '%s'", title.Title)
+		}
+	})
+
+	t.Run("catch up processes the remaining events", func(t *testing.T) {
+		var processed []string
+		count, err := checkpoints.CatchUp(context.TODO(), "titles", repository, func(ctx context.Context, event weos.Event) {
+			processed = append(processed, event.ID)
+		})
+		if err != nil {
+			t.Fatalf("unexpected error catching up '%s'", err)
+		}
+		if count != 2 || len(processed) != 2 || processed[0] != events[1].ID || processed[1] != events[2].ID {
+			t.Fatalf("expected events '%s' and '%s' to be processed, got %v", events[1].ID, events[2].ID, processed)
+		}
+		checkpoint, _ := checkpoints.GetCheckpoint(context.TODO(), "titles")
+		if checkpoint.EventID != events[2].ID {
+			t.Errorf("expected the checkpoint to be at '%s', got '%s'", events[2].ID, checkpoint.EventID)
+		}
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		if err := checkpoints.ResetCheckpoint(context.TODO(), "titles"); err != nil {
+			t.Fatalf("unexpected error resetting checkpoint '%s'", err)
+		}
+		count, err := checkpoints.CatchUp(context.TODO(), "titles", repository, func(ctx context.Context, event weos.Event) {})
+		if err != nil {
+			t.Fatalf("unexpected error catching up '%s'", err)
+		}
+		if count != len(events) {
+			t.Errorf("expected all %d events to be processed after a reset, got %d", len(events), count)
+		}
+	})
+
+	t.Run("the events processed before an error are counted", func(t *testing.T) {
+		if err := checkpoints.ResetCheckpoint(context.TODO(), "titles"); err != nil {
+			t.Fatalf("unexpected error resetting checkpoint '%s'", err)
+		}
+		handled := 0
+		count, err := checkpoints.CatchUp(context.TODO(), "titles", repository, func(ctx context.Context, event weos.Event) {
+			handled += 1
+			if handled == 2 {
+				//the checkpoint of the second event can't be saved
+				db.Migrator().DropTable(&weos.Checkpoint{})
+			}
+		})
+		if err == nil {
+			t.Fatal("expected an error saving the checkpoint")
+		}
+		if count != 1 {
+			t.Errorf("expected %d event to be processed, got %d", 1, count)
+		}
+	})
+}
+
+func TestGormCheckpointStore_DispatchedEvents(t *testing.T) {
+	db := newMigrationTestDB(t)
+	repository, err := weos.NewBasicEventRepository(db, log.New(), false, "", "")
+	if err != nil {
+		t.Fatalf("unexpected error creating repository '%s'", err)
+	}
+	if err = repository.Migrate(context.TODO()); err != nil {
+		t.Fatalf("unexpected error migrating repository '%s'", err)
+	}
+	checkpoints := weos.NewGormCheckpointStore(db, log.New())
+	if err = checkpoints.Migrate(context.TODO()); err != nil {
+		t.Fatalf("unexpected error migrating checkpoints '%s'", err)
+	}
+	stored := time.Date(2021, 8, 1, 12, 0, 0, 0, time.UTC)
+	repository.(*weos.EventRepositoryGorm).SetClock(weos.NewFakeClock(stored))
+	repository.AddSubscriber(func(ctx context.Context, event weos.Event) {
+		if err := checkpoints.SaveCheckpoint(ctx, "titles", event); err != nil {
+			t.Errorf("unexpected error saving checkpoint '%s'", err)
+		}
+	})
+
+	//the event is created before it's stored
+	ctx := context.WithValue(context.TODO(), weos.CLOCK, weos.NewFakeClock(stored.Add(-time.Hour)))
+	entity := &weos.AggregateRoot{BasicEntity: weos.BasicEntity{ID: "post1"}}
+	entity.NewChange(weos.NewEntityEventWithContext(ctx, "POST_CREATED", entity, entity.ID, nil))
+	if err = repository.Persist(ctx, entity); err != nil {
+		t.Fatalf("unexpected error persisting events '%s'", err)
+	}
+	checkpoint, err := checkpoints.GetCheckpoint(context.TODO(), "titles")
+	if err != nil {
+		t.Fatalf("unexpected error getting checkpoint '%s'", err)
+	}
+	if checkpoint == nil || !checkpoint.EventCreated.Equal(stored) {
+		t.Fatalf("expected the checkpoint to be at the time the event was stored '%s', got '%v'", stored, checkpoint)
+	}
+	count, err := checkpoints.CatchUp(context.TODO(), "titles", repository, func(ctx context.Context, event weos.Event) {
+		t.Errorf("expected the dispatched event '%s' not to be processed again", event.ID)
+	})
+	if err != nil {
+		t.Fatalf("unexpected error catching up '%s'", err)
+	}
+	if count != 0 {
+		t.Errorf("expected no events to catch up on, got %d", count)
+	}
+}
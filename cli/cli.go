@@ -0,0 +1,480 @@
+//Package cli implements the weos command line tool. Applications that have their own projections and command handlers
+//build their own binary by registering a setup function and calling Run from main
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/wepala/weos"
+	"golang.org/x/net/context"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+//SetupFunc adds the projections and command handlers of an application so that the tool can replay projections and
+//dispatch commands
+type SetupFunc func(app weos.Application) error
+
+var setups []SetupFunc
+
+//Register adds a setup function that is run after the application is created from the config
+func Register(setup SetupFunc) {
+	setups = append(setups, setup)
+}
+
+//NewApplication creates the application the tool works with. It can be replaced to customize how the application is setup
+var NewApplication = func(config *weos.ApplicationConfig) (weos.Application, error) {
+	return weos.NewApplicationFromConfig(config, nil, nil, nil, nil)
+}
+
+//EventPorter is implemented by event repositories that can export and import events
+type EventPorter interface {
+	Export(ctx context.Context, w io.Writer, filter weos.EventFilter) (int, error)
+	Import(ctx context.Context, r io.Reader) (int, error)
+}
+
+//ProjectionResetter is implemented by projections that can be cleared so that replaying the events doesn't apply them
+//twice
+type ProjectionResetter interface {
+	Reset(ctx context.Context) error
+}
+
+//ChainVerifier is implemented by event repositories with a tamper evident hash chain
+type ChainVerifier interface {
+	VerifyAll() ([]*weos.ChainBreak, error)
+}
+
+const usage = `Usage: weos [-config file] <command> [arguments]
+
+Commands:
+  migrate                         run the projection and event store migrations
+  events list [filters]           list events (filters: -root, -entity, -entity-type, -type, -limit)
+  events show <event id>          show an event
+  replay [-append] <projection>   reset a projection and replay all the events to it (-append replays to projections
+                                  that can't be reset without clearing them)
+  verify                          check the integrity of the event store (including the hash chain)
+  dispatch <command file>         dispatch a command read from a JSON file
+  export [filters]                export events as newline delimited JSON (filters: -o, -application, -root,
+                                  -from, -to with RFC3339 dates)
+  import <file>                   import events exported as newline delimited JSON
+  stats [filters]                 show event counts (filters: -application, -from, -to, -limit for the number of
+                                  largest aggregates)
+
+The config is a JSON ApplicationConfig. Environment variables in the file (e.g. ${DB_PASSWORD}) are expanded.
+`
+
+//Run executes the command in the arguments (without the program name)
+func Run(args []string, stdout io.Writer, stderr io.Writer) error {
+	flags := flag.NewFlagSet("weos", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+	}
+	configFile := flags.String("config", defaultConfigFile(), "path to the application config")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return weos.NewError("a command is required", nil)
+	}
+
+	config, err := LoadConfig(*configFile)
+	if err != nil {
+		return err
+	}
+	app, err := NewApplication(config)
+	if err != nil {
+		return err
+	}
+	for _, setup := range setups {
+		if err = setup(app); err != nil {
+			return err
+		}
+	}
+
+	ctx := context.Background()
+	command, commandArgs := flags.Arg(0), flags.Args()[1:]
+	switch command {
+	case "migrate":
+		return app.Migrate(ctx)
+	case "events":
+		return events(app, commandArgs, stdout, stderr)
+	case "replay":
+		return replay(ctx, app, commandArgs, stdout, stderr)
+	case "verify":
+		return verify(app, stdout)
+	case "dispatch":
+		return dispatch(ctx, app, commandArgs, stdout)
+	case "export":
+		return export(ctx, app, commandArgs, stdout, stderr)
+	case "import":
+		return importEvents(ctx, app, commandArgs, stdout)
+	case "stats":
+		return stats(ctx, app, commandArgs, stdout, stderr)
+	default:
+		flags.Usage()
+		return weos.NewError(fmt.Sprintf("unknown command '%s'", command), nil)
+	}
+}
+
+func defaultConfigFile() string {
+	if configFile := os.Getenv("WEOS_CONFIG"); configFile != "" {
+		return configFile
+	}
+	return "weos.json"
+}
+
+//LoadConfig reads the application config from a JSON file expanding environment variables
+func LoadConfig(configFile string) (*weos.ApplicationConfig, error) {
+	configBytes, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return nil, weos.NewError(fmt.Sprintf("error reading config '%s'", configFile), err)
+	}
+	config := &weos.ApplicationConfig{}
+	if err = json.Unmarshal([]byte(os.ExpandEnv(string(configBytes))), config); err != nil {
+		return nil, weos.NewError(fmt.Sprintf("error parsing config '%s'", configFile), err)
+	}
+	if config.Database == nil {
+		return nil, weos.NewError(fmt.Sprintf("no database configured in '%s'", configFile), nil)
+	}
+	return config, nil
+}
+
+func events(app weos.Application, args []string, stdout io.Writer, stderr io.Writer) error {
+	if len(args) == 0 {
+		return weos.NewError("events requires a subcommand (list or show)", nil)
+	}
+	switch args[0] {
+	case "list":
+		flags := flag.NewFlagSet("events list", flag.ContinueOnError)
+		flags.SetOutput(stderr)
+		filter := weos.EventFilter{}
+		flags.StringVar(&filter.RootID, "root", "", "root aggregate id")
+		flags.StringVar(&filter.EntityID, "entity", "", "entity id")
+		flags.StringVar(&filter.EntityType, "entity-type", "", "entity type")
+		flags.StringVar(&filter.Type, "type", "", "event type")
+		flags.IntVar(&filter.Limit, "limit", 0, "maximum number of events")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		writer := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(writer, "ID\tTYPE\tROOT\tENTITY TYPE\tENTITY\tSEQUENCE\tCREATED")
+		_, err := weos.ForEachEvent(app.EventRepository(), filter, weos.DefaultEventPageSize, func(event *weos.Event) error {
+			_, err := fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%d\t%s\n", event.ID, event.Type, event.Meta.RootID, event.Meta.EntityType, event.Meta.EntityID, event.Meta.SequenceNo, event.Meta.Created)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		return writer.Flush()
+	case "show":
+		if len(args) != 2 {
+			return weos.NewError("events show requires an event id", nil)
+		}
+		events, err := app.EventRepository().GetEvents(weos.EventFilter{ID: args[1]})
+		if err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			return weos.NewError(fmt.Sprintf("event '%s' not found", args[1]), nil)
+		}
+		eventJSON, err := json.MarshalIndent(events[0], "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(stdout, string(eventJSON))
+		return err
+	default:
+		return weos.NewError(fmt.Sprintf("unknown events subcommand '%s'", args[0]), nil)
+	}
+}
+
+func replay(ctx context.Context, app weos.Application, args []string, stdout io.Writer, stderr io.Writer) error {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	appendEvents := flags.Bool("append", false, "replay to a projection that can't be reset without clearing it")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return weos.NewError("replay requires the projection name", nil)
+	}
+	name := flags.Arg(0)
+	var projection weos.Projection
+	var names []string
+	for _, p := range app.Projections() {
+		names = append(names, weos.ProjectionName(p))
+		if weos.ProjectionName(p) == name {
+			projection = p
+		}
+	}
+	if projection == nil {
+		sort.Strings(names)
+		return weos.NewError(fmt.Sprintf("projection '%s' not found, registered projections %v", name, names), nil)
+	}
+	if err := projection.Migrate(ctx); err != nil {
+		return err
+	}
+	//the projection is cleared first so that events that were already applied aren't applied twice
+	if resetter, ok := projection.(ProjectionResetter); ok {
+		if err := resetter.Reset(ctx); err != nil {
+			return err
+		}
+	} else if !*appendEvents {
+		return weos.NewError(fmt.Sprintf("projection '%s' can't be reset, use -append to replay the events without clearing it", name), nil)
+	}
+	handler := projection.GetEventHandler()
+	replayed, err := weos.ForEachEvent(app.EventRepository(), weos.EventFilter{}, weos.DefaultEventPageSize, func(event *weos.Event) error {
+		handler(ctx, *event)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(stdout, "replayed %d events to '%s'\n", replayed, name)
+	return err
+}
+
+func verify(app weos.Application, stdout io.Writer) error {
+	verifier := NewEventVerifier()
+	verified, err := weos.ForEachEvent(app.EventRepository(), weos.EventFilter{}, weos.DefaultEventPageSize, func(event *weos.Event) error {
+		verifier.Add(event)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	problems := verifier.Problems()
+	if chainVerifier, ok := app.EventRepository().(ChainVerifier); ok {
+		breaks, err := chainVerifier.VerifyAll()
+		if err != nil {
+			return err
+		}
+		for _, chainBreak := range breaks {
+			problems = append(problems, chainBreak.Error())
+		}
+	}
+	for _, problem := range problems {
+		fmt.Fprintln(stdout, problem)
+	}
+	if len(problems) > 0 {
+		return weos.NewError(fmt.Sprintf("found %d problems in %d events", len(problems), verified), nil)
+	}
+	_, err = fmt.Fprintf(stdout, "verified %d events\n", verified)
+	return err
+}
+
+//VerifyEvents checks that the events have the required fields and valid payloads and that the sequence numbers of each
+//root aggregate are unique and have no gaps
+func VerifyEvents(events []*weos.Event) []string {
+	verifier := NewEventVerifier()
+	for _, event := range events {
+		verifier.Add(event)
+	}
+	return verifier.Problems()
+}
+
+//EventVerifier checks events as they are added so that the event store can be verified a page at a time. Only the ids
+//and sequence numbers of the events are kept
+type EventVerifier struct {
+	problems  []string
+	sequences map[aggregateKey]map[int64]string
+	roots     []aggregateKey
+}
+
+//aggregateKey identifies a root aggregate. Accounts can have aggregates with the same id
+type aggregateKey struct {
+	accountID string
+	rootID    string
+}
+
+func (k aggregateKey) String() string {
+	if k.accountID == "" {
+		return fmt.Sprintf("root '%s'", k.rootID)
+	}
+	return fmt.Sprintf("root '%s' of account '%s'", k.rootID, k.accountID)
+}
+
+func NewEventVerifier() *EventVerifier {
+	return &EventVerifier{sequences: make(map[aggregateKey]map[int64]string)}
+}
+
+//Add checks the fields and payload of the event and records its sequence number
+func (v *EventVerifier) Add(event *weos.Event) {
+	//the version isn't stored so Event.IsValid can't be used on stored events
+	if event.ID == "" || event.Type == "" || event.Meta.EntityID == "" {
+		v.problems = append(v.problems, fmt.Sprintf("event '%s' of type '%s' is missing an id, type or entity", event.ID, event.Type))
+	}
+	if len(event.Payload) > 0 && !json.Valid(event.Payload) {
+		v.problems = append(v.problems, fmt.Sprintf("event '%s' has an invalid payload", event.ID))
+	}
+	key := aggregateKey{accountID: event.Meta.AccountID, rootID: event.Meta.RootID}
+	if _, ok := v.sequences[key]; !ok {
+		v.sequences[key] = make(map[int64]string)
+		v.roots = append(v.roots, key)
+	}
+	if existing, ok := v.sequences[key][event.Meta.SequenceNo]; ok {
+		v.problems = append(v.problems, fmt.Sprintf("events '%s' and '%s' of %s have the same sequence number %d", existing, event.ID, key, event.Meta.SequenceNo))
+		return
+	}
+	v.sequences[key][event.Meta.SequenceNo] = event.ID
+}
+
+//Problems returns the problems found in the events that were added including gaps in the sequence numbers
+func (v *EventVerifier) Problems() []string {
+	problems := append([]string(nil), v.problems...)
+	for _, key := range v.roots {
+		for sequenceNo := int64(1); sequenceNo <= int64(len(v.sequences[key])); sequenceNo++ {
+			if _, ok := v.sequences[key][sequenceNo]; !ok {
+				problems = append(problems, fmt.Sprintf("%s is missing the event with sequence number %d", key, sequenceNo))
+			}
+		}
+	}
+	return problems
+}
+
+func dispatch(ctx context.Context, app weos.Application, args []string, stdout io.Writer) error {
+	if len(args) != 1 {
+		return weos.NewError("dispatch requires a command file", nil)
+	}
+	commandBytes, err := ioutil.ReadFile(args[0])
+	if err != nil {
+		return weos.NewError(fmt.Sprintf("error reading command '%s'", args[0]), err)
+	}
+	command := &weos.Command{}
+	if err = json.Unmarshal(commandBytes, command); err != nil {
+		return weos.NewError(fmt.Sprintf("error parsing command '%s'", args[0]), err)
+	}
+	if err = app.Dispatcher().Dispatch(ctx, command); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(stdout, "dispatched command '%s' (%s)\n", command.Type, command.ID)
+	return err
+}
+
+func eventPorter(app weos.Application) (EventPorter, error) {
+	porter, ok := app.EventRepository().(EventPorter)
+	if !ok {
+		return nil, weos.NewError("the event repository doesn't support export and import", nil)
+	}
+	return porter, nil
+}
+
+func export(ctx context.Context, app weos.Application, args []string, stdout io.Writer, stderr io.Writer) error {
+	porter, err := eventPorter(app)
+	if err != nil {
+		return err
+	}
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	filter := weos.EventFilter{}
+	output := flags.String("o", "", "file to export to (defaults to stdout)")
+	flags.StringVar(&filter.ApplicationID, "application", "", "application id")
+	flags.StringVar(&filter.RootID, "root", "", "root aggregate id")
+	from := flags.String("from", "", "export events created from this date")
+	to := flags.String("to", "", "export events created before this date")
+	if err = flags.Parse(args); err != nil {
+		return err
+	}
+	if filter.From, err = parseDate(*from); err != nil {
+		return err
+	}
+	if filter.To, err = parseDate(*to); err != nil {
+		return err
+	}
+	if *output == "" {
+		_, err = porter.Export(ctx, stdout, filter)
+		return err
+	}
+	file, err := os.Create(*output)
+	if err != nil {
+		return weos.NewError(fmt.Sprintf("error creating export file '%s'", *output), err)
+	}
+	_, err = porter.Export(ctx, file, filter)
+	//the export isn't complete until the file is closed (e.g. the last write can fail on close)
+	if closeErr := file.Close(); err == nil && closeErr != nil {
+		return weos.NewError(fmt.Sprintf("error closing export file '%s'", *output), closeErr)
+	}
+	return err
+}
+
+func importEvents(ctx context.Context, app weos.Application, args []string, stdout io.Writer) error {
+	if len(args) != 1 {
+		return weos.NewError("import requires a file", nil)
+	}
+	porter, err := eventPorter(app)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(args[0])
+	if err != nil {
+		return weos.NewError(fmt.Sprintf("error opening import file '%s'", args[0]), err)
+	}
+	defer file.Close()
+	imported, err := porter.Import(ctx, file)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(stdout, "imported %d events\n", imported)
+	return err
+}
+
+func parseDate(date string) (time.Time, error) {
+	if date == "" {
+		return time.Time{}, nil
+	}
+	parsed, err := time.Parse(time.RFC3339, date)
+	if err != nil {
+		return time.Time{}, weos.NewError(fmt.Sprintf("invalid date '%s', use RFC3339 e.g. 2021-08-01T00:00:00Z", date), err)
+	}
+	return parsed, nil
+}
+
+func stats(ctx context.Context, app weos.Application, args []string, stdout io.Writer, stderr io.Writer) error {
+	flags := flag.NewFlagSet("stats", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	filter := weos.EventFilter{}
+	flags.StringVar(&filter.ApplicationID, "application", "", "application id")
+	from := flags.String("from", "", "count events created from this date")
+	to := flags.String("to", "", "count events created before this date")
+	flags.IntVar(&filter.Limit, "limit", weos.DefaultLargestAggregates, "number of largest aggregates")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if filter.From, err = parseDate(*from); err != nil {
+		return err
+	}
+	if filter.To, err = parseDate(*to); err != nil {
+		return err
+	}
+	statistics, err := app.Statistics(ctx, filter)
+	if err != nil {
+		return err
+	}
+	writer := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(writer, "TOTAL\t%d\n", statistics.Total)
+	sections := []struct {
+		title  string
+		counts []weos.StatisticCount
+	}{
+		{"EVENT TYPE", statistics.ByType},
+		{"ENTITY TYPE", statistics.ByEntityType},
+		{"USER", statistics.ByUser},
+		{"DAY", statistics.PerDay},
+		{"AGGREGATE", statistics.LargestAggregates},
+	}
+	for _, section := range sections {
+		fmt.Fprintf(writer, "\n%s\tEVENTS\n", section.title)
+		for _, count := range section.counts {
+			fmt.Fprintf(writer, "%s\t%d\n", count.Name, count.Count)
+		}
+	}
+	return writer.Flush()
+}
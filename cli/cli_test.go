@@ -0,0 +1,196 @@
+package cli_test
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/wepala/weos"
+	"github.com/wepala/weos/cli"
+	"golang.org/x/net/context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type testProjection struct {
+	events []weos.Event
+}
+
+func (p *testProjection) Migrate(ctx context.Context) error {
+	return nil
+}
+
+func (p *testProjection) Reset(ctx context.Context) error {
+	p.events = nil
+	return nil
+}
+
+func (p *testProjection) GetEventHandler() weos.EventHandler {
+	return func(ctx context.Context, event weos.Event) {
+		p.events = append(p.events, event)
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "weos.json")
+	config := fmt.Sprintf(`{"moduleId":"blog","database":{"driver":"sqlite3","database":"%s"}}`, filepath.Join(dir, "${DB_NAME}"))
+	if err := ioutil.WriteFile(configFile, []byte(config), 0600); err != nil {
+		t.Fatalf("error writing config '%s'", err)
+	}
+	os.Setenv("DB_NAME", "test.db")
+	defer os.Unsetenv("DB_NAME")
+	commandFile := filepath.Join(dir, "command.json")
+	if err := ioutil.WriteFile(commandFile, []byte(`{"type":"CREATE_POST","payload":{"title":"First Post"}}`), 0600); err != nil {
+		t.Fatalf("error writing command '%s'", err)
+	}
+
+	projection := &testProjection{}
+	cli.Register(func(app weos.Application) error {
+		app.Dispatcher().AddSubscriber(&weos.Command{Type: "CREATE_POST"}, func(ctx context.Context, command *weos.Command) error {
+			entity := &weos.AggregateRoot{BasicEntity: weos.BasicEntity{ID: "1wqoyqIRsZTtnP3wjKh2Mq1Qp03"}}
+			entity.NewChange(weos.NewEntityEventWithContext(ctx, "POST_CREATED", entity, entity.ID, command.Payload))
+			return app.EventRepository().Persist(ctx, entity)
+		})
+		projection.events = nil
+		return app.AddProjection(projection)
+	})
+
+	run := func(args ...string) (string, error) {
+		stdout := &bytes.Buffer{}
+		err := cli.Run(append([]string{"-config", configFile}, args...), stdout, &bytes.Buffer{})
+		return stdout.String(), err
+	}
+
+	if _, err := run("migrate"); err != nil {
+		t.Fatalf("unexpected error migrating '%s'", err)
+	}
+	output, err := run("dispatch", commandFile)
+	if err != nil {
+		t.Fatalf("unexpected error dispatching command '%s'", err)
+	}
+	if !strings.HasPrefix(output, "dispatched command 'CREATE_POST'") {
+		t.Errorf("expected the command to be dispatched, got '%s'", output)
+	}
+
+	t.Run("events list", func(t *testing.T) {
+		output, err := run("events", "list", "-type", "POST_CREATED")
+		if err != nil {
+			t.Fatalf("unexpected error listing events '%s'", err)
+		}
+		lines := strings.Split(strings.TrimSpace(output), "\n")
+		if len(lines) != 2 {
+			t.Fatalf("expected a header and %d event, got '%s'", 1, output)
+		}
+		eventID := strings.Fields(lines[1])[0]
+
+		output, err = run("events", "show", eventID)
+		if err != nil {
+			t.Fatalf("unexpected error showing event '%s'", err)
+		}
+		if !strings.Contains(output, `"title": "First Post"`) {
+			t.Errorf("expected the event payload to be shown, got '%s'", output)
+		}
+
+		output, err = run("events", "list", "-type", "POST_UPDATED")
+		if err != nil {
+			t.Fatalf("unexpected error listing events '%s'", err)
+		}
+		if len(strings.Split(strings.TrimSpace(output), "\n")) != 1 {
+			t.Errorf("expected no events, got '%s'", output)
+		}
+	})
+
+	t.Run("replay", func(t *testing.T) {
+		output, err := run("replay", "testProjection")
+		if err != nil {
+			t.Fatalf("unexpected error replaying projection '%s'", err)
+		}
+		if len(projection.events) != 1 || projection.events[0].Type != "POST_CREATED" {
+			t.Errorf("expected the event to be replayed to the projection, got %d events", len(projection.events))
+		}
+		if !strings.Contains(output, "replayed 1 events") {
+			t.Errorf("expected the replay to be reported, got '%s'", output)
+		}
+		if _, err = run("replay", "testProjection"); err != nil {
+			t.Fatalf("unexpected error replaying projection '%s'", err)
+		}
+		if len(projection.events) != 1 {
+			t.Errorf("expected the projection to be reset before it's replayed, got %d events", len(projection.events))
+		}
+		if _, err = run("replay", "unknown"); err == nil {
+			t.Error("expected an error replaying an unknown projection")
+		}
+	})
+
+	t.Run("verify", func(t *testing.T) {
+		output, err := run("verify")
+		if err != nil {
+			t.Fatalf("unexpected error verifying the event store '%s' %s", err, output)
+		}
+		if !strings.Contains(output, "verified 1 events") {
+			t.Errorf("expected the verification to be reported, got '%s'", output)
+		}
+	})
+
+	t.Run("export and import", func(t *testing.T) {
+		exportFile := filepath.Join(dir, "events.ndjson")
+		if _, err := run("export", "-o", exportFile, "-from", "2021-01-01T00:00:00Z"); err != nil {
+			t.Fatalf("unexpected error exporting events '%s'", err)
+		}
+		exported, err := ioutil.ReadFile(exportFile)
+		if err != nil {
+			t.Fatalf("error reading export '%s'", err)
+		}
+		if len(strings.Split(strings.TrimSpace(string(exported)), "\n")) != 1 {
+			t.Errorf("expected %d event to be exported, got '%s'", 1, exported)
+		}
+		output, err := run("import", exportFile)
+		if err != nil {
+			t.Fatalf("unexpected error importing events '%s'", err)
+		}
+		if !strings.Contains(output, "imported 0 events") {
+			t.Errorf("expected existing events to be skipped, got '%s'", output)
+		}
+		if _, err = run("export", "-from", "yesterday"); err == nil {
+			t.Error("expected an error exporting with an invalid date")
+		}
+	})
+
+	t.Run("stats", func(t *testing.T) {
+		output, err := run("stats", "-limit", "1")
+		if err != nil {
+			t.Fatalf("unexpected error getting statistics '%s'", err)
+		}
+		if !strings.Contains(output, "TOTAL") || !strings.Contains(output, "POST_CREATED") {
+			t.Errorf("expected the event counts to be shown, got '%s'", output)
+		}
+	})
+
+	t.Run("unknown command", func(t *testing.T) {
+		if _, err := run("unknown"); err == nil {
+			t.Error("expected an error running an unknown command")
+		}
+	})
+}
+
+func TestVerifyEvents(t *testing.T) {
+	events := []*weos.Event{
+		{ID: "1", Type: "POST_CREATED", Meta: weos.EventMeta{EntityID: "post", RootID: "post", SequenceNo: 1}},
+		{ID: "2", Type: "POST_UPDATED", Meta: weos.EventMeta{EntityID: "post", RootID: "post", SequenceNo: 1}},
+		{ID: "3", Type: "POST_UPDATED", Meta: weos.EventMeta{EntityID: "post", RootID: "post", SequenceNo: 4}},
+		{ID: "4", Meta: weos.EventMeta{EntityID: "post", RootID: "other", SequenceNo: 1}, Payload: []byte("{")},
+		{ID: "5", Type: "POST_CREATED", Meta: weos.EventMeta{EntityID: "post", RootID: "post", SequenceNo: 1, AccountID: "account-2"}},
+	}
+	problems := strings.Join(cli.VerifyEvents(events), "\n")
+	expected := []string{"same sequence number", "missing the event with sequence number 2", "missing an id, type or entity", "invalid payload"}
+	for _, problem := range expected {
+		if !strings.Contains(problems, problem) {
+			t.Errorf("expected a problem '%s', got \n%s", problem, problems)
+		}
+	}
+	if strings.Contains(problems, "'5'") {
+		t.Errorf("expected the aggregates of other accounts to be checked separately, got \n%s", problems)
+	}
+}
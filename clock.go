@@ -0,0 +1,104 @@
+package weos
+
+import (
+	"fmt"
+	"github.com/segmentio/ksuid"
+	"golang.org/x/net/context"
+	"sync"
+	"time"
+)
+
+//Clock tells the time. Components get the time from a clock instead of calling time.Now so that tests and replays can
+//control it
+type Clock interface {
+	Now() time.Time
+}
+
+//IDGenerator creates the ids of events, commands and queries
+type IDGenerator interface {
+	NewID() string
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+type ksuidGenerator struct{}
+
+func (ksuidGenerator) NewID() string {
+	return ksuid.New().String()
+}
+
+//DefaultClock is used when there is no clock in the context (e.g. by NewEntityEvent)
+var DefaultClock Clock = systemClock{}
+
+//DefaultIDGenerator is used when there is no id generator in the context (e.g. by NewEntityEvent)
+var DefaultIDGenerator IDGenerator = ksuidGenerator{}
+
+//FakeClock is a clock for tests that only moves when it's told to
+type FakeClock struct {
+	current time.Time
+	mutex   sync.RWMutex
+}
+
+func NewFakeClock(current time.Time) *FakeClock {
+	return &FakeClock{current: current}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.current
+}
+
+//Advance moves the clock forward
+func (c *FakeClock) Advance(duration time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.current = c.current.Add(duration)
+}
+
+//Set changes the time of the clock
+func (c *FakeClock) Set(current time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.current = current
+}
+
+//FakeIDGenerator generates predictable ids for tests e.g. "event-1", "event-2"
+type FakeIDGenerator struct {
+	prefix string
+	next   int
+	mutex  sync.Mutex
+}
+
+func NewFakeIDGenerator(prefix string) *FakeIDGenerator {
+	return &FakeIDGenerator{prefix: prefix}
+}
+
+func (g *FakeIDGenerator) NewID() string {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.next++
+	return fmt.Sprintf("%s-%d", g.prefix, g.next)
+}
+
+//Reset starts the ids from the beginning again
+func (g *FakeIDGenerator) Reset() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.next = 0
+}
+
+//clockContext adds the clock and id generator to the context so that events created while handling a command use them
+func clockContext(ctx context.Context, clock Clock, generator IDGenerator) context.Context {
+	if clock != nil {
+		ctx = context.WithValue(ctx, CLOCK, clock)
+	}
+	if generator != nil {
+		ctx = context.WithValue(ctx, ID_GENERATOR, generator)
+	}
+	return ctx
+}
@@ -0,0 +1,107 @@
+package weos_test
+
+import (
+	"database/sql"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"github.com/wepala/weos"
+	"golang.org/x/net/context"
+	"testing"
+	"time"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2021, 8, 1, 12, 0, 0, 0, time.UTC)
+	clock := weos.NewFakeClock(start)
+	if !clock.Now().Equal(start) {
+		t.Errorf("expected the time to be '%s', got '%s'", start, clock.Now())
+	}
+	clock.Advance(time.Hour)
+	if !clock.Now().Equal(start.Add(time.Hour)) {
+		t.Errorf("expected the clock to advance to '%s', got '%s'", start.Add(time.Hour), clock.Now())
+	}
+}
+
+func TestFakeIDGenerator(t *testing.T) {
+	generator := weos.NewFakeIDGenerator("event")
+	if generator.NewID() != "event-1" || generator.NewID() != "event-2" {
+		t.Error("expected the ids to be sequential")
+	}
+	generator.Reset()
+	if id := generator.NewID(); id != "event-1" {
+		t.Errorf("expected the ids to start again after a reset, got '%s'", id)
+	}
+}
+
+func TestBaseApplication_Clock(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("error opening database '%s'", err)
+	}
+	db.SetMaxOpenConns(1)
+	app, err := weos.NewApplicationFromConfig(&weos.ApplicationConfig{
+		Database: &weos.DBConfig{Driver: "sqlite3", Database: ":memory:"},
+	}, log.New(), db, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error setting up app '%s'", err)
+	}
+	if err = app.Migrate(context.TODO()); err != nil {
+		t.Fatalf("unexpected error migrating app '%s'", err)
+	}
+	now := time.Date(2021, 8, 1, 12, 0, 0, 0, time.UTC)
+	app.SetClock(weos.NewFakeClock(now))
+	app.SetIDGenerator(weos.NewFakeIDGenerator("id"))
+
+	app.Dispatcher().AddSubscriber(&weos.Command{Type: "CREATE_POST"}, func(ctx context.Context, command *weos.Command) error {
+		entity := &weos.AggregateRoot{BasicEntity: weos.BasicEntity{ID: "post-1"}}
+		entity.NewChange(weos.NewEntityEventWithContext(ctx, "POST_CREATED", entity, "post-1", map[string]string{"title": "First Post"}))
+		return app.EventRepository().Persist(ctx, entity)
+	})
+	command := &weos.Command{Type: "CREATE_POST"}
+	if err = app.Dispatcher().Dispatch(context.TODO(), command); err != nil {
+		t.Fatalf("unexpected error dispatching command '%s'", err)
+	}
+	if command.ID != "id-1" {
+		t.Errorf("expected the command id to be '%s', got '%s'", "id-1", command.ID)
+	}
+	events, err := app.EventRepository().GetByAggregate("post-1")
+	if err != nil {
+		t.Fatalf("unexpected error getting events '%s'", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected %d event, got %d", 1, len(events))
+	}
+	if events[0].ID != "id-2" {
+		t.Errorf("expected the event id to be '%s', got '%s'", "id-2", events[0].ID)
+	}
+	if created, _ := time.Parse(time.RFC3339Nano, events[0].Meta.Created); !created.Equal(now) {
+		t.Errorf("expected the event to be stored at '%s', got '%s'", now, events[0].Meta.Created)
+	}
+	if app.Clock().Now() != now {
+		t.Errorf("expected the application clock to be the fake clock")
+	}
+}
+
+func TestEventFactories_Clock(t *testing.T) {
+	now := time.Date(2021, 8, 1, 12, 0, 0, 0, time.UTC)
+	ctx := context.WithValue(context.TODO(), weos.CLOCK, weos.NewFakeClock(now))
+	ctx = context.WithValue(ctx, weos.ID_GENERATOR, weos.NewFakeIDGenerator("event"))
+	entity := &weos.AggregateRoot{BasicEntity: weos.BasicEntity{ID: "post-1"}}
+	basicEvent, _ := weos.NewBasicEventWithContext(ctx, "POST_CREATED", "post-1", "Post", nil)
+	aggregateEvent := weos.NewAggregateEventWithContext(ctx, "POST_CREATED", entity, nil)
+	versionEvent, _ := weos.NewVersionEventWithContext(ctx, "POST_CREATED", "post-1", nil, 2)
+	events := []*weos.Event{
+		basicEvent,
+		aggregateEvent,
+		versionEvent,
+		weos.NewEntityEventWithContext(ctx, "POST_CREATED", entity, "post-1", nil),
+	}
+	for i, event := range events {
+		if expected := fmt.Sprintf("event-%d", i+1); event.ID != expected {
+			t.Errorf("expected the event id to be '%s', got '%s'", expected, event.ID)
+		}
+		if created, _ := time.Parse(time.RFC3339Nano, event.Meta.Created); !created.Equal(now) {
+			t.Errorf("expected the event to be created at '%s', got '%s'", now, event.Meta.Created)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+//Command weos migrates, inspects and replays the event store of a WeOS application.
+//Applications with their own projections and command handlers should build their own binary that registers them with
+//cli.Register before calling cli.Run
+package main
+
+import (
+	"fmt"
+	"github.com/wepala/weos/cli"
+	"os"
+)
+
+func main() {
+	if err := cli.Run(os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		fmt.Fprintf(os.Stderr, "weos: %s\n", err)
+		os.Exit(1)
+	}
+}
@@ -3,13 +3,17 @@ package weos
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"golang.org/x/net/context"
+	"reflect"
+	"strings"
 	"sync"
 	"time"
 )
 
 //Command is a common interface that all incoming requests should implement.
 type Command struct {
+	ID       string          `json:"id"`
 	Type     string          `json:"type"`
 	Payload  json.RawMessage `json:"payload"`
 	Metadata CommandMetadata `json:"metadata"`
@@ -29,9 +33,20 @@ type Dispatcher interface {
 }
 
 type DefaultCommandDispatcher struct {
-	handlers        map[string][]CommandHandler
-	handlerPanicked bool
-	dispatch        sync.Mutex
+	handlers map[string][]CommandHandler
+	payloads map[string]reflect.Type
+	health   handlerHealth
+	dispatch sync.Mutex
+	Metrics  *Metrics
+	Tracer   *Tracer
+	//PanicWindow is how long the dispatcher is unhealthy after a handler panics. If it's 0 the dispatcher is unhealthy
+	//until ResetHealth is called
+	PanicWindow time.Duration
+	//Clock and IDGenerator are added to the context of handlers so that the events they create use them
+	Clock       Clock
+	IDGenerator IDGenerator
+	//Authorizer is consulted before the handlers of a command run. If it's nil all commands are allowed
+	Authorizer Authorizer
 }
 
 func (e *DefaultCommandDispatcher) Dispatch(ctx context.Context, command *Command) error {
@@ -40,6 +55,41 @@ func (e *DefaultCommandDispatcher) Dispatch(ctx context.Context, command *Comman
 	defer e.dispatch.Unlock()
 	var wg sync.WaitGroup
 	var err error
+	var errMutex sync.Mutex
+	//the command id is the cause of the events the handlers create and starts a correlation if there isn't one already
+	ctx = clockContext(ctx, e.Clock, e.IDGenerator)
+	if command.ID == "" {
+		command.ID = GetIDGenerator(ctx).NewID()
+	}
+	if GetCorrelationID(ctx) == "" {
+		ctx = context.WithValue(ctx, CORRELATION_ID, command.ID)
+	}
+	ctx = context.WithValue(ctx, CAUSATION_ID, command.ID)
+	if err = checkCommandMetadata(ctx, command); err != nil {
+		return err
+	}
+	//the metadata is used to record who issued the command on the events the handlers create
+	ctx = context.WithValue(ctx, COMMAND_METADATA, command.Metadata)
+	ctx, span := e.Tracer.StartSpan(ctx, "command.dispatch")
+	span.SetAttribute("command.type", command.Type)
+	span.SetAttribute("command.id", command.ID)
+	defer func() {
+		span.SetError(err)
+		span.Finish()
+	}()
+	if e.Authorizer != nil {
+		if err = e.Authorizer.Authorize(ctx, GetCurrentUser(ctx), command); err != nil {
+			return err
+		}
+	}
+	metricLabel := command.Type
+	if _, ok := e.handlers[command.Type]; !ok {
+		metricLabel = UnknownLabel
+	}
+	e.Metrics.commandDispatched(metricLabel)
+	if err = e.validatePayload(ctx, command); err != nil {
+		return err
+	}
 	if handlers, ok := e.handlers[command.Type]; ok {
 		var allHandlers []CommandHandler
 		//lets see if there are any global handlers and add those
@@ -53,14 +103,28 @@ func (e *DefaultCommandDispatcher) Dispatch(ctx context.Context, command *Comman
 			handler := allHandlers[i]
 			wg.Add(1)
 			go func() {
+				start := time.Now()
+				handlerCtx, handlerSpan := e.Tracer.StartSpan(ctx, "command.handler")
+				handlerSpan.SetAttribute("command.type", command.Type)
+				var handlerErr error
+				panicked := false
 				defer func() {
 					if r := recover(); r != nil {
-						e.handlerPanicked = true
-						err = errors.New("handlers panicked")
+						e.health.panicked(GetClock(ctx).Now())
+						panicked = true
+						handlerErr = errors.New("handlers panicked")
 					}
+					if handlerErr != nil {
+						errMutex.Lock()
+						err = handlerErr
+						errMutex.Unlock()
+					}
+					e.Metrics.observeCommand(metricLabel, time.Since(start), handlerErr, panicked)
+					handlerSpan.SetError(handlerErr)
+					handlerSpan.Finish()
 					wg.Done()
 				}()
-				err = handler(ctx, command)
+				handlerErr = handler(handlerCtx, command)
 			}()
 		}
 
@@ -79,8 +143,72 @@ func (e *DefaultCommandDispatcher) AddSubscriber(command *Command, handler Comma
 	return e.handlers
 }
 
+//RegisterPayload registers the payload struct of commands of the type. The payload of the commands is checked against
+//the validation rules of the struct before the handlers are run. If the payload is invalid the handlers are not run and
+//an error listing the invalid fields is returned
+func (e *DefaultCommandDispatcher) RegisterPayload(commandType string, payload interface{}) {
+	if e.payloads == nil {
+		e.payloads = map[string]reflect.Type{}
+	}
+	payloadType := reflect.TypeOf(payload)
+	for payloadType.Kind() == reflect.Ptr {
+		payloadType = payloadType.Elem()
+	}
+	e.payloads[commandType] = payloadType
+}
+
+func (e *DefaultCommandDispatcher) validatePayload(ctx context.Context, command *Command) error {
+	payloadType, ok := e.payloads[command.Type]
+	if !ok {
+		return nil
+	}
+	payload := reflect.New(payloadType).Interface()
+	if len(command.Payload) > 0 {
+		if err := json.Unmarshal(command.Payload, payload); err != nil {
+			return NewValidationError(ctx, "invalid_payload", fmt.Sprintf("the payload of command '%s' is invalid", command.Type), err)
+		}
+	}
+	errs := ValidateStruct(payload)
+	if len(errs) == 0 {
+		return nil
+	}
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+	}
+	//the message lists all the invalid fields so the first one isn't wrapped as well
+	return NewValidationError(ctx, "invalid_payload", fmt.Sprintf("the payload of command '%s' is invalid: %s", command.Type, strings.Join(messages, "; ")), nil)
+}
+
+//checkCommandMetadata returns a forbidden error if the metadata names a different user or account than the one that
+//was authenticated. The metadata can't be used to act as someone else
+func checkCommandMetadata(ctx context.Context, command *Command) error {
+	if user, ok := ctx.Value(USER_ID).(string); ok && command.Metadata.UserID != "" && command.Metadata.UserID != user {
+		return NewForbiddenError(ctx, fmt.Sprintf("command '%s' names a different user than the one authenticated", command.Type), "Command", command.ID)
+	}
+	if account, ok := ctx.Value(ACCOUNT_ID).(string); ok && command.Metadata.AccountID != "" && command.Metadata.AccountID != account {
+		return NewForbiddenError(ctx, fmt.Sprintf("command '%s' names a different account than the one authenticated", command.Type), "Command", command.ID)
+	}
+	return nil
+}
+
 func (e *DefaultCommandDispatcher) GetSubscribers() map[string][]CommandHandler {
 	return e.handlers
 }
 
+//HealthCheck returns an error if any of the command handlers have panicked (within the PanicWindow). It doesn't wait
+//for commands that are being dispatched
+func (e *DefaultCommandDispatcher) HealthCheck(ctx context.Context) error {
+	now := DefaultClock.Now()
+	if e.Clock != nil {
+		now = e.Clock.Now()
+	}
+	return e.health.check("command handlers panicked", now, e.PanicWindow)
+}
+
+//ResetHealth marks the dispatcher as healthy again e.g. after the handler that panicked was fixed
+func (e *DefaultCommandDispatcher) ResetHealth() {
+	e.health.reset()
+}
+
 type CommandHandler func(ctx context.Context, command *Command) error
@@ -1,6 +1,7 @@
 package weos_test
 
 import (
+	log "github.com/sirupsen/logrus"
 	"github.com/wepala/weos"
 	"golang.org/x/net/context"
 	"testing"
@@ -38,3 +39,127 @@ func TestCommandDisptacher_Dispatch(t *testing.T) {
 		t.Errorf("expected %d handler to be called, %d called", 2, handlersCalled)
 	}
 }
+
+func TestCommandDisptacher_Correlation(t *testing.T) {
+	db := newMigrationTestDB(t)
+	repository, err := weos.NewBasicEventRepository(db, log.New(), false, "", "")
+	if err != nil {
+		t.Fatalf("unexpected error creating repository '%s'", err)
+	}
+	if err = repository.Migrate(context.TODO()); err != nil {
+		t.Fatalf("unexpected error migrating repository '%s'", err)
+	}
+	//the notification is stored with another repository since event handlers can't persist to the repository that is
+	//dispatching the event
+	notificationRepository, err := weos.NewBasicEventRepository(db, log.New(), false, "", "")
+	if err != nil {
+		t.Fatalf("unexpected error creating repository '%s'", err)
+	}
+	persist := func(repository weos.EventRepository, eventType string) weos.CommandHandler {
+		return func(ctx context.Context, command *weos.Command) error {
+			entity := &weos.AggregateRoot{BasicEntity: weos.BasicEntity{ID: "1wqoyqIRsZTtnP3wjKh2Mq1Qp03"}}
+			entity.NewChange(weos.NewEntityEventWithContext(ctx, eventType, entity, entity.ID, nil))
+			return repository.Persist(ctx, entity)
+		}
+	}
+	dispatcher := &weos.DefaultCommandDispatcher{}
+	dispatcher.AddSubscriber(&weos.Command{Type: "CREATE_POST"}, persist(repository, "POST_CREATED"))
+	notificationDispatcher := &weos.DefaultCommandDispatcher{}
+	notificationDispatcher.AddSubscriber(&weos.Command{Type: "SEND_NOTIFICATION"}, persist(notificationRepository, "NOTIFICATION_SENT"))
+	var notification *weos.Command
+	repository.AddSubscriber(func(ctx context.Context, event weos.Event) {
+		if event.Type == "POST_CREATED" {
+			notification = &weos.Command{Type: "SEND_NOTIFICATION"}
+			if err := notificationDispatcher.Dispatch(ctx, notification); err != nil {
+				t.Errorf("unexpected error dispatching notification '%s'", err)
+			}
+		}
+	})
+
+	command := &weos.Command{Type: "CREATE_POST"}
+	if err = dispatcher.Dispatch(context.TODO(), command); err != nil {
+		t.Fatalf("unexpected error dispatching command '%s'", err)
+	}
+	if command.ID == "" {
+		t.Fatal("expected the command to be assigned an id")
+	}
+
+	events, err := repository.GetByCorrelationID(command.ID)
+	if err != nil {
+		t.Fatalf("unexpected error getting events '%s'", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected %d events, got %d", 2, len(events))
+	}
+	if events[0].Type != "POST_CREATED" || events[0].Meta.CausationID != command.ID {
+		t.Errorf("expected '%s' to be caused by the command '%s', got '%s'", events[0].Type, command.ID, events[0].Meta.CausationID)
+	}
+	if notification.ID == "" || events[1].Meta.CausationID != notification.ID {
+		t.Errorf("expected '%s' to be caused by the notification command '%s', got '%s'", events[1].Type, notification.ID, events[1].Meta.CausationID)
+	}
+
+	t.Run("existing correlation is kept", func(t *testing.T) {
+		ctx := context.WithValue(context.TODO(), weos.CORRELATION_ID, "existing")
+		if err = dispatcher.Dispatch(ctx, &weos.Command{ID: "command", Type: "CREATE_POST"}); err != nil {
+			t.Fatalf("unexpected error dispatching command '%s'", err)
+		}
+		events, err := repository.GetByCorrelationID("existing")
+		if err != nil {
+			t.Fatalf("unexpected error getting events '%s'", err)
+		}
+		if len(events) != 2 {
+			t.Fatalf("expected %d events, got %d", 2, len(events))
+		}
+		if events[0].Meta.CausationID != "command" {
+			t.Errorf("expected the event to be caused by '%s', got '%s'", "command", events[0].Meta.CausationID)
+		}
+	})
+}
+
+func TestCommandDisptacher_Metadata(t *testing.T) {
+	repository, err := weos.NewBasicEventRepository(newMigrationTestDB(t), log.New(), false, "", "")
+	if err != nil {
+		t.Fatalf("unexpected error creating repository '%s'", err)
+	}
+	if err = repository.Migrate(context.TODO()); err != nil {
+		t.Fatalf("unexpected error migrating repository '%s'", err)
+	}
+	dispatcher := &weos.DefaultCommandDispatcher{}
+	dispatcher.AddSubscriber(&weos.Command{Type: "CREATE_POST"}, func(ctx context.Context, command *weos.Command) error {
+		entity := &weos.AggregateRoot{BasicEntity: weos.BasicEntity{ID: "1wqoyqIRsZTtnP3wjKh2Mq1Qp03"}}
+		//the handler "forgets" to use the context when creating the event
+		entity.NewChange(weos.NewEntityEvent("POST_CREATED", entity, entity.ID, nil))
+		return repository.Persist(ctx, entity)
+	})
+	command := &weos.Command{Type: "CREATE_POST", Metadata: weos.CommandMetadata{UserID: "user1", AccountID: "account1"}}
+	if err = dispatcher.Dispatch(context.TODO(), command); err != nil {
+		t.Fatalf("unexpected error dispatching command '%s'", err)
+	}
+
+	events, err := repository.GetByCorrelationID(command.ID)
+	if err != nil {
+		t.Fatalf("unexpected error getting events '%s'", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected %d event, got %d", 1, len(events))
+	}
+	if events[0].Meta.User != "user1" {
+		t.Errorf("expected the event user to be '%s', got '%s'", "user1", events[0].Meta.User)
+	}
+	if events[0].Meta.AccountID != "account1" {
+		t.Errorf("expected the event account to be '%s', got '%s'", "account1", events[0].Meta.AccountID)
+	}
+
+	t.Run("the context takes precedence over the command metadata", func(t *testing.T) {
+		ctx := context.WithValue(context.TODO(), weos.USER_ID, "user2")
+		ctx = context.WithValue(ctx, weos.COMMAND_METADATA, weos.CommandMetadata{UserID: "user1", AccountID: "account1"})
+		entity := &weos.AggregateRoot{BasicEntity: weos.BasicEntity{ID: "1wqoyqIRsZTtnP3wjKh2Mq1Qp03"}}
+		event := weos.NewEntityEventWithContext(ctx, "POST_CREATED", entity, entity.ID, nil)
+		if event.Meta.User != "user2" {
+			t.Errorf("expected the event user to be '%s', got '%s'", "user2", event.Meta.User)
+		}
+		if event.Meta.AccountID != "account1" {
+			t.Errorf("expected the event account to be '%s', got '%s'", "account1", event.Meta.AccountID)
+		}
+	})
+}
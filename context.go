@@ -11,6 +11,15 @@ const ACCOUNT_ID ContextKey = "ACCOUNT_ID"
 const USER_ID ContextKey = "USER_ID"
 const LOG_LEVEL ContextKey = "LOG_LEVEL"
 const REQUEST_ID ContextKey = "REQUEST_ID"
+const SPAN ContextKey = "SPAN"
+const CORRELATION_ID ContextKey = "CORRELATION_ID"
+const CAUSATION_ID ContextKey = "CAUSATION_ID"
+const COMMAND_METADATA ContextKey = "COMMAND_METADATA"
+const MODULE_ID ContextKey = "MODULE_ID"
+const CURRENT_USER ContextKey = "CURRENT_USER"
+const SESSION ContextKey = "SESSION"
+const CLOCK ContextKey = "CLOCK"
+const ID_GENERATOR ContextKey = "ID_GENERATOR"
 
 //---- Context Getters
 
@@ -45,3 +54,100 @@ func GetRequestID(ctx context.Context) string {
 	}
 	return ""
 }
+
+//Get the current trace span from context
+func GetSpan(ctx context.Context) *Span {
+	if value, ok := ctx.Value(SPAN).(*Span); ok {
+		return value
+	}
+	return nil
+}
+
+//Get the correlation id (the id of the command that started the chain of commands and events) from context
+func GetCorrelationID(ctx context.Context) string {
+	if value, ok := ctx.Value(CORRELATION_ID).(string); ok {
+		return value
+	}
+	return ""
+}
+
+//Get the causation id (the id of the command or event that caused the current one) from context
+func GetCausationID(ctx context.Context) string {
+	if value, ok := ctx.Value(CAUSATION_ID).(string); ok {
+		return value
+	}
+	return ""
+}
+
+//Get the id of the module handling the command from context
+func GetModuleID(ctx context.Context) string {
+	if value, ok := ctx.Value(MODULE_ID).(string); ok {
+		return value
+	}
+	return ""
+}
+
+//Get the metadata of the command being handled from context
+func GetCommandMetadata(ctx context.Context) CommandMetadata {
+	if value, ok := ctx.Value(COMMAND_METADATA).(CommandMetadata); ok {
+		return value
+	}
+	return CommandMetadata{}
+}
+
+//Get the authenticated user (with their roles and permissions) from context. If only the user id is in the context a
+//user without roles is returned and if there is no user (or the user has no id) nil is returned. The command metadata is
+//never used since it isn't authenticated
+func GetCurrentUser(ctx context.Context) *User {
+	if value, ok := ctx.Value(CURRENT_USER).(*User); ok && value != nil && value.ID != "" {
+		return value
+	}
+	if userID := GetUser(ctx); userID != "" {
+		return &User{BasicEntity: BasicEntity{ID: userID}}
+	}
+	return nil
+}
+
+//Get the session of the request from context
+func GetSession(ctx context.Context) *Session {
+	if value, ok := ctx.Value(SESSION).(*Session); ok {
+		return value
+	}
+	return nil
+}
+
+//Get the clock from context falling back to the DefaultClock
+func GetClock(ctx context.Context) Clock {
+	if value, ok := ctx.Value(CLOCK).(Clock); ok {
+		return value
+	}
+	return DefaultClock
+}
+
+//Get the id generator from context falling back to the DefaultIDGenerator
+func GetIDGenerator(ctx context.Context) IDGenerator {
+	if value, ok := ctx.Value(ID_GENERATOR).(IDGenerator); ok {
+		return value
+	}
+	return DefaultIDGenerator
+}
+
+//ContextUser returns the user to stamp on events. It's the user in the context falling back to the user that issued the
+//command being handled when the request wasn't authenticated (e.g. commands dispatched by jobs). The dispatcher checks
+//the metadata against the context so it can't name another user. Event repositories (including test doubles) use it so
+//that events are stamped the same way. Don't use it for authorization, use GetCurrentUser
+func ContextUser(ctx context.Context) string {
+	if user, ok := ctx.Value(USER_ID).(string); ok {
+		return user
+	}
+	return GetCommandMetadata(ctx).UserID
+}
+
+//ContextAccount returns the account to stamp on events and errors. Like ContextUser the command metadata is only used
+//when there is no account in the context. Don't use it to choose the tenant, use GetAccount
+func ContextAccount(ctx context.Context) string {
+	if account, ok := ctx.Value(ACCOUNT_ID).(string); ok {
+		return account
+	}
+	return GetCommandMetadata(ctx).AccountID
+}
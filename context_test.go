@@ -39,4 +39,21 @@ func TestGetAccount(t *testing.T) {
 		}
 	})
 
+	t.Run("get command metadata", func(t *testing.T) {
+		ctxt := context.WithValue(context.Background(), weos.COMMAND_METADATA, weos.CommandMetadata{UserID: "123"})
+		metadata := weos.GetCommandMetadata(ctxt)
+		if metadata.UserID != "123" {
+			t.Errorf("expected the command user id to be '%s', got '%s'", "123", metadata.UserID)
+		}
+	})
+
+	t.Run("the command metadata is not an authenticated user", func(t *testing.T) {
+		ctxt := context.WithValue(context.Background(), weos.COMMAND_METADATA, weos.CommandMetadata{UserID: "123", AccountID: "456"})
+		if user := weos.GetCurrentUser(ctxt); user != nil {
+			t.Errorf("expected no current user, got '%s'", user.ID)
+		}
+		if account := weos.GetAccount(ctxt); account != "" {
+			t.Errorf("expected no account, got '%s'", account)
+		}
+	})
 }
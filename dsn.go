@@ -0,0 +1,387 @@
+package weos
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/ClickHouse/clickhouse-go"
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"golang.org/x/net/context"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//TLS modes follow the postgres sslmode naming and are mapped to the equivalent setting for each driver
+const TLSModeDisable = "disable"
+const TLSModeRequire = "require"
+const TLSModeVerifyCA = "verify-ca"
+const TLSModeVerifyFull = "verify-full"
+
+//TLSConfig is the TLS configuration of the database connection. ServerName is the name the server certificate is
+//verified against when it's different from the host. lib/pq only verifies the certificate against the host in the
+//connection string so for postgres the ServerName is used as the host of the connection string and the connections are
+//dialed to the configured Host instead. Code that reads the host from the connection string gets the ServerName. The
+//substitution doesn't apply when a raw DSN is configured, the DSN is used as is
+type TLSConfig struct {
+	Mode       string `json:"mode"`
+	CACert     string `json:"ca-cert"`
+	Cert       string `json:"cert"`
+	Key        string `json:"key"`
+	ServerName string `json:"server-name"`
+}
+
+//Config loads the certificates and builds a tls config that can be used by drivers that don't load certificates
+//themselves. In verify-ca mode the certificate chain is verified but not the host name
+func (t *TLSConfig) Config() (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName: t.ServerName,
+		//the chain is verified by VerifyPeerCertificate in verify-ca mode since crypto/tls always checks the host name
+		InsecureSkipVerify: t.Mode == TLSModeRequire || t.Mode == TLSModeVerifyCA,
+	}
+	if t.CACert != "" {
+		pem, err := ioutil.ReadFile(t.CACert)
+		if err != nil {
+			return nil, NewError(fmt.Sprintf("error reading ca certificate '%s'", t.CACert), err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, NewError(fmt.Sprintf("no certificates found in '%s'", t.CACert), nil)
+		}
+		config.RootCAs = pool
+	}
+	if t.Cert != "" || t.Key != "" {
+		certificate, err := tls.LoadX509KeyPair(t.Cert, t.Key)
+		if err != nil {
+			return nil, NewError("error loading client certificate", err)
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+	if t.Mode == TLSModeVerifyCA {
+		config.VerifyPeerCertificate = verifyCertificateChain(config.RootCAs)
+	}
+	return config, nil
+}
+
+//verifyCertificateChain verifies that the server certificate is signed by one of the roots (or the system roots if
+//there are none) without checking the host name
+func verifyCertificateChain(roots *x509.CertPool) func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return NewError("the server didn't send a certificate", nil)
+		}
+		certificates := make([]*x509.Certificate, len(rawCerts))
+		for i, rawCert := range rawCerts {
+			certificate, err := x509.ParseCertificate(rawCert)
+			if err != nil {
+				return NewError("error parsing the server certificate", err)
+			}
+			certificates[i] = certificate
+		}
+		intermediates := x509.NewCertPool()
+		for _, certificate := range certificates[1:] {
+			intermediates.AddCert(certificate)
+		}
+		if _, err := certificates[0].Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates}); err != nil {
+			return NewError("the server certificate isn't signed by a trusted ca", err)
+		}
+		return nil
+	}
+}
+
+func (t *TLSConfig) hasCertificates() bool {
+	return t.CACert != "" || t.Cert != "" || t.Key != ""
+}
+
+//name is the name the TLS configuration is registered under with drivers that need it (mysql, clickhouse). The
+//registrations are global so the name is unique to the settings so that applications with different settings don't
+//replace each other's configuration
+func (t *TLSConfig) name() string {
+	hash := sha256.Sum256([]byte(strings.Join([]string{t.Mode, t.CACert, t.Cert, t.Key, t.ServerName}, "\x00")))
+	return "weos-" + hex.EncodeToString(hash[:8])
+}
+
+//NewDSN builds the connection string for the database driver. If a raw DSN is configured it's used as is
+func NewDSN(config *DBConfig) (string, error) {
+	if config.DSN != "" {
+		return config.DSN, nil
+	}
+	if config.TLS != nil {
+		switch config.TLS.Mode {
+		case "", TLSModeDisable, TLSModeRequire, TLSModeVerifyCA, TLSModeVerifyFull:
+		default:
+			return "", NewError(fmt.Sprintf("tls mode '%s' is not supported", config.TLS.Mode), nil)
+		}
+	}
+
+	switch config.Driver {
+	case "sqlite3":
+		return sqliteDSN(config), nil
+	case "sqlserver":
+		return sqlserverDSN(config), nil
+	case "ramsql":
+		return "Testing", nil
+	case "mysql":
+		return mysqlDSN(config)
+	case "clickhouse":
+		return clickhouseDSN(config)
+	case "postgres":
+		return postgresDSN(config), nil
+	default:
+		return "", errors.New(fmt.Sprintf("db driver '%s' is not supported ", config.Driver))
+	}
+}
+
+func sqliteDSN(config *DBConfig) string {
+	connStr := config.Database
+	//update connection string to include authentication IF a username is set
+	if config.User != "" {
+		connStr = connStr + fmt.Sprintf("?_auth&_auth_user=%s&_auth_pass=%s&_auth_crypt=sha512&_foreign_keys=on",
+			config.User, config.Password)
+	} else {
+		connStr = connStr + "?_foreign_keys=on"
+	}
+	if len(config.Params) > 0 {
+		connStr = connStr + "&" + queryParams(config.Params).Encode()
+	}
+	return connStr
+}
+
+//postgresDSN builds the connection string for lib/pq. lib/pq verifies the server certificate against the host so if
+//a TLS server name is configured it's used as the host and openDB dials the configured host
+func postgresDSN(config *DBConfig) string {
+	var parts []string
+	add := func(key string, value string) {
+		if value != "" {
+			parts = append(parts, key+"="+quotePostgresValue(value))
+		}
+	}
+	if config.TLS != nil && config.TLS.ServerName != "" {
+		add("host", config.TLS.ServerName)
+	} else {
+		add("host", config.Host)
+	}
+	if config.Port != 0 {
+		add("port", strconv.Itoa(config.Port))
+	}
+	add("user", config.User)
+	add("password", config.Password)
+	add("dbname", config.Database)
+	//tls is disabled unless configured
+	if config.TLS == nil || config.TLS.Mode == "" {
+		add("sslmode", TLSModeDisable)
+	} else {
+		add("sslmode", config.TLS.Mode)
+		add("sslrootcert", config.TLS.CACert)
+		add("sslcert", config.TLS.Cert)
+		add("sslkey", config.TLS.Key)
+	}
+	if config.ConnectTimeout != 0 {
+		add("connect_timeout", strconv.Itoa(config.ConnectTimeout))
+	}
+	for _, key := range sortedKeys(config.Params) {
+		add(key, config.Params[key])
+	}
+	return strings.Join(parts, " ")
+}
+
+//quotePostgresValue quotes values that have spaces or quotes in them https://www.postgresql.org/docs/current/libpq-connect.html#LIBPQ-CONNSTRING
+func quotePostgresValue(value string) string {
+	if !strings.ContainsAny(value, " '\\") {
+		return value
+	}
+	value = strings.Replace(value, "\\", "\\\\", -1)
+	value = strings.Replace(value, "'", "\\'", -1)
+	return "'" + value + "'"
+}
+
+//mysqlDSN builds the connection string with the driver's config so that the credentials and params are formatted the
+//way the driver parses them
+func mysqlDSN(config *DBConfig) (string, error) {
+	mysqlConfig := mysql.NewConfig()
+	mysqlConfig.User = config.User
+	mysqlConfig.Passwd = config.Password
+	mysqlConfig.Net = "tcp"
+	mysqlConfig.Addr = net.JoinHostPort(config.Host, strconv.Itoa(config.Port))
+	mysqlConfig.DBName = config.Database
+	//gorm needs time values to be parsed
+	mysqlConfig.ParseTime = true
+	mysqlConfig.Timeout = time.Duration(config.ConnectTimeout) * time.Second
+	mysqlConfig.ReadTimeout = time.Duration(config.ReadTimeout) * time.Second
+	mysqlConfig.WriteTimeout = time.Duration(config.WriteTimeout) * time.Second
+	if config.TLS != nil && config.TLS.Mode != "" {
+		switch {
+		case config.TLS.Mode == TLSModeDisable:
+			mysqlConfig.TLSConfig = "false"
+		case config.TLS.hasCertificates() || config.TLS.ServerName != "" || config.TLS.Mode == TLSModeVerifyCA:
+			tlsConfig, err := config.TLS.Config()
+			if err != nil {
+				return "", err
+			}
+			if err = mysql.RegisterTLSConfig(config.TLS.name(), tlsConfig); err != nil {
+				return "", err
+			}
+			mysqlConfig.TLSConfig = config.TLS.name()
+		case config.TLS.Mode == TLSModeRequire:
+			mysqlConfig.TLSConfig = "skip-verify"
+		default:
+			mysqlConfig.TLSConfig = "true"
+		}
+	}
+	if len(config.Params) > 0 {
+		mysqlConfig.Params = make(map[string]string, len(config.Params))
+		for key, value := range config.Params {
+			mysqlConfig.Params[key] = value
+		}
+	}
+	return mysqlConfig.FormatDSN(), nil
+}
+
+func sqlserverDSN(config *DBConfig) string {
+	params := url.Values{}
+	params.Set("database", config.Database)
+	if config.ConnectTimeout != 0 {
+		params.Set("dial timeout", strconv.Itoa(config.ConnectTimeout))
+	}
+	if config.TLS != nil && config.TLS.Mode != "" {
+		switch config.TLS.Mode {
+		case TLSModeDisable:
+			params.Set("encrypt", "disable")
+		case TLSModeRequire:
+			params.Set("encrypt", "true")
+			params.Set("TrustServerCertificate", "true")
+		default:
+			params.Set("encrypt", "true")
+			params.Set("TrustServerCertificate", "false")
+			if config.TLS.CACert != "" {
+				params.Set("certificate", config.TLS.CACert)
+			}
+			if config.TLS.ServerName != "" {
+				params.Set("hostNameInCertificate", config.TLS.ServerName)
+			}
+		}
+	}
+	for key, value := range config.Params {
+		params.Set(key, value)
+	}
+	dsn := url.URL{
+		Scheme:   "sqlserver",
+		User:     url.UserPassword(config.User, config.Password),
+		Host:     net.JoinHostPort(config.Host, strconv.Itoa(config.Port)),
+		RawQuery: params.Encode(),
+	}
+	return dsn.String()
+}
+
+func clickhouseDSN(config *DBConfig) (string, error) {
+	params := url.Values{}
+	params.Set("username", config.User)
+	params.Set("password", config.Password)
+	params.Set("database", config.Database)
+	if config.ConnectTimeout != 0 {
+		params.Set("timeout", strconv.Itoa(config.ConnectTimeout))
+	}
+	if config.ReadTimeout != 0 {
+		params.Set("read_timeout", strconv.Itoa(config.ReadTimeout))
+	}
+	if config.WriteTimeout != 0 {
+		params.Set("write_timeout", strconv.Itoa(config.WriteTimeout))
+	}
+	if config.TLS != nil && config.TLS.Mode != "" && config.TLS.Mode != TLSModeDisable {
+		params.Set("secure", "true")
+		if config.TLS.Mode == TLSModeRequire {
+			params.Set("skip_verify", "true")
+		}
+		//the drivers' own verification checks the host name so verify-ca needs the tls config
+		if config.TLS.hasCertificates() || config.TLS.ServerName != "" || config.TLS.Mode == TLSModeVerifyCA {
+			tlsConfig, err := config.TLS.Config()
+			if err != nil {
+				return "", err
+			}
+			if err = clickhouse.RegisterTLSConfig(config.TLS.name(), tlsConfig); err != nil {
+				return "", err
+			}
+			params.Set("tls_config", config.TLS.name())
+		}
+	}
+	for key, value := range config.Params {
+		params.Set(key, value)
+	}
+	return fmt.Sprintf("tcp://%s?%s", net.JoinHostPort(config.Host, strconv.Itoa(config.Port)), params.Encode()), nil
+}
+
+//openDB opens a connection pool for the database. Postgres connections with a TLS server name are dialed to the
+//configured host while lib/pq verifies the certificate against the server name in the connection string
+func openDB(config *DBConfig, dsn string) (*sql.DB, error) {
+	if config.Driver == "postgres" && config.DSN == "" && config.TLS != nil && config.TLS.ServerName != "" {
+		host := config.Host
+		if host == "" {
+			host = "localhost"
+		}
+		port := config.Port
+		if port == 0 {
+			port = 5432
+		}
+		return sql.OpenDB(&postgresConnector{dsn: dsn, address: net.JoinHostPort(host, strconv.Itoa(port))}), nil
+	}
+	return sql.Open(config.Driver, dsn)
+}
+
+//postgresConnector opens lib/pq connections to an address other than the host in the connection string
+type postgresConnector struct {
+	dsn     string
+	address string
+}
+
+func (c *postgresConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return pq.DialOpen(addressDialer{address: c.address}, c.dsn)
+}
+
+func (c *postgresConnector) Driver() driver.Driver {
+	return &pq.Driver{}
+}
+
+//addressDialer dials the address it was created with whatever address is requested
+type addressDialer struct {
+	address string
+}
+
+func (d addressDialer) Dial(network string, address string) (net.Conn, error) {
+	return net.Dial(network, d.address)
+}
+
+func (d addressDialer) DialTimeout(network string, address string, timeout time.Duration) (net.Conn, error) {
+	return net.DialTimeout(network, d.address, timeout)
+}
+
+func (d addressDialer) DialContext(ctx context.Context, network string, address string) (net.Conn, error) {
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, network, d.address)
+}
+
+func queryParams(params map[string]string) url.Values {
+	values := url.Values{}
+	for key, value := range params {
+		values.Set(key, value)
+	}
+	return values
+}
+
+func sortedKeys(params map[string]string) []string {
+	var keys []string
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
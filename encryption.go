@@ -0,0 +1,274 @@
+package weos
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/net/context"
+	"gorm.io/gorm"
+	"io"
+	"time"
+)
+
+//KeyStore holds the keys used to encrypt the personal data of each subject (e.g. a user). Deleting a subject's key
+//makes the data encrypted with it unreadable, which is how personal data is removed from immutable events
+type KeyStore interface {
+	//GetKey returns the key of the subject or nil if there is no key (e.g. the subject was forgotten)
+	GetKey(ctx context.Context, subjectID string) ([]byte, error)
+	//GetOrCreateKey returns the key of the subject, creating one if there isn't one yet
+	GetOrCreateKey(ctx context.Context, subjectID string) ([]byte, error)
+	//DeleteKey destroys the key of the subject
+	DeleteKey(ctx context.Context, subjectID string) error
+}
+
+//EncryptionRule designates the payload fields of an event type that contain personal data
+type EncryptionRule struct {
+	EventType string
+	Fields    []string
+	//SubjectField is the payload field with the id of the subject the data belongs to. The root id of the event is used
+	//if it's empty
+	SubjectField string
+}
+
+//SubjectKey is a key stored by the GormKeyStore
+type SubjectKey struct {
+	SubjectID string `gorm:"primaryKey"`
+	Key       []byte
+	CreatedAt time.Time
+}
+
+func (SubjectKey) TableName() string {
+	return "subject_keys"
+}
+
+//GormKeyStore stores subject keys in a database table. Use a different database from the event store to keep the keys
+//out of event store backups
+type GormKeyStore struct {
+	db     *gorm.DB
+	logger Log
+}
+
+func NewGormKeyStore(db *gorm.DB, logger Log) *GormKeyStore {
+	return &GormKeyStore{db: db, logger: logger}
+}
+
+func (k *GormKeyStore) GetKey(ctx context.Context, subjectID string) ([]byte, error) {
+	var subjectKey SubjectKey
+	result := k.db.WithContext(ctx).Where("subject_id = ?", subjectID).Limit(1).Find(&subjectKey)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	return subjectKey.Key, nil
+}
+
+func (k *GormKeyStore) GetOrCreateKey(ctx context.Context, subjectID string) ([]byte, error) {
+	key, err := k.GetKey(ctx, subjectID)
+	if err != nil || key != nil {
+		return key, err
+	}
+	key = make([]byte, 32)
+	if _, err = io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	if err = k.db.WithContext(ctx).Create(&SubjectKey{SubjectID: subjectID, Key: key}).Error; err != nil {
+		//the key may have been created by another process in the meantime
+		if existing, getErr := k.GetKey(ctx, subjectID); getErr == nil && existing != nil {
+			return existing, nil
+		}
+		return nil, err
+	}
+	return key, nil
+}
+
+func (k *GormKeyStore) DeleteKey(ctx context.Context, subjectID string) error {
+	return k.db.WithContext(ctx).Where("subject_id = ?", subjectID).Delete(&SubjectKey{}).Error
+}
+
+func (k *GormKeyStore) Migrate(ctx context.Context) error {
+	migrator := NewMigrator(k.db, k.logger)
+	if err := migrator.RegisterProvider(k); err != nil {
+		return err
+	}
+	return migrator.Up(ctx)
+}
+
+//subjectKeyV1 is a snapshot of the key table used by the migrations
+type subjectKeyV1 struct {
+	SubjectID string `gorm:"primaryKey"`
+	Key       []byte
+	CreatedAt time.Time
+}
+
+func (subjectKeyV1) TableName() string {
+	return "subject_keys"
+}
+
+//MigrationNamespace is the namespace the key store migrations are tracked under
+func (k *GormKeyStore) MigrationNamespace() string {
+	return "subject_keys"
+}
+
+//Migrations are the versioned changes to the key store schema
+func (k *GormKeyStore) Migrations() []*Migration {
+	return []*Migration{
+		{
+			Version: 1,
+			Name:    "create subject keys table",
+			Up: func(tx *gorm.DB) error {
+				return tx.Migrator().CreateTable(&subjectKeyV1{})
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable("subject_keys")
+			},
+		},
+	}
+}
+
+//encryptedField replaces the value of an encrypted payload field
+type encryptedField struct {
+	Encrypted *encryptedValue `json:"$encrypted,omitempty"`
+}
+
+type encryptedValue struct {
+	Subject string `json:"subject"`
+	Data    []byte `json:"data"`
+}
+
+//encryptPayload encrypts the fields in the rules for the event type with the key of the subject
+func encryptPayload(ctx context.Context, keyStore KeyStore, rules []EncryptionRule, event *Event) (json.RawMessage, error) {
+	var payload map[string]json.RawMessage
+	encrypted := false
+	for _, rule := range rules {
+		if rule.EventType != event.Type {
+			continue
+		}
+		if payload == nil {
+			if err := json.Unmarshal(event.Payload, &payload); err != nil {
+				return nil, NewDomainError("only object payloads can be encrypted", "Event", event.Meta.EntityID, err)
+			}
+		}
+		subjectID := event.Meta.RootID
+		if rule.SubjectField != "" {
+			if err := json.Unmarshal(payload[rule.SubjectField], &subjectID); err != nil || subjectID == "" {
+				return nil, NewDomainError(fmt.Sprintf("subject field '%s' is required to encrypt the event", rule.SubjectField), "Event", event.Meta.EntityID, err)
+			}
+		}
+		key, err := keyStore.GetOrCreateKey(ctx, subjectID)
+		if err != nil {
+			return nil, err
+		}
+		for _, field := range rule.Fields {
+			value, ok := payload[field]
+			if !ok || string(value) == "null" {
+				continue
+			}
+			data, err := seal(key, value, []byte(subjectID+":"+field))
+			if err != nil {
+				return nil, err
+			}
+			if payload[field], err = json.Marshal(&encryptedField{Encrypted: &encryptedValue{Subject: subjectID, Data: data}}); err != nil {
+				return nil, err
+			}
+			encrypted = true
+		}
+	}
+	if !encrypted {
+		return event.Payload, nil
+	}
+	return json.Marshal(payload)
+}
+
+//decryptPayload decrypts the fields in the rules for the event type. Fields of subjects that have been forgotten are
+//null. Other fields are left as they are even if they look like encrypted fields
+func decryptPayload(ctx context.Context, keyStore KeyStore, rules []EncryptionRule, event *Event, keys map[string][]byte) (json.RawMessage, error) {
+	var names []string
+	for _, rule := range rules {
+		if rule.EventType == event.Type {
+			names = append(names, rule.Fields...)
+		}
+	}
+	if len(names) == 0 {
+		return event.Payload, nil
+	}
+	var fields map[string]json.RawMessage
+	//only object payloads can have encrypted fields
+	if err := json.Unmarshal(event.Payload, &fields); err != nil {
+		return event.Payload, nil
+	}
+	decrypted := false
+	for _, name := range names {
+		value := fields[name]
+		var field encryptedField
+		if len(value) == 0 || value[0] != '{' || json.Unmarshal(value, &field) != nil || field.Encrypted == nil {
+			continue
+		}
+		key, ok := keys[field.Encrypted.Subject]
+		if !ok {
+			var err error
+			if key, err = keyStore.GetKey(ctx, field.Encrypted.Subject); err != nil {
+				return nil, err
+			}
+			keys[field.Encrypted.Subject] = key
+		}
+		fields[name] = json.RawMessage("null")
+		if key != nil {
+			plaintext, err := open(key, field.Encrypted.Data, []byte(field.Encrypted.Subject+":"+name))
+			if err != nil {
+				return nil, NewError(fmt.Sprintf("error decrypting field '%s'", name), err)
+			}
+			fields[name] = plaintext
+		}
+		decrypted = true
+	}
+	if !decrypted {
+		return event.Payload, nil
+	}
+	return json.Marshal(fields)
+}
+
+//DeriveKey derives a key for one purpose (e.g. "jwt") from the application secret so that a key used for one purpose
+//can't be used for another (e.g. a session id signature can't be used as a token signature)
+func DeriveKey(secret string, purpose string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("weos:" + purpose))
+	return mac.Sum(nil)
+}
+
+func seal(key []byte, plaintext []byte, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func open(key []byte, data []byte, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("encrypted data is too short")
+	}
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], additionalData)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
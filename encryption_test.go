@@ -0,0 +1,192 @@
+package weos_test
+
+import (
+	"bytes"
+	"encoding/json"
+	log "github.com/sirupsen/logrus"
+	"github.com/wepala/weos"
+	"golang.org/x/net/context"
+	"strings"
+	"testing"
+)
+
+func TestEventRepositoryGorm_Encryption(t *testing.T) {
+	db := newMigrationTestDB(t)
+	keyDB := newMigrationTestDB(t)
+	repository, err := weos.NewBasicEventRepository(db, log.New(), false, "", "")
+	if err != nil {
+		t.Fatalf("unexpected error creating repository '%s'", err)
+	}
+	eventRepository := repository.(*weos.EventRepositoryGorm)
+	keyStore := &contextKeyStore{KeyStore: weos.NewGormKeyStore(keyDB, log.New())}
+	eventRepository.SetEncryption(keyStore, weos.EncryptionRule{
+		EventType: "USER_CREATED",
+		Fields:    []string{"email", "name"},
+	}, weos.EncryptionRule{
+		EventType:    "COMMENT_CREATED",
+		Fields:       []string{"author"},
+		SubjectField: "userId",
+	})
+	if err = repository.Migrate(context.TODO()); err != nil {
+		t.Fatalf("unexpected error migrating repository '%s'", err)
+	}
+	if !keyDB.Migrator().HasTable(&weos.SubjectKey{}) {
+		t.Error("expected the keys to be migrated in the key store database")
+	}
+	if db.Migrator().HasTable(&weos.SubjectKey{}) {
+		t.Error("expected the keys not to be migrated in the event store database")
+	}
+	var dispatched []weos.Event
+	repository.AddSubscriber(func(ctx context.Context, event weos.Event) {
+		dispatched = append(dispatched, event)
+	})
+
+	user := &weos.AggregateRoot{BasicEntity: weos.BasicEntity{ID: "user1"}}
+	user.NewChange(weos.NewEntityEvent("USER_CREATED", user, user.ID, map[string]interface{}{
+		"email": "jane@example.com",
+		"name":  "Jane",
+		"role":  "admin",
+	}))
+	post := &weos.AggregateRoot{BasicEntity: weos.BasicEntity{ID: "post1"}}
+	post.NewChange(weos.NewEntityEvent("COMMENT_CREATED", post, post.ID, map[string]interface{}{
+		"userId": "user1",
+		"author": "Jane",
+		"body":   "Nice post",
+	}))
+	for _, entity := range []*weos.AggregateRoot{user, post} {
+		if err = repository.Persist(context.WithValue(context.TODO(), weos.ACCOUNT_ID, "account1"), entity); err != nil {
+			t.Fatalf("unexpected error persisting events '%s'", err)
+		}
+	}
+
+	if !strings.Contains(string(dispatched[0].Payload), "jane@example.com") {
+		t.Errorf("expected subscribers to receive the unencrypted payload, got '%s'", dispatched[0].Payload)
+	}
+	var stored weos.GormEvent
+	db.Where("type = ?", "USER_CREATED").First(&stored)
+	if strings.Contains(string(stored.Payload), "jane@example.com") || strings.Contains(string(stored.Payload), "Jane") {
+		t.Errorf("expected the personal data to be encrypted in the store, got '%s'", stored.Payload)
+	}
+	if !strings.Contains(string(stored.Payload), "admin") {
+		t.Errorf("expected fields without personal data to be stored as is, got '%s'", stored.Payload)
+	}
+
+	payload := func(t *testing.T, rootID string) map[string]interface{} {
+		events, err := repository.GetByAggregate(rootID)
+		if err != nil {
+			t.Fatalf("unexpected error getting events '%s'", err)
+		}
+		if len(events) != 1 {
+			t.Fatalf("expected %d event, got %d", 1, len(events))
+		}
+		var payload map[string]interface{}
+		if err = json.Unmarshal(events[0].Payload, &payload); err != nil {
+			t.Fatalf("unexpected error unmarshalling payload '%s'", err)
+		}
+		return payload
+	}
+
+	t.Run("fields are decrypted on read", func(t *testing.T) {
+		if payload := payload(t, "user1"); payload["email"] != "jane@example.com" || payload["name"] != "Jane" {
+			t.Errorf("expected the personal data to be decrypted, got '%v'", payload)
+		}
+		if payload := payload(t, "post1"); payload["author"] != "Jane" {
+			t.Errorf("expected the personal data to be decrypted, got '%v'", payload)
+		}
+	})
+
+	t.Run("keys are read with the context of the repository", func(t *testing.T) {
+		ctx := context.WithValue(context.WithValue(context.TODO(), weos.ACCOUNT_ID, "account1"), weos.REQUEST_ID, "request-1")
+		scoped, err := eventRepository.WithContext(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error scoping repository '%s'", err)
+		}
+		if _, err = scoped.GetByAggregate("user1"); err != nil {
+			t.Fatalf("unexpected error getting events '%s'", err)
+		}
+		if keyStore.requestID != "request-1" {
+			t.Errorf("expected the key to be read with the request '%s', got '%s'", "request-1", keyStore.requestID)
+		}
+	})
+
+	t.Run("only the fields in the rules are decrypted", func(t *testing.T) {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(stored.Payload, &fields); err != nil {
+			t.Fatalf("unexpected error unmarshalling payload '%s'", err)
+		}
+		note := &weos.AggregateRoot{BasicEntity: weos.BasicEntity{ID: "note1"}}
+		note.NewChange(weos.NewEntityEvent("NOTE_CREATED", note, note.ID, map[string]interface{}{
+			"email": fields["email"],
+		}))
+		if err := repository.Persist(context.TODO(), note); err != nil {
+			t.Fatalf("unexpected error persisting events '%s'", err)
+		}
+		if email, ok := payload(t, "note1")["email"].(map[string]interface{}); !ok || email["$encrypted"] == nil {
+			t.Errorf("expected a field that isn't in the rules to be left as is, got '%v'", email)
+		}
+	})
+
+	t.Run("exports keep fields encrypted", func(t *testing.T) {
+		buffer := &bytes.Buffer{}
+		if _, err := eventRepository.Export(context.TODO(), buffer, weos.EventFilter{}); err != nil {
+			t.Fatalf("unexpected error exporting events '%s'", err)
+		}
+		if strings.Contains(buffer.String(), "jane@example.com") {
+			t.Errorf("expected the export to keep the personal data encrypted, got '%s'", buffer.String())
+		}
+	})
+
+	t.Run("forgotten subjects can't be read", func(t *testing.T) {
+		if err := eventRepository.ForgetSubject(context.TODO(), "user1"); err != nil {
+			t.Fatalf("unexpected error forgetting subject '%s'", err)
+		}
+		userPayload := payload(t, "user1")
+		if userPayload["email"] != nil || userPayload["name"] != nil {
+			t.Errorf("expected the personal data to be unreadable, got '%v'", userPayload)
+		}
+		if userPayload["role"] != "admin" {
+			t.Errorf("expected fields without personal data to be readable, got '%v'", userPayload)
+		}
+		commentPayload := payload(t, "post1")
+		if commentPayload["author"] != nil || commentPayload["body"] != "Nice post" {
+			t.Errorf("expected only the personal data of the subject to be unreadable, got '%v'", commentPayload)
+		}
+	})
+
+	t.Run("subject field is required", func(t *testing.T) {
+		post := &weos.AggregateRoot{BasicEntity: weos.BasicEntity{ID: "post2"}}
+		post.NewChange(weos.NewEntityEvent("COMMENT_CREATED", post, post.ID, map[string]interface{}{
+			"author": "Jane",
+		}))
+		if err := repository.Persist(context.TODO(), post); err == nil {
+			t.Error("expected an error persisting an event without the subject")
+		}
+	})
+}
+
+//contextKeyStore records the request of the context keys are read with
+type contextKeyStore struct {
+	weos.KeyStore
+	requestID string
+}
+
+func (k *contextKeyStore) GetKey(ctx context.Context, subjectID string) ([]byte, error) {
+	k.requestID = weos.GetRequestID(ctx)
+	return k.KeyStore.GetKey(ctx, subjectID)
+}
+
+func (k *contextKeyStore) Migrate(ctx context.Context) error {
+	return k.KeyStore.(*weos.GormKeyStore).Migrate(ctx)
+}
+
+func TestDeriveKey(t *testing.T) {
+	if !bytes.Equal(weos.DeriveKey("secret", "jwt"), weos.DeriveKey("secret", "jwt")) {
+		t.Error("expected the same key for the same secret and purpose")
+	}
+	if bytes.Equal(weos.DeriveKey("secret", "jwt"), weos.DeriveKey("secret", "session")) {
+		t.Error("expected different keys for different purposes")
+	}
+	if bytes.Equal(weos.DeriveKey("secret", "jwt"), []byte("secret")) {
+		t.Error("expected the key not to be the secret")
+	}
+}
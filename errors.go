@@ -1,9 +1,31 @@
 package weos
 
+import (
+	"encoding/json"
+	"errors"
+	"golang.org/x/net/context"
+	"net/http"
+)
+
+//ErrorCategory groups errors by how the caller should handle them (e.g. fix the request or retry later)
+type ErrorCategory string
+
+const (
+	ErrorCategoryValidation   ErrorCategory = "validation"
+	ErrorCategoryNotFound     ErrorCategory = "not_found"
+	ErrorCategoryConflict     ErrorCategory = "conflict"
+	ErrorCategoryUnauthorized ErrorCategory = "unauthorized"
+	ErrorCategoryForbidden    ErrorCategory = "forbidden"
+	ErrorCategoryInternal     ErrorCategory = "internal"
+)
+
 //goland:noinspection GoNameStartsWithPackageName
 type WeOSError struct {
-	message     string
-	err         error
+	message string
+	err     error
+	//Code identifies the error so that clients can handle it without parsing the message e.g. "post_not_found"
+	Code        string
+	Category    ErrorCategory
 	Application string
 	AccountID   string
 }
@@ -16,10 +38,64 @@ func (e *WeOSError) Unwrap() error {
 	return e.err
 }
 
+//ErrorCategory is the category of the error. Errors without a category are internal errors
+func (e *WeOSError) ErrorCategory() ErrorCategory {
+	if e.Category == "" {
+		return ErrorCategoryInternal
+	}
+	return e.Category
+}
+
+//SetCode sets the code and category of the error
+func (e *WeOSError) SetCode(code string, category ErrorCategory) {
+	e.Code = code
+	e.Category = category
+}
+
+func (e *WeOSError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(e.jsonFields())
+}
+
+func (e *WeOSError) jsonFields() map[string]interface{} {
+	fields := map[string]interface{}{
+		"message":  e.message,
+		"category": e.ErrorCategory(),
+	}
+	if e.Code != "" {
+		fields["code"] = e.Code
+	}
+	if e.Application != "" {
+		fields["application"] = e.Application
+	}
+	if e.AccountID != "" {
+		fields["accountId"] = e.AccountID
+	}
+	if e.err != nil {
+		fields["cause"] = errorJSON(e.err)
+	}
+	return fields
+}
+
 type DomainError struct {
 	*WeOSError
 	EntityID   string
 	EntityType string
+	//Field is the field of the entity that is invalid (if the error is about a specific field)
+	Field string
+}
+
+func (e *DomainError) MarshalJSON() ([]byte, error) {
+	fields := e.WeOSError.jsonFields()
+	if e.EntityID != "" {
+		fields["entityId"] = e.EntityID
+	}
+	if e.EntityType != "" {
+		fields["entityType"] = e.EntityType
+	}
+	if e.Field != "" {
+		fields["field"] = e.Field
+	}
+	return json.Marshal(fields)
 }
 
 func NewError(message string, err error) *WeOSError {
@@ -36,3 +112,113 @@ func NewDomainError(message string, entityType string, entityID string, err erro
 		EntityType: entityType,
 	}
 }
+
+//NewErrorWithContext creates an error for the application and account in the context
+func NewErrorWithContext(ctx context.Context, message string, err error) *WeOSError {
+	weosError := NewError(message, err)
+	weosError.Application = GetModuleID(ctx)
+	weosError.AccountID = ContextAccount(ctx)
+	return weosError
+}
+
+//NewDomainErrorWithContext creates a domain error for the application and account in the context
+func NewDomainErrorWithContext(ctx context.Context, message string, entityType string, entityID string, err error) *DomainError {
+	return &DomainError{
+		WeOSError:  NewErrorWithContext(ctx, message, err),
+		EntityID:   entityID,
+		EntityType: entityType,
+	}
+}
+
+//NewValidationError is returned when a request is invalid and shouldn't be retried without changes
+func NewValidationError(ctx context.Context, code string, message string, err error) *WeOSError {
+	return newCodedError(ctx, ErrorCategoryValidation, code, message, err)
+}
+
+//NewNotFoundError is returned when the entity (or handler) that was requested doesn't exist
+func NewNotFoundError(ctx context.Context, code string, message string, err error) *WeOSError {
+	return newCodedError(ctx, ErrorCategoryNotFound, code, message, err)
+}
+
+//NewConflictError is returned when a request conflicts with the current state e.g. a duplicate or a concurrent change
+func NewConflictError(ctx context.Context, code string, message string, err error) *WeOSError {
+	return newCodedError(ctx, ErrorCategoryConflict, code, message, err)
+}
+
+//NewUnauthorizedError is returned when the user or account isn't allowed to make the request
+func NewUnauthorizedError(ctx context.Context, code string, message string, err error) *WeOSError {
+	return newCodedError(ctx, ErrorCategoryUnauthorized, code, message, err)
+}
+
+//NewForbiddenError is returned when the user is known but isn't allowed to perform the action on the entity
+func NewForbiddenError(ctx context.Context, message string, entityType string, entityID string) *DomainError {
+	err := NewDomainErrorWithContext(ctx, message, entityType, entityID, nil)
+	err.SetCode("forbidden", ErrorCategoryForbidden)
+	return err
+}
+
+//NewInternalError is returned when the request failed because of a problem in the application
+func NewInternalError(ctx context.Context, code string, message string, err error) *WeOSError {
+	return newCodedError(ctx, ErrorCategoryInternal, code, message, err)
+}
+
+func newCodedError(ctx context.Context, category ErrorCategory, code string, message string, err error) *WeOSError {
+	weosError := NewErrorWithContext(ctx, message, err)
+	weosError.SetCode(code, category)
+	return weosError
+}
+
+func newFieldError(message string, entityType string, entityID string, field string) *DomainError {
+	err := NewDomainError(message, entityType, entityID, nil)
+	err.SetCode("invalid_field", ErrorCategoryValidation)
+	err.Field = field
+	return err
+}
+
+//GetErrorCategory returns the category of the first error in the chain that has one. Errors that weren't categorized
+//(e.g. database errors) are internal errors
+func GetErrorCategory(err error) ErrorCategory {
+	for ; err != nil; err = errors.Unwrap(err) {
+		if weosError, ok := err.(interface{ categorized() bool }); ok && !weosError.categorized() {
+			continue
+		}
+		if categorized, ok := err.(interface{ ErrorCategory() ErrorCategory }); ok {
+			return categorized.ErrorCategory()
+		}
+	}
+	return ErrorCategoryInternal
+}
+
+//categorized is whether a category was set on the error rather than defaulting to internal
+func (e *WeOSError) categorized() bool {
+	return e.Category != ""
+}
+
+//HTTPStatus is the HTTP status code for the category of the error
+func HTTPStatus(err error) int {
+	if err == nil {
+		return http.StatusOK
+	}
+	switch GetErrorCategory(err) {
+	case ErrorCategoryValidation:
+		return http.StatusBadRequest
+	case ErrorCategoryNotFound:
+		return http.StatusNotFound
+	case ErrorCategoryConflict:
+		return http.StatusConflict
+	case ErrorCategoryUnauthorized:
+		return http.StatusUnauthorized
+	case ErrorCategoryForbidden:
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+//errorJSON is the error as a value that can be marshalled. Errors other than WeOS errors only have a message
+func errorJSON(err error) interface{} {
+	if _, ok := err.(json.Marshaler); ok {
+		return err
+	}
+	return map[string]interface{}{"message": err.Error()}
+}
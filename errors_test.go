@@ -1,8 +1,12 @@
 package weos_test
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/wepala/weos"
+	"golang.org/x/net/context"
+	"net/http"
 	"testing"
 )
 
@@ -16,3 +20,60 @@ func TestErrorFactory_NewDomainError(t *testing.T) {
 		t.Errorf("expected the error to be %s, got %s", "some domain error", err.Error())
 	}
 }
+
+func TestErrorFactory_NewErrorWithContext(t *testing.T) {
+	ctx := context.WithValue(context.TODO(), weos.MODULE_ID, "blog")
+	ctx = context.WithValue(ctx, weos.ACCOUNT_ID, "account-1")
+	err := weos.NewNotFoundError(ctx, "post_not_found", "post not found", nil)
+	if err.Application != "blog" {
+		t.Errorf("expected the application to be '%s', got '%s'", "blog", err.Application)
+	}
+	if err.AccountID != "account-1" {
+		t.Errorf("expected the account to be '%s', got '%s'", "account-1", err.AccountID)
+	}
+	if err.Code != "post_not_found" {
+		t.Errorf("expected the code to be '%s', got '%s'", "post_not_found", err.Code)
+	}
+	domainError := weos.NewDomainErrorWithContext(ctx, "invalid post", "Post", "1", nil)
+	if domainError.Application != "blog" || domainError.AccountID != "account-1" {
+		t.Errorf("expected the domain error to have the application and account from the context, got '%s' and '%s'", domainError.Application, domainError.AccountID)
+	}
+}
+
+func TestHTTPStatus(t *testing.T) {
+	ctx := context.TODO()
+	tests := []struct {
+		err    error
+		status int
+	}{
+		{weos.NewValidationError(ctx, "invalid", "invalid", nil), http.StatusBadRequest},
+		{weos.NewNotFoundError(ctx, "not_found", "not found", nil), http.StatusNotFound},
+		{weos.NewConflictError(ctx, "conflict", "conflict", nil), http.StatusConflict},
+		{weos.NewUnauthorizedError(ctx, "unauthorized", "unauthorized", nil), http.StatusUnauthorized},
+		{weos.NewInternalError(ctx, "internal", "internal", nil), http.StatusInternalServerError},
+		{errors.New("some error"), http.StatusInternalServerError},
+		//the category of a wrapped error is used if the error doesn't have one
+		{weos.NewError("error dispatching", weos.NewNotFoundError(ctx, "not_found", "not found", nil)), http.StatusNotFound},
+		{fmt.Errorf("wrapped: %w", weos.NewConflictError(ctx, "conflict", "conflict", nil)), http.StatusConflict},
+	}
+	for _, test := range tests {
+		if status := weos.HTTPStatus(test.err); status != test.status {
+			t.Errorf("expected the status of '%s' to be %d, got %d", test.err, test.status, status)
+		}
+	}
+}
+
+func TestDomainError_MarshalJSON(t *testing.T) {
+	ctx := context.WithValue(context.TODO(), weos.ACCOUNT_ID, "account-1")
+	cause := weos.NewValidationError(ctx, "invalid_title", "title is required", errors.New("empty string"))
+	err := weos.NewDomainErrorWithContext(ctx, "invalid post", "Post", "1", cause)
+	err.SetCode("invalid_post", weos.ErrorCategoryValidation)
+	data, marshalErr := json.Marshal(err)
+	if marshalErr != nil {
+		t.Fatalf("unexpected error marshalling error '%s'", marshalErr)
+	}
+	expected := `{"accountId":"account-1","category":"validation","cause":{"accountId":"account-1","category":"validation","cause":{"message":"empty string"},"code":"invalid_title","message":"title is required"},"code":"invalid_post","entityId":"1","entityType":"Post","message":"invalid post"}`
+	if string(data) != expected {
+		t.Errorf("expected the json to be %s, got %s", expected, data)
+	}
+}
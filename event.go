@@ -2,7 +2,7 @@ package weos
 
 import (
 	"encoding/json"
-	"github.com/segmentio/ksuid"
+	"golang.org/x/net/context"
 	"time"
 )
 
@@ -18,19 +18,26 @@ type Event struct {
 //NewBasicEvent Create a basic event
 //Deprecated: 08/12/2021 This factory doesn't take into account the Aggregate root which was just introduced. Use NewEntityEvent instead
 func NewBasicEvent(eventType string, entityID string, entityType string, payload interface{}) (*Event, error) {
+	return NewBasicEventWithContext(context.Background(), eventType, entityID, entityType, payload)
+}
+
+//NewBasicEventWithContext Create a basic event with the id and creation time from the clock and id generator in the
+//context
+//Deprecated: 08/12/2021 This factory doesn't take into account the Aggregate root which was just introduced. Use NewEntityEventWithContext instead
+func NewBasicEventWithContext(ctx context.Context, eventType string, entityID string, entityType string, payload interface{}) (*Event, error) {
 	payloadBytes, err := json.Marshal(payload)
 	if err != nil {
 		return nil, NewDomainError("Unable to marshal event payload", eventType, entityID, err)
 	}
 	return &Event{
-		ID:      ksuid.New().String(),
+		ID:      GetIDGenerator(ctx).NewID(),
 		Type:    eventType,
 		Payload: payloadBytes,
 		Version: 1,
 		Meta: EventMeta{
 			EntityID:   entityID,
 			EntityType: entityType,
-			Created:    time.Now().Format(time.RFC3339Nano),
+			Created:    GetClock(ctx).Now().Format(time.RFC3339Nano),
 		},
 	}, nil
 }
@@ -38,64 +45,95 @@ func NewBasicEvent(eventType string, entityID string, entityType string, payload
 //NewAggregateEvent generates an event on a root aggregate.
 //Deprecated: 08/12/2021 This factory doesn't take into account the Aggregate root which was just introduced. Use NewEntityEvent instead
 func NewAggregateEvent(eventType string, entity Entity, payload interface{}) *Event {
+	return NewAggregateEventWithContext(context.Background(), eventType, entity, payload)
+}
+
+//NewAggregateEventWithContext generates an event on a root aggregate with the id and creation time from the clock and
+//id generator in the context
+//Deprecated: 08/12/2021 This factory doesn't take into account the Aggregate root which was just introduced. Use NewEntityEventWithContext instead
+func NewAggregateEventWithContext(ctx context.Context, eventType string, entity Entity, payload interface{}) *Event {
 	payloadBytes, _ := json.Marshal(payload)
 	return &Event{
-		ID:      ksuid.New().String(),
+		ID:      GetIDGenerator(ctx).NewID(),
 		Type:    eventType,
 		Payload: payloadBytes,
 		Version: 1,
 		Meta: EventMeta{
 			EntityID:   entity.GetID(),
 			EntityType: GetType(entity),
-			Created:    time.Now().Format(time.RFC3339Nano),
+			Created:    GetClock(ctx).Now().Format(time.RFC3339Nano),
 		},
 	}
 }
 
 //NewEntityEvent Creates an event for an entity within a root aggregate.
-//The rootID is passed in (as opposed to the root entity) to improve developer experience
+//The rootID is passed in (as opposed to the root entity) to improve developer experience. The id and creation time come
+//from the DefaultClock and DefaultIDGenerator, use NewEntityEventWithContext in handlers so that the clock and id
+//generator of the application are used
 func NewEntityEvent(eventType string, entity Entity, rootID string, payload interface{}) *Event {
+	return NewEntityEventWithContext(context.Background(), eventType, entity, rootID, payload)
+}
+
+//NewEntityEventWithContext Creates an event for an entity within a root aggregate and fills in the metadata (e.g. the
+//user, account, correlation, causation and request ids) from the context. The id and creation time come from the clock
+//and id generator in the context
+func NewEntityEventWithContext(ctx context.Context, eventType string, entity Entity, rootID string, payload interface{}) *Event {
 	payloadBytes, _ := json.Marshal(payload)
 	return &Event{
-		ID:      ksuid.New().String(),
+		ID:      GetIDGenerator(ctx).NewID(),
 		Type:    eventType,
 		Payload: payloadBytes,
 		Version: 1,
 		Meta: EventMeta{
-			EntityID:   entity.GetID(),
-			EntityType: GetType(entity),
-			RootID:     rootID,
-			Created:    time.Now().Format(time.RFC3339Nano),
+			EntityID:      entity.GetID(),
+			EntityType:    GetType(entity),
+			RootID:        rootID,
+			User:          ContextUser(ctx),
+			AccountID:     ContextAccount(ctx),
+			CorrelationID: GetCorrelationID(ctx),
+			CausationID:   GetCausationID(ctx),
+			RequestID:     GetRequestID(ctx),
+			Created:       GetClock(ctx).Now().Format(time.RFC3339Nano),
 		},
 	}
 }
 
 var NewVersionEvent = func(eventType string, entityID string, payload interface{}, version int) (*Event, error) {
+	return NewVersionEventWithContext(context.Background(), eventType, entityID, payload, version)
+}
+
+//NewVersionEventWithContext creates an event with a payload version. The id and creation time come from the clock and
+//id generator in the context
+var NewVersionEventWithContext = func(ctx context.Context, eventType string, entityID string, payload interface{}, version int) (*Event, error) {
 	payloadBytes, err := json.Marshal(payload)
 	if err != nil {
 		return nil, NewDomainError("Unable to marshal event payload", eventType, entityID, err)
 	}
 	return &Event{
-		ID:      ksuid.New().String(),
+		ID:      GetIDGenerator(ctx).NewID(),
 		Type:    eventType,
 		Payload: payloadBytes,
 		Version: version,
 		Meta: EventMeta{
 			EntityID: entityID,
-			Created:  time.Now().Format(time.RFC3339Nano),
+			Created:  GetClock(ctx).Now().Format(time.RFC3339Nano),
 		},
 	}, nil
 }
 
 type EventMeta struct {
-	EntityID   string `json:"entity_id"`
-	EntityType string `json:"entity_type"`
-	SequenceNo int64  `json:"sequence_no"`
-	User       string `json:"user"`
-	Module     string `json:"module"`
-	RootID     string `json:"root_id"`
-	Group      string `json:"group"`
-	Created    string `json:"created"`
+	EntityID      string `json:"entity_id"`
+	EntityType    string `json:"entity_type"`
+	SequenceNo    int64  `json:"sequence_no"`
+	User          string `json:"user"`
+	Module        string `json:"module"`
+	RootID        string `json:"root_id"`
+	AccountID     string `json:"account_id"`
+	Group         string `json:"group"`
+	CorrelationID string `json:"correlation_id"`
+	CausationID   string `json:"causation_id"`
+	RequestID     string `json:"request_id"`
+	Created       string `json:"created"`
 }
 
 func (e *Event) IsValid() bool {
@@ -1,14 +1,23 @@
 package weos
 
 import (
+	"errors"
 	"golang.org/x/net/context"
 	"sync"
+	"time"
 )
 
 type EventDisptacher struct {
-	handlers        []EventHandler
-	handlerPanicked bool
-	dispatch        sync.Mutex
+	handlers []EventHandler
+	health   handlerHealth
+	dispatch sync.Mutex
+	Metrics  *Metrics
+	Tracer   *Tracer
+	//Clock is used to record when handlers panic and to check if the panics are within the PanicWindow
+	Clock Clock
+	//PanicWindow is how long the dispatcher is unhealthy after a handler panics. If it's 0 the dispatcher is unhealthy
+	//until ResetHealth is called
+	PanicWindow time.Duration
 }
 
 func (e *EventDisptacher) Dispatch(ctx context.Context, event Event) {
@@ -16,17 +25,32 @@ func (e *EventDisptacher) Dispatch(ctx context.Context, event Event) {
 	e.dispatch.Lock()
 	defer e.dispatch.Unlock()
 	var wg sync.WaitGroup
+	e.Metrics.eventDispatched(event.Type)
+	//commands dispatched by the handlers are caused by this event
+	ctx = context.WithValue(ctx, CAUSATION_ID, event.ID)
+	if event.Meta.CorrelationID != "" {
+		ctx = context.WithValue(ctx, CORRELATION_ID, event.Meta.CorrelationID)
+	}
 	for i := 0; i < len(e.handlers); i++ {
 		handler := e.handlers[i]
 		wg.Add(1)
 		go func() {
+			start := time.Now()
+			handlerCtx, span := e.Tracer.StartSpan(ctx, "event.handler")
+			span.SetAttribute("event.type", event.Type)
+			span.SetAttribute("event.id", event.ID)
+			panicked := false
 			defer func() {
 				if r := recover(); r != nil {
-					e.handlerPanicked = true
+					e.health.panicked(e.now())
+					panicked = true
+					span.SetError(errors.New("event handler panicked"))
 				}
+				e.Metrics.observeEventHandler(event.Type, time.Since(start), panicked)
+				span.Finish()
 				wg.Done()
 			}()
-			handler(ctx, event)
+			handler(handlerCtx, event)
 		}()
 	}
 
@@ -41,4 +65,22 @@ func (e *EventDisptacher) GetSubscribers() []EventHandler {
 	return e.handlers
 }
 
+//HealthCheck returns an error if any of the event handlers have panicked (within the PanicWindow). It doesn't wait for
+//events that are being dispatched
+func (e *EventDisptacher) HealthCheck(ctx context.Context) error {
+	return e.health.check("event handlers panicked", e.now(), e.PanicWindow)
+}
+
+//ResetHealth marks the dispatcher as healthy again e.g. after the handler that panicked was fixed
+func (e *EventDisptacher) ResetHealth() {
+	e.health.reset()
+}
+
+func (e *EventDisptacher) now() time.Time {
+	if e.Clock == nil {
+		return DefaultClock.Now()
+	}
+	return e.Clock.Now()
+}
+
 type EventHandler func(ctx context.Context, event Event)
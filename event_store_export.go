@@ -0,0 +1,136 @@
+package weos
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"encoding/json"
+	"fmt"
+	"golang.org/x/net/context"
+	"gorm.io/gorm"
+	"io"
+	"time"
+)
+
+//exportedEvent is an event in an export. The hashes of the hash chain are exported so that changes to the file are
+//found when it's imported
+type exportedEvent struct {
+	*Event
+	Hash         string `json:"hash,omitempty"`
+	PreviousHash string `json:"previous_hash,omitempty"`
+}
+
+//Export writes the events that match the filter to the writer as newline delimited JSON (one Event per line with its
+//hashes). This makes it possible to backup the event store and copy it between databases that use different drivers.
+//The events are read a page at a time
+func (e *EventRepositoryGorm) Export(ctx context.Context, w io.Writer, filter EventFilter) (int, error) {
+	buffered := bufio.NewWriter(w)
+	encoder := json.NewEncoder(buffered)
+	//the hashes of the events in the current page
+	var hashes map[string]GormEvent
+	get := func(filter EventFilter) ([]*Event, error) {
+		var gormEvents []GormEvent
+		if err := e.filtered(filter).WithContext(ctx).Find(&gormEvents).Error; err != nil {
+			return nil, err
+		}
+		hashes = make(map[string]GormEvent, len(gormEvents))
+		for _, gormEvent := range gormEvents {
+			hashes[gormEvent.ID] = GormEvent{Hash: gormEvent.Hash, PreviousHash: gormEvent.PreviousHash}
+		}
+		return NewEventsFromGorm(gormEvents), nil
+	}
+	exported, err := eachEvent(filter, DefaultEventPageSize, get, func(event *Event) error {
+		//the version isn't stored so events are exported as the first version
+		if event.Version == 0 {
+			event.Version = 1
+		}
+		return encoder.Encode(exportedEvent{Event: event, Hash: hashes[event.ID].Hash, PreviousHash: hashes[event.ID].PreviousHash})
+	})
+	if err != nil {
+		return exported, err
+	}
+	return exported, buffered.Flush()
+}
+
+//Import reads newline delimited JSON events (e.g. from Export) and stores them as is. The ids, sequence numbers and
+//creation dates are preserved and events that are already in the store are skipped so that an import can be re-run.
+//The events are not dispatched to subscribers, replay projections after an import to update them. If the hash chain is
+//enabled the events with hashes are added to the chain of their root and their hashes are checked so that an edited
+//export is rejected (the export has to come from a store with the same hash secret). Events without hashes are
+//imported as events from before the chain was enabled and can't follow an event with a hash. Like Persist the import
+//only keeps the chain linear for writers in this process
+func (e *EventRepositoryGorm) Import(ctx context.Context, r io.Reader) (int, error) {
+	if e.hashChain {
+		e.chainMutex.Lock()
+		defer e.chainMutex.Unlock()
+	}
+	decoder := json.NewDecoder(r)
+	imported := 0
+	previousHashes := make(map[string]string)
+	err := e.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for line := 1; ; line++ {
+			event := &Event{}
+			exported := exportedEvent{Event: event}
+			err := decoder.Decode(&exported)
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return NewError(fmt.Sprintf("error reading event on line %d", line), err)
+			}
+			if !event.IsValid() {
+				return NewDomainError(fmt.Sprintf("invalid event '%s' on line %d", event.ID, line), "Event", event.Meta.EntityID, event.GetErrors()[0])
+			}
+			if event.Meta.AccountID == "" {
+				event.Meta.AccountID = e.AccountID
+			}
+			if e.AccountID != "" && event.Meta.AccountID != e.AccountID {
+				return NewDomainError(fmt.Sprintf("event '%s' on line %d belongs to another account", event.ID, line), "Event", event.Meta.EntityID, nil)
+			}
+
+			var existing int64
+			if result := tx.Model(&GormEvent{}).Where("id = ?", event.ID).Count(&existing); result.Error != nil {
+				return result.Error
+			}
+			if existing > 0 {
+				continue
+			}
+
+			gormEvent, err := NewGormEvent(event)
+			if err != nil {
+				return err
+			}
+			if event.Meta.Created != "" {
+				created, err := time.Parse(time.RFC3339Nano, event.Meta.Created)
+				if err != nil {
+					return NewDomainError(fmt.Sprintf("invalid created date for event '%s' on line %d", event.ID, line), "Event", event.Meta.EntityID, err)
+				}
+				gormEvent.CreatedAt = created
+				gormEvent.UpdatedAt = created
+			}
+			if e.hashChain && exported.Hash == "" {
+				previousHash, err := e.previousHash(tx, &gormEvent, previousHashes)
+				if err != nil {
+					return err
+				}
+				if previousHash != "" {
+					return NewDomainError(fmt.Sprintf("event '%s' on line %d has no hash", event.ID, line), "Event", event.Meta.EntityID, nil)
+				}
+			} else if e.hashChain {
+				if err = e.chain(tx, &gormEvent, previousHashes); err != nil {
+					return err
+				}
+				if !hmac.Equal([]byte(exported.Hash), []byte(gormEvent.Hash)) {
+					return NewDomainError(fmt.Sprintf("the hash of event '%s' on line %d doesn't match its content or the previous event", event.ID, line), "Event", event.Meta.EntityID, nil)
+				}
+			}
+			if result := tx.Create(&gormEvent); result.Error != nil {
+				return result.Error
+			}
+			imported += 1
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+	return imported, nil
+}
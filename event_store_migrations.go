@@ -0,0 +1,187 @@
+package weos
+
+import (
+	"golang.org/x/net/context"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+//the migrations use snapshots of the event table so that they keep working as GormEvent changes
+
+type gormEventV1 struct {
+	gorm.Model
+	ID            string
+	EntityID      string `gorm:"index"`
+	EntityType    string `gorm:"index"`
+	Payload       datatypes.JSON
+	Type          string `gorm:"index"`
+	RootID        string `gorm:"index"`
+	ApplicationID string `gorm:"index"`
+	User          string `gorm:"index"`
+	SequenceNo    int64
+}
+
+func (gormEventV1) TableName() string {
+	return "gorm_events"
+}
+
+type gormEventAccount struct {
+	AccountID string `gorm:"index"`
+}
+
+func (gormEventAccount) TableName() string {
+	return "gorm_events"
+}
+
+type gormEventCorrelation struct {
+	CorrelationID string `gorm:"index"`
+	CausationID   string `gorm:"index"`
+}
+
+func (gormEventCorrelation) TableName() string {
+	return "gorm_events"
+}
+
+type gormEventHash struct {
+	Hash         string
+	PreviousHash string
+}
+
+func (gormEventHash) TableName() string {
+	return "gorm_events"
+}
+
+type gormEventRequest struct {
+	RequestID string `gorm:"index"`
+}
+
+func (gormEventRequest) TableName() string {
+	return "gorm_events"
+}
+
+//MigrationNamespace is the namespace the event store migrations are tracked under
+func (e *EventRepositoryGorm) MigrationNamespace() string {
+	return "events"
+}
+
+//Migrations are the versioned changes to the event store schema
+func (e *EventRepositoryGorm) Migrations() []*Migration {
+	return []*Migration{
+		{
+			Version: 1,
+			Name:    "create events table",
+			Up: func(tx *gorm.DB) error {
+				//databases created before versioned migrations already have the table
+				if tx.Migrator().HasTable(&gormEventV1{}) {
+					return nil
+				}
+				return tx.Migrator().CreateTable(&gormEventV1{})
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable(&gormEventV1{})
+			},
+		},
+		{
+			Version: 2,
+			Name:    "add account to events",
+			Up: func(tx *gorm.DB) error {
+				return addColumnWithIndex(tx, &gormEventAccount{}, "AccountID")
+			},
+			Down: func(tx *gorm.DB) error {
+				return dropColumnWithIndex(tx, &gormEventAccount{}, "AccountID")
+			},
+		},
+		{
+			Version: 3,
+			Name:    "add correlation and causation to events",
+			Up: func(tx *gorm.DB) error {
+				if err := addColumnWithIndex(tx, &gormEventCorrelation{}, "CorrelationID"); err != nil {
+					return err
+				}
+				return addColumnWithIndex(tx, &gormEventCorrelation{}, "CausationID")
+			},
+			Down: func(tx *gorm.DB) error {
+				if err := dropColumnWithIndex(tx, &gormEventCorrelation{}, "CausationID"); err != nil {
+					return err
+				}
+				return dropColumnWithIndex(tx, &gormEventCorrelation{}, "CorrelationID")
+			},
+		},
+		{
+			Version: 4,
+			Name:    "add hash chain to events",
+			Up: func(tx *gorm.DB) error {
+				for _, field := range []string{"Hash", "PreviousHash"} {
+					if !tx.Migrator().HasColumn(&gormEventHash{}, field) {
+						if err := tx.Migrator().AddColumn(&gormEventHash{}, field); err != nil {
+							return err
+						}
+					}
+				}
+				return nil
+			},
+			Down: func(tx *gorm.DB) error {
+				if err := tx.Migrator().DropColumn(&gormEventHash{}, "PreviousHash"); err != nil {
+					return err
+				}
+				return tx.Migrator().DropColumn(&gormEventHash{}, "Hash")
+			},
+		},
+		{
+			Version: 5,
+			Name:    "add request to events",
+			Up: func(tx *gorm.DB) error {
+				return addColumnWithIndex(tx, &gormEventRequest{}, "RequestID")
+			},
+			Down: func(tx *gorm.DB) error {
+				return dropColumnWithIndex(tx, &gormEventRequest{}, "RequestID")
+			},
+		},
+		//version 6 backfilled the account of events but the version is tracked once per database so it was removed in
+		//favour of BackfillAccount, it must not be reused since it's recorded as applied on existing databases
+	}
+}
+
+//BackfillAccount sets the account of the events stored before events had an account so that they are returned by
+//repositories scoped to the account. It's not run by the migrations, it needs to be called for each account with the
+//events that belong to it (e.g. filtered by application) before reads are scoped. Events in the hash chain are not
+//changed since that would break the chain
+func (e *EventRepositoryGorm) BackfillAccount(ctx context.Context, accountID string, filter EventFilter) (int64, error) {
+	if accountID == "" {
+		return 0, NewError("an account is required to backfill events", nil)
+	}
+	//the filter is applied to the unscoped events since the events being backfilled have no account
+	repository := *e
+	repository.AccountID = ""
+	result := backfillAccount(repository.conditions(filter).WithContext(ctx), accountID)
+	return result.RowsAffected, result.Error
+}
+
+func backfillAccount(tx *gorm.DB, accountID string) *gorm.DB {
+	return tx.Model(&GormEvent{}).
+		Where("account_id = '' OR account_id IS NULL").
+		Where("hash = '' OR hash IS NULL").
+		Update("account_id", accountID)
+}
+
+//addColumnWithIndex adds an indexed column if it doesn't already exist
+func addColumnWithIndex(tx *gorm.DB, model interface{}, field string) error {
+	if !tx.Migrator().HasColumn(model, field) {
+		if err := tx.Migrator().AddColumn(model, field); err != nil {
+			return err
+		}
+	}
+	if !tx.Migrator().HasIndex(model, field) {
+		return tx.Migrator().CreateIndex(model, field)
+	}
+	return nil
+}
+
+func dropColumnWithIndex(tx *gorm.DB, model interface{}, field string) error {
+	if tx.Migrator().HasIndex(model, field) {
+		if err := tx.Migrator().DropIndex(model, field); err != nil {
+			return err
+		}
+	}
+	return tx.Migrator().DropColumn(model, field)
+}
@@ -1,8 +1,10 @@
 module github.com/wepala/weos
 
-go 1.13
+go 1.15
 
 require (
+	github.com/ClickHouse/clickhouse-go v1.4.3
+	github.com/go-sql-driver/mysql v1.5.0
 	github.com/lib/pq v1.3.0
 	github.com/mattn/go-sqlite3 v1.14.6
 	github.com/onsi/ginkgo v1.15.0 // indirect
@@ -0,0 +1,195 @@
+package weos
+
+import (
+	"fmt"
+	"golang.org/x/net/context"
+	"gorm.io/gorm"
+	"time"
+)
+
+//ProjectionEvent is a record of an event that has been applied to a GormProjection
+type ProjectionEvent struct {
+	Projection string `gorm:"primaryKey"`
+	EventID    string `gorm:"primaryKey"`
+	CreatedAt  time.Time
+}
+
+func (ProjectionEvent) TableName() string {
+	return "projection_events"
+}
+
+type gormProjectionHandler func(tx *gorm.DB, event *Event) error
+
+//GormProjection is a read model stored in a table of a Gorm model. Instead of writing an event handler, declare what
+//each event type does to the rows with OnCreate, OnUpdate and OnDelete. Rows are identified by the entity id of the event.
+//Each event is applied once (by event id) and the projection checkpoint is saved with the changes
+type GormProjection struct {
+	name        string
+	db          *gorm.DB
+	model       interface{}
+	keyColumn   string
+	handlers    map[string]gormProjectionHandler
+	checkpoints *GormCheckpointStore
+	logger      Log
+}
+
+//NewGormProjection creates a projection that stores its rows in the table of the model
+func NewGormProjection(name string, db *gorm.DB, model interface{}, logger Log) *GormProjection {
+	return &GormProjection{
+		name:        name,
+		db:          db,
+		model:       model,
+		keyColumn:   "id",
+		handlers:    make(map[string]gormProjectionHandler),
+		checkpoints: NewGormCheckpointStore(db, logger),
+		logger:      logger,
+	}
+}
+
+//Name identifies the projection in checkpoints and health checks
+func (p *GormProjection) Name() string {
+	return p.name
+}
+
+//WithKey sets the column that is matched to the entity id of events. The default is "id"
+func (p *GormProjection) WithKey(column string) *GormProjection {
+	p.keyColumn = column
+	return p
+}
+
+//OnCreate inserts the row returned by create (a pointer to the model) when an event of the type is applied
+func (p *GormProjection) OnCreate(eventType string, create func(event *Event) (interface{}, error)) *GormProjection {
+	p.handlers[eventType] = func(tx *gorm.DB, event *Event) error {
+		row, err := create(event)
+		if err != nil {
+			return err
+		}
+		return tx.Create(row).Error
+	}
+	return p
+}
+
+//OnUpdate updates the fields returned by update on the row of the entity when an event of the type is applied
+func (p *GormProjection) OnUpdate(eventType string, update func(event *Event) (map[string]interface{}, error)) *GormProjection {
+	p.handlers[eventType] = func(tx *gorm.DB, event *Event) error {
+		fields, err := update(event)
+		if err != nil {
+			return err
+		}
+		return tx.Model(p.model).Where(p.keyColumn+" = ?", event.Meta.EntityID).Updates(fields).Error
+	}
+	return p
+}
+
+//OnDelete removes the row of the entity when an event of the type is applied
+func (p *GormProjection) OnDelete(eventType string) *GormProjection {
+	p.handlers[eventType] = func(tx *gorm.DB, event *Event) error {
+		return tx.Where(p.keyColumn+" = ?", event.Meta.EntityID).Delete(p.model).Error
+	}
+	return p
+}
+
+//Migrate creates the table of the model and the tables used to track the events that have been applied
+func (p *GormProjection) Migrate(ctx context.Context) error {
+	migrator := NewMigrator(p.db, p.logger)
+	if err := migrator.RegisterProvider(&projectionEventStore{}); err != nil {
+		return err
+	}
+	if err := migrator.RegisterProvider(p.checkpoints); err != nil {
+		return err
+	}
+	if err := migrator.Up(ctx); err != nil {
+		return err
+	}
+	return p.db.WithContext(ctx).AutoMigrate(p.model)
+}
+
+func (p *GormProjection) GetEventHandler() EventHandler {
+	return func(ctx context.Context, event Event) {
+		if err := p.Apply(ctx, &event); err != nil {
+			p.logger.Errorf("projection '%s' failed to apply event '%s': %s", p.name, event.ID, err)
+		}
+	}
+}
+
+//Apply makes the changes for the event unless it has already been applied
+func (p *GormProjection) Apply(ctx context.Context, event *Event) error {
+	handler, ok := p.handlers[event.Type]
+	if !ok {
+		return nil
+	}
+	return p.checkpoints.Apply(ctx, p.name, *event, func(tx *gorm.DB) error {
+		var applied int64
+		if err := tx.Model(&ProjectionEvent{}).Where("projection = ? AND event_id = ?", p.name, event.ID).Count(&applied).Error; err != nil {
+			return err
+		}
+		if applied > 0 {
+			return nil
+		}
+		if err := handler(tx, event); err != nil {
+			return err
+		}
+		return tx.Create(&ProjectionEvent{Projection: p.name, EventID: event.ID}).Error
+	})
+}
+
+//Rebuild removes all the rows and applies all the events in the repository again
+func (p *GormProjection) Rebuild(ctx context.Context, repository EventRepository) error {
+	if err := p.Reset(ctx); err != nil {
+		return err
+	}
+	_, err := ForEachEvent(repository, EventFilter{}, DefaultEventPageSize, func(event *Event) error {
+		if err := p.Apply(ctx, event); err != nil {
+			return NewError(fmt.Sprintf("error rebuilding projection '%s' at event '%s'", p.name, event.ID), err)
+		}
+		return nil
+	})
+	return err
+}
+
+//Reset removes all the rows, the record of the events that were applied and the checkpoint of the projection so that
+//the events can be applied again
+func (p *GormProjection) Reset(ctx context.Context) error {
+	return p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Unscoped().Delete(p.model).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("projection = ?", p.name).Delete(&ProjectionEvent{}).Error; err != nil {
+			return err
+		}
+		return NewGormCheckpointStore(tx, p.logger).ResetCheckpoint(ctx, p.name)
+	})
+}
+
+//projectionEventStore manages the table of applied events shared by the Gorm projections
+type projectionEventStore struct{}
+
+//projectionEventV1 is a snapshot of the applied events table used by the migrations
+type projectionEventV1 struct {
+	Projection string `gorm:"primaryKey"`
+	EventID    string `gorm:"primaryKey"`
+	CreatedAt  time.Time
+}
+
+func (projectionEventV1) TableName() string {
+	return "projection_events"
+}
+
+func (s *projectionEventStore) MigrationNamespace() string {
+	return "projection_events"
+}
+
+func (s *projectionEventStore) Migrations() []*Migration {
+	return []*Migration{
+		{
+			Version: 1,
+			Name:    "create projection events table",
+			Up: func(tx *gorm.DB) error {
+				return tx.Migrator().CreateTable(&projectionEventV1{})
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable(&projectionEventV1{})
+			},
+		},
+	}
+}
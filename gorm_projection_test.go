@@ -0,0 +1,111 @@
+package weos_test
+
+import (
+	"encoding/json"
+	log "github.com/sirupsen/logrus"
+	"github.com/wepala/weos"
+	"golang.org/x/net/context"
+	"testing"
+)
+
+type postReadModel struct {
+	ID    string `gorm:"primaryKey"`
+	Title string
+}
+
+func TestGormProjection(t *testing.T) {
+	db := newMigrationTestDB(t)
+	repository, err := weos.NewBasicEventRepository(db, log.New(), false, "", "")
+	if err != nil {
+		t.Fatalf("unexpected error creating repository '%s'", err)
+	}
+	title := func(event *weos.Event) string {
+		var payload map[string]string
+		json.Unmarshal(event.Payload, &payload)
+		return payload["title"]
+	}
+	projection := weos.NewGormProjection("posts", db, &postReadModel{}, log.New()).
+		OnCreate("POST_CREATED", func(event *weos.Event) (interface{}, error) {
+			return &postReadModel{ID: event.Meta.EntityID, Title: title(event)}, nil
+		}).
+		OnUpdate("POST_UPDATED", func(event *weos.Event) (map[string]interface{}, error) {
+			return map[string]interface{}{"title": title(event)}, nil
+		}).
+		OnDelete("POST_DELETED")
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("unexpected error getting connection '%s'", err)
+	}
+	app, err := weos.NewApplicationFromConfig(&weos.ApplicationConfig{
+		ModuleID: "blog",
+		Database: &weos.DBConfig{Driver: "sqlite3"},
+	}, nil, sqlDB, nil, repository)
+	if err != nil {
+		t.Fatalf("unexpected error creating application '%s'", err)
+	}
+	if err = app.AddProjection(projection); err != nil {
+		t.Fatalf("unexpected error adding projection '%s'", err)
+	}
+	if err = repository.Migrate(context.TODO()); err != nil {
+		t.Fatalf("unexpected error migrating repository '%s'", err)
+	}
+	if err = projection.Migrate(context.TODO()); err != nil {
+		t.Fatalf("unexpected error migrating projection '%s'", err)
+	}
+
+	persistPosts(t, repository, "post1", "POST_CREATED", "POST_UPDATED")
+	persistPosts(t, repository, "post2", "POST_CREATED", "POST_DELETED")
+	persistPosts(t, repository, "post3", "POST_CREATED")
+
+	posts := func(t *testing.T) map[string]string {
+		var rows []postReadModel
+		if err := db.Find(&rows).Error; err != nil {
+			t.Fatalf("unexpected error getting posts '%s'", err)
+		}
+		titles := make(map[string]string)
+		for _, row := range rows {
+			titles[row.ID] = row.Title
+		}
+		return titles
+	}
+	expectPosts := func(t *testing.T) {
+		titles := posts(t)
+		if len(titles) != 2 || titles["post1"] != "POST_UPDATED" || titles["post3"] != "POST_CREATED" {
+			t.Errorf("expected post1 to be updated, post2 to be deleted and post3 to be created, got %v", titles)
+		}
+	}
+	expectPosts(t)
+
+	tracked := false
+	for _, check := range app.Health(context.TODO()).Checks {
+		tracked = tracked || check.Name == "projection:posts"
+	}
+	if !tracked {
+		t.Error("expected the projection to be tracked by its name")
+	}
+
+	t.Run("events are applied once", func(t *testing.T) {
+		events, err := repository.GetByAggregate("post1")
+		if err != nil {
+			t.Fatalf("unexpected error getting events '%s'", err)
+		}
+		//post1 is updated then "created" again which would fail on the primary key if it was applied twice
+		if err = projection.Apply(context.TODO(), events[0]); err != nil {
+			t.Errorf("expected an applied event to be skipped, got '%s'", err)
+		}
+		expectPosts(t)
+	})
+
+	t.Run("rebuild", func(t *testing.T) {
+		db.Model(&postReadModel{}).Where("id = ?", "post1").Update("title", "corrupted")
+		if err := projection.Rebuild(context.TODO(), repository); err != nil {
+			t.Fatalf("unexpected error rebuilding projection '%s'", err)
+		}
+		expectPosts(t)
+		checkpoint, err := weos.NewGormCheckpointStore(db, log.New()).GetCheckpoint(context.TODO(), "posts")
+		if err != nil || checkpoint == nil {
+			t.Fatalf("expected the checkpoint to be saved, got '%v'", err)
+		}
+	})
+}
@@ -0,0 +1,197 @@
+package weos
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"gorm.io/gorm"
+	"hash"
+	"sync"
+	"time"
+)
+
+//ChainBreak is the first event in a root's hash chain that doesn't match what was stored
+type ChainBreak struct {
+	RootID     string
+	EventID    string
+	SequenceNo int64
+	Reason     string
+}
+
+func (c *ChainBreak) Error() string {
+	return fmt.Sprintf("hash chain of root '%s' is broken at event '%s' (sequence %d): %s", c.RootID, c.EventID, c.SequenceNo, c.Reason)
+}
+
+//EnableHashChain makes the event store tamper evident. Each event stores a hash of its content and the hash of the
+//previous event of its root so that editing or removing an event breaks the chain. If a secret is set the hashes are
+//HMACs so that the chain can't be recomputed by someone with access to the database only. Events are chained one at a
+//time within the process (Persist and Import share a lock) but processes that share the event store aren't coordinated
+//so they need to write through one process to keep the chain linear
+func (e *EventRepositoryGorm) EnableHashChain(secret string) {
+	e.hashChain = true
+	if e.chainMutex == nil {
+		e.chainMutex = &sync.Mutex{}
+	}
+	e.hashSecret = nil
+	if secret != "" {
+		e.hashSecret = []byte(secret)
+	}
+}
+
+//Verify checks the hash chain of a root and returns the first broken link. Events stored before the hash chain was
+//enabled are not checked
+func (e *EventRepositoryGorm) Verify(rootID string) (*ChainBreak, error) {
+	var events []GormEvent
+	result := e.scoped().Order("created_at asc").Order("sequence_no asc").Where("root_id = ?", rootID).Find(&events)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return e.verifyChain(rootID, events)
+}
+
+//VerifyAll checks the hash chains of all the roots and returns the first broken link of each broken chain
+func (e *EventRepositoryGorm) VerifyAll() ([]*ChainBreak, error) {
+	var rootIDs []string
+	result := e.scoped().Model(&GormEvent{}).Distinct("root_id").Order("root_id").Pluck("root_id", &rootIDs)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	var breaks []*ChainBreak
+	for _, rootID := range rootIDs {
+		chainBreak, err := e.Verify(rootID)
+		if err != nil {
+			return nil, err
+		}
+		if chainBreak != nil {
+			breaks = append(breaks, chainBreak)
+		}
+	}
+	return breaks, nil
+}
+
+func (e *EventRepositoryGorm) verifyChain(rootID string, events []GormEvent) (*ChainBreak, error) {
+	//the chains are per account in case the root id is used by more than one account
+	previousHashes := make(map[string]string)
+	for _, event := range events {
+		previousHash, chained := previousHashes[event.AccountID]
+		if event.Hash == "" {
+			//events from before the chain was enabled
+			if !chained {
+				continue
+			}
+			return &ChainBreak{RootID: rootID, EventID: event.ID, SequenceNo: event.SequenceNo, Reason: "the event has no hash"}, nil
+		}
+		if event.PreviousHash != previousHash {
+			return &ChainBreak{RootID: rootID, EventID: event.ID, SequenceNo: event.SequenceNo, Reason: "the previous hash doesn't match the previous event"}, nil
+		}
+		expected, err := e.hash(&event)
+		if err != nil {
+			return nil, err
+		}
+		if !hmac.Equal([]byte(expected), []byte(event.Hash)) {
+			return &ChainBreak{RootID: rootID, EventID: event.ID, SequenceNo: event.SequenceNo, Reason: "the event content doesn't match its hash"}, nil
+		}
+		previousHashes[event.AccountID] = event.Hash
+	}
+	return nil, nil
+}
+
+//create inserts the events. Events are linked to the last event of their root and inserted while no other events are
+//being chained (including by the copies of the repository scoped to an account) so that two events can't follow the
+//same event. Processes that share the event store need to write through the same process to keep the chain linear
+func (e *EventRepositoryGorm) create(events []GormEvent) error {
+	if e.hashChain {
+		e.chainMutex.Lock()
+		defer e.chainMutex.Unlock()
+		//the last hash of each root in the hash chain
+		previousHashes := make(map[string]string)
+		for i := range events {
+			//the events are stored in the order they are chained. The creation time is part of the hash so it's stored at a
+			//precision all databases keep (rounded up so that it's not before the events that were already stored)
+			events[i].CreatedAt = e.now().Add(time.Millisecond - time.Nanosecond).Truncate(time.Millisecond)
+			if err := e.chain(e.DB, &events[i], previousHashes); err != nil {
+				return err
+			}
+		}
+	}
+	return e.DB.Create(events).Error
+}
+
+//chain sets the hash of the event and links it to the last event of its root. The previous hashes are the hashes of
+//the events in the same batch that haven't been saved yet
+func (e *EventRepositoryGorm) chain(db *gorm.DB, event *GormEvent, previousHashes map[string]string) error {
+	previousHash, err := e.previousHash(db, event, previousHashes)
+	if err != nil {
+		return err
+	}
+	event.PreviousHash = previousHash
+	if event.Hash, err = e.hash(event); err != nil {
+		return err
+	}
+	previousHashes[event.AccountID+":"+event.RootID] = event.Hash
+	return nil
+}
+
+//previousHash is the hash of the last event in the chain of the event's root
+func (e *EventRepositoryGorm) previousHash(db *gorm.DB, event *GormEvent, previousHashes map[string]string) (string, error) {
+	if previousHash, ok := previousHashes[event.AccountID+":"+event.RootID]; ok {
+		return previousHash, nil
+	}
+	var previous GormEvent
+	result := db.Order("created_at desc").Order("sequence_no desc").Where("root_id = ? AND account_id = ? AND hash <> ''", event.RootID, event.AccountID).Limit(1).Find(&previous)
+	return previous.Hash, result.Error
+}
+
+//hash is calculated from the stored content and metadata of the event (e.g. with personal data encrypted) and the
+//previous hash
+func (e *EventRepositoryGorm) hash(event *GormEvent) (string, error) {
+	//the payload is normalized since databases may store json differently (e.g. postgres reorders keys in jsonb)
+	payload, err := canonicalJSON(event.Payload)
+	if err != nil {
+		return "", err
+	}
+	content, err := json.Marshal([]interface{}{
+		event.ID,
+		event.Type,
+		event.EntityID,
+		event.EntityType,
+		event.RootID,
+		event.ApplicationID,
+		event.AccountID,
+		event.User,
+		event.SequenceNo,
+		event.CorrelationID,
+		event.CausationID,
+		event.RequestID,
+		event.CreatedAt.UTC().Format(time.RFC3339Nano),
+		payload,
+		event.PreviousHash,
+	})
+	if err != nil {
+		return "", err
+	}
+	var hasher hash.Hash
+	if e.hashSecret != nil {
+		hasher = hmac.New(sha256.New, e.hashSecret)
+	} else {
+		hasher = sha256.New()
+	}
+	hasher.Write(content)
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+func canonicalJSON(data []byte) (json.RawMessage, error) {
+	if len(data) == 0 {
+		return json.RawMessage("null"), nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
@@ -0,0 +1,233 @@
+package weos_test
+
+import (
+	"bytes"
+	log "github.com/sirupsen/logrus"
+	"github.com/wepala/weos"
+	"golang.org/x/net/context"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEventRepositoryGorm_Verify(t *testing.T) {
+	setup := func(t *testing.T) (*gorm.DB, *weos.EventRepositoryGorm) {
+		db := newMigrationTestDB(t)
+		repository, err := weos.NewBasicEventRepository(db, log.New(), false, "", "")
+		if err != nil {
+			t.Fatalf("unexpected error creating repository '%s'", err)
+		}
+		if err = repository.Migrate(context.TODO()); err != nil {
+			t.Fatalf("unexpected error migrating repository '%s'", err)
+		}
+		eventRepository := repository.(*weos.EventRepositoryGorm)
+		//an event from before the hash chain was enabled
+		persistPosts(t, eventRepository, "post1", "POST_CREATED")
+		eventRepository.EnableHashChain("secret")
+		persistPosts(t, eventRepository, "post1", "POST_UPDATED", "POST_PUBLISHED")
+		persistPosts(t, eventRepository, "post1", "POST_ARCHIVED")
+		persistPosts(t, eventRepository, "post2", "POST_CREATED")
+		return db, eventRepository
+	}
+
+	t.Run("untouched chain", func(t *testing.T) {
+		_, repository := setup(t)
+		chainBreak, err := repository.Verify("post1")
+		if err != nil {
+			t.Fatalf("unexpected error verifying chain '%s'", err)
+		}
+		if chainBreak != nil {
+			t.Errorf("expected the chain to be intact, got '%s'", chainBreak)
+		}
+	})
+
+	t.Run("edited event", func(t *testing.T) {
+		db, repository := setup(t)
+		db.Model(&weos.GormEvent{}).Where("type = ? AND root_id = ?", "POST_PUBLISHED", "post1").Update("payload", datatypes.JSON(`{"title":"Edited"}`))
+		chainBreak, err := repository.Verify("post1")
+		if err != nil {
+			t.Fatalf("unexpected error verifying chain '%s'", err)
+		}
+		if chainBreak == nil || chainBreak.Reason != "the event content doesn't match its hash" {
+			t.Fatalf("expected the edited event to break the chain, got '%v'", chainBreak)
+		}
+		var edited weos.GormEvent
+		db.Where("type = ? AND root_id = ?", "POST_PUBLISHED", "post1").First(&edited)
+		if chainBreak.EventID != edited.ID {
+			t.Errorf("expected the chain to break at '%s', got '%s'", edited.ID, chainBreak.EventID)
+		}
+	})
+
+	t.Run("removed event", func(t *testing.T) {
+		db, repository := setup(t)
+		db.Unscoped().Where("type = ? AND root_id = ?", "POST_PUBLISHED", "post1").Delete(&weos.GormEvent{})
+		breaks, err := repository.VerifyAll()
+		if err != nil {
+			t.Fatalf("unexpected error verifying chains '%s'", err)
+		}
+		if len(breaks) != 1 {
+			t.Fatalf("expected %d broken chain, got %d", 1, len(breaks))
+		}
+		if breaks[0].RootID != "post1" || breaks[0].Reason != "the previous hash doesn't match the previous event" {
+			t.Errorf("expected the chain of post1 to be broken by the missing event, got '%s'", breaks[0])
+		}
+	})
+
+	t.Run("edited metadata", func(t *testing.T) {
+		for _, column := range []string{"request_id", "created_at"} {
+			db, repository := setup(t)
+			var value interface{} = "request-1"
+			if column == "created_at" {
+				value = time.Date(2021, 8, 1, 12, 0, 0, 0, time.UTC)
+			}
+			db.Model(&weos.GormEvent{}).Where("type = ? AND root_id = ?", "POST_ARCHIVED", "post1").Update(column, value)
+			chainBreak, err := repository.Verify("post1")
+			if err != nil {
+				t.Fatalf("unexpected error verifying chain '%s'", err)
+			}
+			if chainBreak == nil {
+				t.Errorf("expected editing the %s to break the chain", column)
+			}
+		}
+	})
+
+	t.Run("concurrent writers keep the chain linear", func(t *testing.T) {
+		db, repository := setup(t)
+		//give other writers time to read the same previous event
+		db.Callback().Query().After("gorm:query").Register("test:slow_query", func(*gorm.DB) {
+			time.Sleep(time.Millisecond)
+		})
+		repository.SetClock(&tickingClock{current: time.Date(2021, 8, 1, 12, 0, 0, 0, time.UTC)})
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(sequenceNo int64) {
+				defer wg.Done()
+				entity := &weos.AggregateRoot{BasicEntity: weos.BasicEntity{ID: "post3"}, SequenceNo: sequenceNo}
+				entity.NewChange(weos.NewEntityEvent("POST_UPDATED", entity, "post3", map[string]int64{"revision": sequenceNo}))
+				if err := repository.Persist(context.TODO(), entity); err != nil {
+					t.Errorf("unexpected error persisting events '%s'", err)
+				}
+			}(int64(i))
+		}
+		wg.Wait()
+		chainBreak, err := repository.Verify("post3")
+		if err != nil {
+			t.Fatalf("unexpected error verifying chain '%s'", err)
+		}
+		if chainBreak != nil {
+			t.Errorf("expected the chain to be intact, got '%s'", chainBreak)
+		}
+	})
+
+	t.Run("hashes are hmacs with the secret", func(t *testing.T) {
+		_, repository := setup(t)
+		repository.EnableHashChain("another secret")
+		chainBreak, err := repository.Verify("post2")
+		if err != nil {
+			t.Fatalf("unexpected error verifying chain '%s'", err)
+		}
+		if chainBreak == nil {
+			t.Error("expected the chain not to verify with a different secret")
+		}
+	})
+}
+
+func TestEventRepositoryGorm_ImportHashChain(t *testing.T) {
+	repository, err := weos.NewBasicEventRepository(newMigrationTestDB(t), log.New(), false, "", "")
+	if err != nil {
+		t.Fatalf("unexpected error creating repository '%s'", err)
+	}
+	if err = repository.Migrate(context.TODO()); err != nil {
+		t.Fatalf("unexpected error migrating repository '%s'", err)
+	}
+	source := repository.(*weos.EventRepositoryGorm)
+	//an event from before the hash chain was enabled
+	persistPosts(t, source, "post1", "POST_CREATED")
+	source.EnableHashChain("secret")
+	persistPosts(t, source, "post1", "POST_UPDATED", "POST_PUBLISHED")
+	buffer := &bytes.Buffer{}
+	if _, err = source.Export(context.TODO(), buffer, weos.EventFilter{}); err != nil {
+		t.Fatalf("unexpected error exporting events '%s'", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	if len(lines) != 3 || !strings.Contains(lines[2], `"hash":`) || !strings.Contains(lines[2], `"previous_hash":`) {
+		t.Fatalf("expected the hashes to be exported, got %v", lines)
+	}
+	importInto := func(t *testing.T, export string) (*weos.EventRepositoryGorm, error) {
+		repository, err := weos.NewBasicEventRepository(newMigrationTestDB(t), log.New(), false, "", "")
+		if err != nil {
+			t.Fatalf("unexpected error creating repository '%s'", err)
+		}
+		if err = repository.Migrate(context.TODO()); err != nil {
+			t.Fatalf("unexpected error migrating repository '%s'", err)
+		}
+		destination := repository.(*weos.EventRepositoryGorm)
+		destination.EnableHashChain("secret")
+		_, err = destination.Import(context.TODO(), strings.NewReader(export))
+		return destination, err
+	}
+
+	t.Run("the chain is imported as it was exported", func(t *testing.T) {
+		destination, err := importInto(t, buffer.String())
+		if err != nil {
+			t.Fatalf("unexpected error importing events '%s'", err)
+		}
+		chainBreak, err := destination.Verify("post1")
+		if err != nil {
+			t.Fatalf("unexpected error verifying chain '%s'", err)
+		}
+		if chainBreak != nil {
+			t.Errorf("expected the imported chain to be intact, got '%s'", chainBreak)
+		}
+	})
+
+	t.Run("edited events are rejected", func(t *testing.T) {
+		edited := strings.Replace(buffer.String(), `"title":"POST_PUBLISHED"`, `"title":"edited"`, 1)
+		if edited == buffer.String() {
+			t.Fatal("expected the export to be edited")
+		}
+		if _, err := importInto(t, edited); err == nil {
+			t.Error("expected an error importing an edited event")
+		}
+	})
+
+	t.Run("events without a hash can't follow an event with one", func(t *testing.T) {
+		stripped := strings.Join([]string{lines[0], lines[1], regexp.MustCompile(`,"(previous_)?hash":"[0-9a-f]*"`).ReplaceAllString(lines[2], "")}, "\n")
+		if _, err := importInto(t, stripped); err == nil {
+			t.Error("expected an error importing an event without its hash")
+		}
+	})
+}
+
+func persistPosts(t *testing.T, repository weos.EventRepository, rootID string, eventTypes ...string) {
+	entity := &weos.AggregateRoot{BasicEntity: weos.BasicEntity{ID: rootID}}
+	sequenceNo, err := repository.GetAggregateSequenceNumber(rootID)
+	if err != nil {
+		t.Fatalf("unexpected error getting sequence number '%s'", err)
+	}
+	entity.SequenceNo = sequenceNo
+	for _, eventType := range eventTypes {
+		entity.NewChange(weos.NewEntityEvent(eventType, entity, rootID, map[string]string{"title": eventType}))
+	}
+	if err = repository.Persist(context.TODO(), entity); err != nil {
+		t.Fatalf("unexpected error persisting events '%s'", err)
+	}
+}
+
+//tickingClock moves forward a millisecond each time it's read so that every event is stored at a different time
+type tickingClock struct {
+	current time.Time
+	mutex   sync.Mutex
+}
+
+func (c *tickingClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.current = c.current.Add(time.Millisecond)
+	return c.current
+}
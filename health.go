@@ -0,0 +1,225 @@
+package weos
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/net/context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+type HealthStatus string
+
+const HealthStatusUp HealthStatus = "up"
+const HealthStatusDown HealthStatus = "down"
+
+//HealthCheck is a function that returns an error if the component it checks is not healthy
+type HealthCheck func(ctx context.Context) error
+
+//HealthChecker can be implemented by components (e.g. event repository, projections, dispatchers) that are able to
+//report on their own health. Components that implement this interface are registered automatically by the application
+type HealthChecker interface {
+	HealthCheck(ctx context.Context) error
+}
+
+//handlerHealth records when a handler last panicked. It has its own lock so that health checks don't wait for handlers
+//that are still running
+type handlerHealth struct {
+	panickedAt time.Time
+	mutex      sync.RWMutex
+}
+
+func (h *handlerHealth) panicked(at time.Time) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.panickedAt = at
+}
+
+//check returns an error if a handler panicked within the window before now. If the window is 0 the error is returned
+//until reset is called
+func (h *handlerHealth) check(message string, now time.Time, window time.Duration) error {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	if h.panickedAt.IsZero() || (window > 0 && now.Sub(h.panickedAt) >= window) {
+		return nil
+	}
+	return errors.New(message)
+}
+
+func (h *handlerHealth) reset() {
+	h.panicked(time.Time{})
+}
+
+type HealthCheckResult struct {
+	Name     string                 `json:"name"`
+	Status   HealthStatus           `json:"status"`
+	Error    string                 `json:"error,omitempty"`
+	Duration string                 `json:"duration"`
+	Details  map[string]interface{} `json:"details,omitempty"`
+}
+
+type HealthReport struct {
+	Status    HealthStatus         `json:"status"`
+	Timestamp string               `json:"timestamp"`
+	Checks    []*HealthCheckResult `json:"checks"`
+}
+
+//HealthRegistry keeps track of the health checks registered by the different components of an application
+type HealthRegistry struct {
+	checks           map[string]HealthCheck
+	details          map[string]func() map[string]interface{}
+	MaxProjectionLag int64
+	mutex            sync.RWMutex
+}
+
+//AddCheck registers a health check. If a check with the same name already exists it is replaced
+func (h *HealthRegistry) AddCheck(name string, check HealthCheck) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.checks == nil {
+		h.checks = make(map[string]HealthCheck)
+	}
+	h.checks[name] = check
+}
+
+//AddProjection registers a tracker for the projection so that its lag is included in health reports
+func (h *HealthRegistry) AddProjection(name string, tracker *ProjectionTracker) {
+	checkName := "projection:" + name
+	h.AddCheck(checkName, func(ctx context.Context) error {
+		if lag := tracker.Lag(); lag > h.MaxProjectionLag {
+			return fmt.Errorf("projection '%s' is %d events behind", name, lag)
+		}
+		return nil
+	})
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.details == nil {
+		h.details = make(map[string]func() map[string]interface{})
+	}
+	h.details[checkName] = func() map[string]interface{} {
+		return map[string]interface{}{
+			"received":  tracker.Received(),
+			"processed": tracker.Processed(),
+			"lag":       tracker.Lag(),
+		}
+	}
+}
+
+//Check runs all the registered health checks
+func (h *HealthRegistry) Check(ctx context.Context) *HealthReport {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	report := &HealthReport{
+		Status:    HealthStatusUp,
+		Timestamp: time.Now().Format(time.RFC3339Nano),
+	}
+
+	var names []string
+	for name := range h.checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		start := time.Now()
+		err := h.checks[name](ctx)
+		result := &HealthCheckResult{
+			Name:     name,
+			Status:   HealthStatusUp,
+			Duration: time.Since(start).String(),
+		}
+		if err != nil {
+			result.Status = HealthStatusDown
+			result.Error = err.Error()
+			report.Status = HealthStatusDown
+		}
+		if details, ok := h.details[name]; ok {
+			result.Details = details()
+		}
+		report.Checks = append(report.Checks, result)
+	}
+
+	return report
+}
+
+//ProjectionTracker keeps count of the events a projection has received and successfully processed. The difference
+//between the two is the projection lag (events that are in flight or that the projection failed to handle)
+type ProjectionTracker struct {
+	received  int64
+	processed int64
+	mutex     sync.RWMutex
+}
+
+//Track wraps an event handler so that the events it receives and processes are counted
+func (p *ProjectionTracker) Track(handler EventHandler) EventHandler {
+	return func(ctx context.Context, event Event) {
+		p.mutex.Lock()
+		p.received += 1
+		p.mutex.Unlock()
+		handler(ctx, event)
+		//if the handler panics this is never reached and the projection falls behind
+		p.mutex.Lock()
+		p.processed += 1
+		p.mutex.Unlock()
+	}
+}
+
+func (p *ProjectionTracker) Received() int64 {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.received
+}
+
+func (p *ProjectionTracker) Processed() int64 {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.processed
+}
+
+func (p *ProjectionTracker) Lag() int64 {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.received - p.processed
+}
+
+//DBHealthCheck checks that the database is reachable
+func DBHealthCheck(db *sql.DB) HealthCheck {
+	return func(ctx context.Context) error {
+		if db == nil {
+			return errors.New("no database connection configured")
+		}
+		return db.PingContext(ctx)
+	}
+}
+
+//NewLivenessHandler returns a handler that reports whether the application is running. It does not run any checks
+func NewLivenessHandler(app Application) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeHealthReport(w, &HealthReport{
+			Status:    HealthStatusUp,
+			Timestamp: time.Now().Format(time.RFC3339Nano),
+		})
+	}
+}
+
+//NewReadinessHandler returns a handler that runs all the application health checks and responds with a 503 if any fail
+func NewReadinessHandler(app Application) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeHealthReport(w, app.Health(r.Context()))
+	}
+}
+
+func writeHealthReport(w http.ResponseWriter, report *HealthReport) {
+	w.Header().Set("Content-Type", "application/json")
+	if report.Status != HealthStatusUp {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+	_ = json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,257 @@
+package weos_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/wepala/weos"
+	"golang.org/x/net/context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHealthRegistry_Check(t *testing.T) {
+	t.Run("all checks pass", func(t *testing.T) {
+		registry := &weos.HealthRegistry{}
+		registry.AddCheck("database", func(ctx context.Context) error {
+			return nil
+		})
+		report := registry.Check(context.TODO())
+		if report.Status != weos.HealthStatusUp {
+			t.Errorf("expected the status to be '%s', got '%s'", weos.HealthStatusUp, report.Status)
+		}
+		if len(report.Checks) != 1 {
+			t.Fatalf("expected %d check result, got %d", 1, len(report.Checks))
+		}
+	})
+
+	t.Run("failing check marks the report as down", func(t *testing.T) {
+		registry := &weos.HealthRegistry{}
+		registry.AddCheck("database", func(ctx context.Context) error {
+			return errors.New("connection refused")
+		})
+		registry.AddCheck("dispatcher", func(ctx context.Context) error {
+			return nil
+		})
+		report := registry.Check(context.TODO())
+		if report.Status != weos.HealthStatusDown {
+			t.Errorf("expected the status to be '%s', got '%s'", weos.HealthStatusDown, report.Status)
+		}
+		if report.Checks[0].Name != "database" || report.Checks[0].Error != "connection refused" {
+			t.Errorf("expected the database check to report the error, got '%s'", report.Checks[0].Error)
+		}
+		if report.Checks[1].Status != weos.HealthStatusUp {
+			t.Errorf("expected the dispatcher check to be '%s', got '%s'", weos.HealthStatusUp, report.Checks[1].Status)
+		}
+	})
+
+	t.Run("projection lag is reported", func(t *testing.T) {
+		registry := &weos.HealthRegistry{}
+		tracker := &weos.ProjectionTracker{}
+		registry.AddProjection("PostProjection", tracker)
+		handler := tracker.Track(func(ctx context.Context, event weos.Event) {
+			if event.Type == "FAIL" {
+				panic("unable to handle event")
+			}
+		})
+		dispatcher := &weos.EventDisptacher{}
+		dispatcher.AddSubscriber(handler)
+		dispatcher.Dispatch(context.TODO(), weos.Event{Type: "OK"})
+		dispatcher.Dispatch(context.TODO(), weos.Event{Type: "FAIL"})
+
+		report := registry.Check(context.TODO())
+		if report.Status != weos.HealthStatusDown {
+			t.Errorf("expected the status to be '%s', got '%s'", weos.HealthStatusDown, report.Status)
+		}
+		if report.Checks[0].Details["lag"] != int64(1) {
+			t.Errorf("expected the projection lag to be %d, got %v", 1, report.Checks[0].Details["lag"])
+		}
+	})
+}
+
+func TestBaseApplication_Health(t *testing.T) {
+	config := &weos.ApplicationConfig{
+		ModuleID: "1iPwGftUqaP4rkWdvFp6BBW2tOf",
+		Title:    "Test Module",
+		Database: &weos.DBConfig{
+			Driver:   "sqlite3",
+			Database: ":memory:",
+		},
+	}
+	mockEventRepository := &EventRepositoryMock{
+		AddSubscriberFunc: func(handler weos.EventHandler) {
+
+		},
+	}
+	app, err := weos.NewApplicationFromConfig(config, nil, nil, nil, mockEventRepository)
+	if err != nil {
+		t.Fatalf("unexpected error setting up app '%s'", err)
+	}
+
+	t.Run("database and dispatcher checks are registered", func(t *testing.T) {
+		report := app.Health(context.TODO())
+		if report.Status != weos.HealthStatusUp {
+			t.Errorf("expected the status to be '%s', got '%s'", weos.HealthStatusUp, report.Status)
+		}
+		names := map[string]bool{}
+		for _, check := range report.Checks {
+			names[check.Name] = true
+		}
+		if !names["database"] {
+			t.Error("expected a database check to be registered")
+		}
+		if !names["dispatcher"] {
+			t.Error("expected a dispatcher check to be registered")
+		}
+	})
+
+	t.Run("projections are tracked", func(t *testing.T) {
+		err = app.AddProjection(&ProjectionMock{
+			GetEventHandlerFunc: func() weos.EventHandler {
+				return func(ctx context.Context, event weos.Event) {}
+			},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error adding projection '%s'", err)
+		}
+		report := app.Health(context.TODO())
+		found := false
+		for _, check := range report.Checks {
+			if check.Name == "projection:ProjectionMock" {
+				found = true
+			}
+		}
+		if !found {
+			t.Error("expected a check to be registered for the projection")
+		}
+	})
+
+	t.Run("readiness handler", func(t *testing.T) {
+		app.AddHealthCheck("failing", func(ctx context.Context) error {
+			return errors.New("some error")
+		})
+		recorder := httptest.NewRecorder()
+		weos.NewReadinessHandler(app).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/health/ready", nil))
+		if recorder.Code != http.StatusServiceUnavailable {
+			t.Errorf("expected the status code to be %d, got %d", http.StatusServiceUnavailable, recorder.Code)
+		}
+		report := &weos.HealthReport{}
+		if err := json.NewDecoder(recorder.Body).Decode(report); err != nil {
+			t.Fatalf("unexpected error decoding report '%s'", err)
+		}
+		if report.Status != weos.HealthStatusDown {
+			t.Errorf("expected the status to be '%s', got '%s'", weos.HealthStatusDown, report.Status)
+		}
+	})
+
+	t.Run("liveness handler", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		weos.NewLivenessHandler(app).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/health/live", nil))
+		if recorder.Code != http.StatusOK {
+			t.Errorf("expected the status code to be %d, got %d", http.StatusOK, recorder.Code)
+		}
+	})
+}
+
+func TestDefaultCommandDispatcher_HealthCheck(t *testing.T) {
+	clock := weos.NewFakeClock(time.Date(2021, 8, 1, 12, 0, 0, 0, time.UTC))
+	dispatcher := &weos.DefaultCommandDispatcher{Clock: clock, PanicWindow: time.Minute}
+	release := make(chan struct{})
+	started := make(chan struct{})
+	dispatcher.AddSubscriber(&weos.Command{Type: "SLOW"}, func(ctx context.Context, command *weos.Command) error {
+		close(started)
+		<-release
+		return nil
+	})
+	dispatcher.AddSubscriber(&weos.Command{Type: "PANIC"}, func(ctx context.Context, command *weos.Command) error {
+		panic("something went wrong")
+	})
+
+	t.Run("health checks don't wait for handlers", func(t *testing.T) {
+		done := make(chan error)
+		go func() { done <- dispatcher.Dispatch(context.TODO(), &weos.Command{Type: "SLOW"}) }()
+		<-started
+		checked := make(chan error)
+		go func() { checked <- dispatcher.HealthCheck(context.TODO()) }()
+		select {
+		case err := <-checked:
+			if err != nil {
+				t.Errorf("expected the dispatcher to be healthy, got '%s'", err)
+			}
+		case <-time.After(time.Second):
+			t.Error("expected the health check not to wait for the handler")
+		}
+		close(release)
+		<-done
+	})
+
+	t.Run("panics expire after the window", func(t *testing.T) {
+		dispatcher.Dispatch(context.TODO(), &weos.Command{Type: "PANIC"})
+		if err := dispatcher.HealthCheck(context.TODO()); err == nil {
+			t.Error("expected the dispatcher to be unhealthy after a panic")
+		}
+		clock.Advance(time.Minute)
+		if err := dispatcher.HealthCheck(context.TODO()); err != nil {
+			t.Errorf("expected the panic to expire, got '%s'", err)
+		}
+	})
+
+	t.Run("health can be reset", func(t *testing.T) {
+		dispatcher.PanicWindow = 0
+		dispatcher.Dispatch(context.TODO(), &weos.Command{Type: "PANIC"})
+		clock.Advance(time.Hour)
+		if err := dispatcher.HealthCheck(context.TODO()); err == nil {
+			t.Error("expected the dispatcher to stay unhealthy without a window")
+		}
+		dispatcher.ResetHealth()
+		if err := dispatcher.HealthCheck(context.TODO()); err != nil {
+			t.Errorf("expected the dispatcher to be healthy after a reset, got '%s'", err)
+		}
+	})
+}
+
+func TestEventDisptacher_HealthCheck(t *testing.T) {
+	clock := weos.NewFakeClock(time.Date(2021, 8, 1, 12, 0, 0, 0, time.UTC))
+	dispatcher := &weos.EventDisptacher{Clock: clock, PanicWindow: time.Minute}
+	dispatcher.AddSubscriber(func(ctx context.Context, event weos.Event) {
+		if event.Type == "FAIL" {
+			panic("unable to handle event")
+		}
+	})
+
+	dispatcher.Dispatch(context.TODO(), weos.Event{Type: "FAIL"})
+	clock.Advance(time.Minute - time.Second)
+	if err := dispatcher.HealthCheck(context.TODO()); err == nil {
+		t.Error("expected the dispatcher to be unhealthy within the window")
+	}
+	clock.Advance(time.Second)
+	if err := dispatcher.HealthCheck(context.TODO()); err != nil {
+		t.Errorf("expected the panic to expire, got '%s'", err)
+	}
+}
+
+func TestBaseApplication_HealthConcurrency(t *testing.T) {
+	app := &weos.BaseApplication{}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		name := fmt.Sprintf("check%d", i)
+		go func() {
+			defer wg.Done()
+			app.AddHealthCheck(name, func(ctx context.Context) error {
+				return nil
+			})
+		}()
+		go func() {
+			defer wg.Done()
+			app.Health(context.TODO())
+		}()
+	}
+	wg.Wait()
+	if report := app.Health(context.TODO()); len(report.Checks) != 10 {
+		t.Errorf("expected %d checks, got %d", 10, len(report.Checks))
+	}
+}
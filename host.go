@@ -0,0 +1,205 @@
+package weos
+
+import (
+	"fmt"
+	"golang.org/x/net/context"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//ModuleSeparator separates the module id from the command type in a module qualified command type e.g. "blog.CREATE_POST"
+const ModuleSeparator = "."
+
+//Host runs several modules in one process. Each module is an application with its own projections and command
+//handlers. Commands are routed to a module by a module qualified type and all the modules share one event store
+type Host struct {
+	eventRepository EventRepository
+	logger          Log
+	modules         map[string]Application
+	mutex           sync.RWMutex
+}
+
+func NewHost(eventRepository EventRepository, logger Log) *Host {
+	return &Host{
+		eventRepository: eventRepository,
+		logger:          logger,
+		modules:         make(map[string]Application),
+	}
+}
+
+//AddModule registers a module with the host. The module is identified by its ID and must use the event repository of
+//the host (e.g. pass Host.EventRepository() to NewApplicationFromConfig). The projections of a BaseApplication module
+//only receive the events of the module, other modules wrap their projection handlers with ModuleEventHandler
+func (h *Host) AddModule(module Application) error {
+	moduleID := module.ID()
+	if moduleID == "" {
+		return NewError("a module id is required to host a module", nil)
+	}
+	if strings.Contains(moduleID, ModuleSeparator) {
+		return NewError(fmt.Sprintf("module id '%s' can't contain '%s'", moduleID, ModuleSeparator), nil)
+	}
+	if unwrapModuleRepository(module.EventRepository()) != h.eventRepository {
+		return NewError(fmt.Sprintf("module '%s' must use the event repository of the host", moduleID), nil)
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if _, ok := h.modules[moduleID]; ok {
+		return NewError(fmt.Sprintf("module '%s' is already registered", moduleID), nil)
+	}
+	h.modules[moduleID] = module
+	if hosted, ok := module.(interface{ setHosted() }); ok {
+		hosted.setHosted()
+	}
+	return nil
+}
+
+//moduleEventRepository is the event repository of a hosted module. Events persisted without a module in the context
+//(e.g. outside Host.Dispatch) are stamped with the module id instead of the application id of the shared repository
+type moduleEventRepository struct {
+	EventRepository
+	moduleID string
+}
+
+func (r *moduleEventRepository) Persist(ctx context.Context, entity AggregateInterface) error {
+	if GetModuleID(ctx) == "" {
+		ctx = context.WithValue(ctx, MODULE_ID, r.moduleID)
+	}
+	return r.EventRepository.Persist(ctx, entity)
+}
+
+func (r *moduleEventRepository) WithContext(ctx context.Context) (EventRepository, error) {
+	repository, err := r.EventRepository.WithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &moduleEventRepository{EventRepository: repository, moduleID: r.moduleID}, nil
+}
+
+func unwrapModuleRepository(repository EventRepository) EventRepository {
+	if moduleRepository, ok := repository.(*moduleEventRepository); ok {
+		return moduleRepository.EventRepository
+	}
+	return repository
+}
+
+//Module returns the module with the id or nil if it's not registered
+func (h *Host) Module(moduleID string) Application {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return h.modules[moduleID]
+}
+
+//Modules returns all the registered modules ordered by id
+func (h *Host) Modules() []Application {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	var modules []Application
+	for _, moduleID := range h.moduleIDs() {
+		modules = append(modules, h.modules[moduleID])
+	}
+	return modules
+}
+
+func (h *Host) EventRepository() EventRepository {
+	return h.eventRepository
+}
+
+//Migrate runs the migrations of all the modules
+func (h *Host) Migrate(ctx context.Context) error {
+	for _, module := range h.Modules() {
+		h.logger.Infof("migrating module '%s'", module.ID())
+		if err := module.Migrate(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//Dispatch sends the command to the dispatcher of the module in the command type. The module handlers receive the
+//command with the module removed from the type (e.g. "blog.CREATE_POST" is handled as "CREATE_POST" by the "blog" module)
+func (h *Host) Dispatch(ctx context.Context, command *Command) error {
+	moduleID, commandType, err := SplitModuleType(command.Type)
+	if err != nil {
+		return err
+	}
+	module := h.Module(moduleID)
+	if module == nil {
+		return NewNotFoundError(ctx, "module_not_found", fmt.Sprintf("no module '%s' registered to handle command '%s'", moduleID, command.Type), nil)
+	}
+	moduleCommand := *command
+	moduleCommand.Type = commandType
+	//the module is recorded on the events the handlers persist
+	err = module.Dispatcher().Dispatch(context.WithValue(ctx, MODULE_ID, moduleID), &moduleCommand)
+	command.ID = moduleCommand.ID
+	return err
+}
+
+//AddSubscriber adds a handler for a module qualified command type to the dispatcher of the module
+func (h *Host) AddSubscriber(command *Command, handler CommandHandler) map[string][]CommandHandler {
+	moduleID, commandType, err := SplitModuleType(command.Type)
+	if err != nil {
+		h.logger.Errorf("unable to subscribe to command '%s': %s", command.Type, err)
+		return h.GetSubscribers()
+	}
+	module := h.Module(moduleID)
+	if module == nil {
+		h.logger.Errorf("unable to subscribe to command '%s': module '%s' is not registered", command.Type, moduleID)
+		return h.GetSubscribers()
+	}
+	moduleCommand := *command
+	moduleCommand.Type = commandType
+	module.Dispatcher().AddSubscriber(&moduleCommand, handler)
+	return h.GetSubscribers()
+}
+
+//GetSubscribers returns the handlers of all the modules keyed by the module qualified command type
+func (h *Host) GetSubscribers() map[string][]CommandHandler {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	subscribers := make(map[string][]CommandHandler)
+	for moduleID, module := range h.modules {
+		for commandType, handlers := range module.Dispatcher().GetSubscribers() {
+			subscribers[ModuleType(moduleID, commandType)] = handlers
+		}
+	}
+	return subscribers
+}
+
+//SubscribeToModule adds a handler for the events of a module to the shared event store. This is how a module reacts
+//to what happens in other modules
+func (h *Host) SubscribeToModule(moduleID string, handler EventHandler) {
+	h.eventRepository.AddSubscriber(ModuleEventHandler(moduleID, handler))
+}
+
+func (h *Host) moduleIDs() []string {
+	var moduleIDs []string
+	for moduleID := range h.modules {
+		moduleIDs = append(moduleIDs, moduleID)
+	}
+	sort.Strings(moduleIDs)
+	return moduleIDs
+}
+
+//ModuleEventHandler wraps an event handler so that it's only called for the events of a module
+func ModuleEventHandler(moduleID string, handler EventHandler) EventHandler {
+	return func(ctx context.Context, event Event) {
+		if event.Meta.Module == moduleID {
+			handler(ctx, event)
+		}
+	}
+}
+
+//ModuleType qualifies a command type with the module that handles it
+func ModuleType(moduleID string, commandType string) string {
+	return moduleID + ModuleSeparator + commandType
+}
+
+//SplitModuleType returns the module and the command type of a module qualified command type
+func SplitModuleType(moduleType string) (string, string, error) {
+	parts := strings.SplitN(moduleType, ModuleSeparator, 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", NewError(fmt.Sprintf("command type '%s' is not qualified with a module", moduleType), nil)
+	}
+	return parts[0], parts[1], nil
+}
@@ -0,0 +1,141 @@
+package weos_test
+
+import (
+	"database/sql"
+	log "github.com/sirupsen/logrus"
+	"github.com/wepala/weos"
+	"golang.org/x/net/context"
+	"testing"
+)
+
+func TestHost_Dispatch(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("error opening database '%s'", err)
+	}
+	db.SetMaxOpenConns(1)
+	eventRepository, err := weos.NewBasicEventRepository(newMigrationTestDB(t), log.New(), false, "", "")
+	if err != nil {
+		t.Fatalf("unexpected error creating repository '%s'", err)
+	}
+	host := weos.NewHost(eventRepository, log.New())
+	projected := make(map[string][]weos.Event)
+	for _, moduleID := range []string{"blog", "notifications"} {
+		module, err := weos.NewApplicationFromConfig(&weos.ApplicationConfig{
+			ModuleID: moduleID,
+			Database: &weos.DBConfig{Driver: "sqlite3"},
+		}, nil, db, nil, eventRepository)
+		if err != nil {
+			t.Fatalf("unexpected error creating module '%s'", err)
+		}
+		moduleID := moduleID
+		err = module.AddProjection(&ProjectionMock{
+			MigrateFunc: func(ctx context.Context) error {
+				return nil
+			},
+			GetEventHandlerFunc: func() weos.EventHandler {
+				return func(ctx context.Context, event weos.Event) {
+					projected[moduleID] = append(projected[moduleID], event)
+				}
+			},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error adding projection '%s'", err)
+		}
+		if err = host.AddModule(module); err != nil {
+			t.Fatalf("unexpected error adding module '%s'", err)
+		}
+	}
+	if err = host.Migrate(context.TODO()); err != nil {
+		t.Fatalf("unexpected error migrating modules '%s'", err)
+	}
+
+	host.AddSubscriber(&weos.Command{Type: "blog.CREATE_POST"}, func(ctx context.Context, command *weos.Command) error {
+		if command.Type != "CREATE_POST" {
+			t.Errorf("expected the module handler to receive '%s', got '%s'", "CREATE_POST", command.Type)
+		}
+		entity := &weos.AggregateRoot{BasicEntity: weos.BasicEntity{ID: "1wqoyqIRsZTtnP3wjKh2Mq1Qp03"}}
+		entity.NewChange(weos.NewEntityEventWithContext(ctx, "POST_CREATED", entity, entity.ID, nil))
+		return eventRepository.Persist(ctx, entity)
+	})
+	notificationsCalled := 0
+	host.AddSubscriber(&weos.Command{Type: "notifications.CREATE_POST"}, func(ctx context.Context, command *weos.Command) error {
+		notificationsCalled += 1
+		return nil
+	})
+	var blogEvents []weos.Event
+	host.SubscribeToModule("blog", func(ctx context.Context, event weos.Event) {
+		blogEvents = append(blogEvents, event)
+	})
+	host.SubscribeToModule("notifications", func(ctx context.Context, event weos.Event) {
+		t.Errorf("expected only events from the notifications module, got event from '%s'", event.Meta.Module)
+	})
+
+	command := &weos.Command{Type: "blog.CREATE_POST"}
+	if err = host.Dispatch(context.TODO(), command); err != nil {
+		t.Fatalf("unexpected error dispatching command '%s'", err)
+	}
+	if command.ID == "" {
+		t.Error("expected the command id to be set")
+	}
+	if notificationsCalled != 0 {
+		t.Errorf("expected the command to only be handled by the blog module")
+	}
+	if len(blogEvents) != 1 {
+		t.Fatalf("expected %d blog event, got %d", 1, len(blogEvents))
+	}
+	if blogEvents[0].Meta.Module != "blog" {
+		t.Errorf("expected the event module to be '%s', got '%s'", "blog", blogEvents[0].Meta.Module)
+	}
+	if len(projected["blog"]) != 1 || len(projected["notifications"]) != 0 {
+		t.Errorf("expected the event to only be projected by the blog module, got %d blog and %d notifications events", len(projected["blog"]), len(projected["notifications"]))
+	}
+	if _, ok := host.GetSubscribers()["notifications.CREATE_POST"]; !ok {
+		t.Error("expected the subscribers to be keyed by module qualified type")
+	}
+
+	t.Run("unqualified command type", func(t *testing.T) {
+		if err := host.Dispatch(context.TODO(), &weos.Command{Type: "CREATE_POST"}); err == nil {
+			t.Error("expected an error dispatching a command without a module")
+		}
+	})
+
+	t.Run("unknown module", func(t *testing.T) {
+		if err := host.Dispatch(context.TODO(), &weos.Command{Type: "shop.CREATE_ORDER"}); err == nil {
+			t.Error("expected an error dispatching a command to a module that isn't registered")
+		}
+	})
+
+	t.Run("module must share the event repository", func(t *testing.T) {
+		module, err := weos.NewApplicationFromConfig(&weos.ApplicationConfig{
+			ModuleID: "shop",
+			Database: &weos.DBConfig{Driver: "sqlite3"},
+		}, nil, db, nil, nil)
+		if err != nil {
+			t.Fatalf("unexpected error creating module '%s'", err)
+		}
+		if err = host.AddModule(module); err == nil {
+			t.Error("expected an error adding a module with its own event repository")
+		}
+	})
+
+	t.Run("events persisted outside the host", func(t *testing.T) {
+		entity := &weos.AggregateRoot{BasicEntity: weos.BasicEntity{ID: "1wqoyqIRsZTtnP3wjKh2Mq1Qp04"}}
+		entity.NewChange(weos.NewEntityEventWithContext(context.TODO(), "POST_CREATED", entity, entity.ID, nil))
+		if err := host.Module("blog").EventRepository().Persist(context.TODO(), entity); err != nil {
+			t.Fatalf("unexpected error persisting event '%s'", err)
+		}
+		if len(projected["blog"]) != 2 {
+			t.Fatalf("expected the module to project %d events, got %d", 2, len(projected["blog"]))
+		}
+		if projected["blog"][1].Meta.Module != "blog" {
+			t.Errorf("expected the event module to be '%s', got '%s'", "blog", projected["blog"][1].Meta.Module)
+		}
+	})
+
+	t.Run("duplicate module", func(t *testing.T) {
+		if err := host.AddModule(host.Module("blog")); err == nil {
+			t.Error("expected an error adding a module that is already registered")
+		}
+	})
+}
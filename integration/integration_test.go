@@ -1,6 +1,7 @@
 package integration_test
 
 import (
+	"bytes"
 	"database/sql"
 	"flag"
 	"fmt"
@@ -9,10 +10,12 @@ import (
 	log "github.com/sirupsen/logrus"
 	"github.com/wepala/weos"
 	"golang.org/x/net/context"
+	"gorm.io/datatypes"
 	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -86,7 +89,7 @@ func TestMain(m *testing.M) {
 }
 
 func TestEventRepositoryGorm_Persist(t *testing.T) {
-	eventRepository, err := weos.NewBasicEventRepository(gormDB, log.New(), false, "accountID", "applicationID")
+	eventRepository, err := weos.NewBasicEventRepository(gormDB, log.New(), false, "", "applicationID")
 	if err != nil {
 		t.Fatalf("error creating application '%s'", err)
 	}
@@ -125,7 +128,7 @@ func TestEventRepositoryGorm_Persist(t *testing.T) {
 		t.Errorf("expected event handlers to be called %d time, called %d times", 1, eventHandlerCalled)
 	}
 
-	rows, err := db.Query("SELECT entity_id,type, root_id,application_id FROM gorm_events WHERE entity_id  = $1", "some id")
+	rows, err := db.Query("SELECT entity_id,type, account_id,application_id FROM gorm_events WHERE entity_id  = $1", "some id")
 	if err != nil {
 		t.Fatalf("error retrieving events '%s'", err)
 	}
@@ -142,7 +145,7 @@ func TestEventRepositoryGorm_Persist(t *testing.T) {
 		}
 
 		if accountID != "123" {
-			t.Errorf("expected the account id to be '%s', got '%s'", "accountID", "123")
+			t.Errorf("expected the account id to be '%s', got '%s'", "123", accountID)
 		}
 
 		if applicationID != "applicationID" {
@@ -321,3 +324,326 @@ func TestSaveAggregateEvents(t *testing.T) {
 		t.Error("expected the list of new changes to be cleared")
 	}
 }
+
+func TestEventRepositoryGorm_HealthCheck(t *testing.T) {
+	eventRepository, err := weos.NewBasicEventRepository(gormDB, log.New(), false, "accountID", "applicationID")
+	if err != nil {
+		t.Fatalf("error creating application '%s'", err)
+	}
+	err = eventRepository.(*weos.EventRepositoryGorm).Migrate(context.Background())
+	if err != nil {
+		t.Fatalf("failed to run migrations")
+	}
+
+	err = eventRepository.(weos.HealthChecker).HealthCheck(context.Background())
+	if err != nil {
+		t.Errorf("expected the event repository to be healthy, got '%s'", err)
+	}
+}
+
+func TestEventRepositoryGorm_TenantIsolation(t *testing.T) {
+	gormDB.Where("1 = 1").Unscoped().Delete(weos.GormEvent{})
+	sharedRepository, err := weos.NewBasicEventRepository(gormDB, log.New(), false, "", "applicationID")
+	if err != nil {
+		t.Fatalf("error creating application '%s'", err)
+	}
+	err = sharedRepository.(*weos.EventRepositoryGorm).Migrate(context.Background())
+	if err != nil {
+		t.Fatalf("failed to run migrations")
+	}
+
+	for _, accountID := range []string{"account1", "account2"} {
+		entity := &weos.AggregateRoot{
+			BasicEntity: weos.BasicEntity{ID: "1wqoyqIRsZTtnP3wjKh2Mq1Qp03"},
+		}
+		entity.NewChange(weos.NewEntityEvent("CREATE_POST", entity, "1wqoyqIRsZTtnP3wjKh2Mq1Qp03", &struct {
+			Title string `json:"title"`
+		}{Title: "First Post"}))
+		err = sharedRepository.Persist(context.WithValue(context.TODO(), weos.ACCOUNT_ID, accountID), entity)
+		if err != nil {
+			t.Fatalf("error encountered persisting events '%s'", err)
+		}
+	}
+
+	t.Run("reads are scoped to the repository account", func(t *testing.T) {
+		eventRepository, err := weos.NewBasicEventRepository(gormDB, log.New(), false, "account1", "applicationID")
+		if err != nil {
+			t.Fatalf("error creating application '%s'", err)
+		}
+		events, err := eventRepository.GetByAggregate("1wqoyqIRsZTtnP3wjKh2Mq1Qp03")
+		if err != nil {
+			t.Fatalf("encountered error getting aggregate '%s'", err)
+		}
+		if len(events) != 1 {
+			t.Fatalf("expected %d events got %d", 1, len(events))
+		}
+		if events[0].Meta.AccountID != "account1" {
+			t.Errorf("expected the account to be '%s', got '%s'", "account1", events[0].Meta.AccountID)
+		}
+	})
+
+	t.Run("reads are scoped to the account in the context", func(t *testing.T) {
+		//handlers only have the EventRepository interface
+		eventRepository, err := sharedRepository.WithContext(context.WithValue(context.TODO(), weos.ACCOUNT_ID, "account2"))
+		if err != nil {
+			t.Fatalf("unexpected error scoping repository '%s'", err)
+		}
+		events, err := eventRepository.GetByAggregate("1wqoyqIRsZTtnP3wjKh2Mq1Qp03")
+		if err != nil {
+			t.Fatalf("encountered error getting aggregate '%s'", err)
+		}
+		if len(events) != 1 || events[0].Meta.AccountID != "account2" {
+			t.Errorf("expected only the events for account '%s'", "account2")
+		}
+	})
+
+	t.Run("the command metadata doesn't choose the account", func(t *testing.T) {
+		ctx := context.WithValue(context.TODO(), weos.COMMAND_METADATA, weos.CommandMetadata{AccountID: "account2"})
+		if _, err := sharedRepository.WithContext(ctx); err == nil {
+			t.Error("expected an error scoping a shared repository without an account in the context")
+		}
+	})
+
+	t.Run("events stored before accounts are backfilled", func(t *testing.T) {
+		entity := &weos.AggregateRoot{
+			BasicEntity: weos.BasicEntity{ID: "1wqoyqIRsZTtnP3wjKh2Mq1Qp04"},
+		}
+		entity.NewChange(weos.NewEntityEvent("CREATE_POST", entity, "1wqoyqIRsZTtnP3wjKh2Mq1Qp04", &struct {
+			Title string `json:"title"`
+		}{Title: "Old Post"}))
+		err = sharedRepository.Persist(context.TODO(), entity)
+		if err != nil {
+			t.Fatalf("error encountered persisting events '%s'", err)
+		}
+		eventRepository, err := weos.NewBasicEventRepository(gormDB, log.New(), false, "account1", "applicationID")
+		if err != nil {
+			t.Fatalf("error creating application '%s'", err)
+		}
+		//the migrations of a repository with an account don't backfill since they only run once per database
+		if err = eventRepository.(*weos.EventRepositoryGorm).Migrate(context.Background()); err != nil {
+			t.Fatalf("failed to run migrations '%s'", err)
+		}
+		if events, _ := eventRepository.GetByAggregate("1wqoyqIRsZTtnP3wjKh2Mq1Qp04"); len(events) != 0 {
+			t.Errorf("expected the migrations not to backfill the account, got %d events", len(events))
+		}
+		if _, err = eventRepository.(*weos.EventRepositoryGorm).BackfillAccount(context.Background(), "account1", weos.EventFilter{RootID: "1wqoyqIRsZTtnP3wjKh2Mq1Qp04"}); err != nil {
+			t.Fatalf("unexpected error backfilling events '%s'", err)
+		}
+		events, err := eventRepository.GetByAggregate("1wqoyqIRsZTtnP3wjKh2Mq1Qp04")
+		if err != nil {
+			t.Fatalf("encountered error getting aggregate '%s'", err)
+		}
+		if len(events) != 1 || events[0].Meta.AccountID != "account1" {
+			t.Errorf("expected the event to be backfilled with the account '%s'", "account1")
+		}
+	})
+
+	t.Run("shared repositories backfill an account at a time", func(t *testing.T) {
+		entity := &weos.AggregateRoot{
+			BasicEntity: weos.BasicEntity{ID: "1wqoyqIRsZTtnP3wjKh2Mq1Qp05"},
+		}
+		entity.NewChange(weos.NewEntityEvent("CREATE_POST", entity, "1wqoyqIRsZTtnP3wjKh2Mq1Qp05", &struct {
+			Title string `json:"title"`
+		}{Title: "Old Post"}))
+		err = sharedRepository.Persist(context.TODO(), entity)
+		if err != nil {
+			t.Fatalf("error encountered persisting events '%s'", err)
+		}
+		backfilled, err := sharedRepository.(*weos.EventRepositoryGorm).BackfillAccount(context.Background(), "account2", weos.EventFilter{RootID: "1wqoyqIRsZTtnP3wjKh2Mq1Qp05"})
+		if err != nil {
+			t.Fatalf("unexpected error backfilling events '%s'", err)
+		}
+		if backfilled != 1 {
+			t.Errorf("expected %d event to be backfilled, got %d", 1, backfilled)
+		}
+		eventRepository, err := sharedRepository.WithContext(context.WithValue(context.TODO(), weos.ACCOUNT_ID, "account2"))
+		if err != nil {
+			t.Fatalf("unexpected error scoping repository '%s'", err)
+		}
+		events, _ := eventRepository.GetByAggregate("1wqoyqIRsZTtnP3wjKh2Mq1Qp05")
+		if len(events) != 1 {
+			t.Errorf("expected %d event for the account, got %d", 1, len(events))
+		}
+		if _, err = sharedRepository.(*weos.EventRepositoryGorm).BackfillAccount(context.Background(), "", weos.EventFilter{}); err == nil {
+			t.Error("expected an error backfilling without an account")
+		}
+	})
+
+	t.Run("cross tenant reads are refused", func(t *testing.T) {
+		eventRepository, err := weos.NewBasicEventRepository(gormDB, log.New(), false, "account1", "applicationID")
+		if err != nil {
+			t.Fatalf("error creating application '%s'", err)
+		}
+		_, err = eventRepository.(*weos.EventRepositoryGorm).WithContext(context.WithValue(context.TODO(), weos.ACCOUNT_ID, "account2"))
+		if err == nil {
+			t.Error("expected an error scoping the repository to another account")
+		}
+	})
+
+	t.Run("cross tenant writes are refused", func(t *testing.T) {
+		eventRepository, err := weos.NewBasicEventRepository(gormDB, log.New(), false, "account1", "applicationID")
+		if err != nil {
+			t.Fatalf("error creating application '%s'", err)
+		}
+		entity := &weos.AggregateRoot{
+			BasicEntity: weos.BasicEntity{ID: "1wqoyqIRsZTtnP3wjKh2Mq1Qp03"},
+		}
+		event := weos.NewEntityEvent("UPDATE_POST", entity, "1wqoyqIRsZTtnP3wjKh2Mq1Qp03", nil)
+		event.Meta.AccountID = "account2"
+		entity.NewChange(event)
+		err = eventRepository.Persist(context.TODO(), entity)
+		if err == nil {
+			t.Error("expected an error persisting an event for another account")
+		}
+
+		err = eventRepository.Persist(context.WithValue(context.TODO(), weos.ACCOUNT_ID, "account2"), &weos.AggregateRoot{})
+		if err == nil {
+			t.Error("expected an error persisting with the context of another account")
+		}
+	})
+}
+
+func TestEventRepositoryGorm_Migrate(t *testing.T) {
+	type GormEvent struct {
+		gorm.Model
+		ID            string
+		EntityID      string `gorm:"index"`
+		EntityType    string `gorm:"index"`
+		Payload       datatypes.JSON
+		Type          string `gorm:"index"`
+		RootID        string `gorm:"index"`
+		ApplicationID string `gorm:"index"`
+		User          string `gorm:"index"`
+		SequenceNo    int64
+	}
+	//setup the events table the way it was before versioned migrations
+	err = gormDB.Migrator().DropTable(&weos.GormEvent{}, &weos.SchemaMigration{})
+	if err != nil {
+		t.Fatalf("error dropping tables '%s'", err)
+	}
+	err = gormDB.AutoMigrate(&GormEvent{})
+	if err != nil {
+		t.Fatalf("error creating legacy events table '%s'", err)
+	}
+
+	eventRepository, err := weos.NewBasicEventRepository(gormDB, log.New(), false, "accountID", "applicationID")
+	if err != nil {
+		t.Fatalf("error creating application '%s'", err)
+	}
+	err = eventRepository.Migrate(context.Background())
+	if err != nil {
+		t.Fatalf("error running migrations '%s'", err)
+	}
+
+	if !gormDB.Migrator().HasColumn(&weos.GormEvent{}, "AccountID") {
+		t.Error("expected the account column to be added to the events table")
+	}
+	if !gormDB.Migrator().HasColumn(&weos.GormEvent{}, "CorrelationID") || !gormDB.Migrator().HasColumn(&weos.GormEvent{}, "CausationID") {
+		t.Error("expected the correlation and causation columns to be added to the events table")
+	}
+	if !gormDB.Migrator().HasColumn(&weos.GormEvent{}, "RequestID") {
+		t.Error("expected the request column to be added to the events table")
+	}
+
+	var applied int64
+	gormDB.Model(&weos.SchemaMigration{}).Where("namespace = ?", "events").Count(&applied)
+	if applied != int64(len(eventRepository.(weos.MigrationProvider).Migrations())) {
+		t.Errorf("expected all the event store migrations to be recorded, got %d", applied)
+	}
+}
+
+func TestEventRepositoryGorm_ExportImport(t *testing.T) {
+	gormDB.Where("1 = 1").Unscoped().Delete(weos.GormEvent{})
+	eventRepository, err := weos.NewBasicEventRepository(gormDB, log.New(), false, "", "applicationID")
+	if err != nil {
+		t.Fatalf("error creating application '%s'", err)
+	}
+	err = eventRepository.Migrate(context.Background())
+	if err != nil {
+		t.Fatalf("failed to run migrations")
+	}
+	repository := eventRepository.(*weos.EventRepositoryGorm)
+
+	for _, rootID := range []string{"1wqoyqIRsZTtnP3wjKh2Mq1Qp03", "1wqoyqIRsZTtnP3wjKh2Mq1Qp04"} {
+		entity := &weos.AggregateRoot{
+			BasicEntity: weos.BasicEntity{ID: rootID},
+		}
+		entity.NewChange(weos.NewEntityEvent("CREATE_POST", entity, rootID, &struct {
+			Title string `json:"title"`
+		}{Title: "First Post"}))
+		entity.NewChange(weos.NewEntityEvent("UPDATE_POST", entity, rootID, &struct {
+			Title string `json:"title"`
+		}{Title: "Updated Post"}))
+		err = eventRepository.Persist(context.TODO(), entity)
+		if err != nil {
+			t.Fatalf("error encountered persisting events '%s'", err)
+		}
+	}
+
+	buffer := &bytes.Buffer{}
+	exported, err := repository.Export(context.TODO(), buffer, weos.EventFilter{RootID: "1wqoyqIRsZTtnP3wjKh2Mq1Qp03", ApplicationID: "applicationID"})
+	if err != nil {
+		t.Fatalf("unexpected error exporting events '%s'", err)
+	}
+	if exported != 2 {
+		t.Fatalf("expected %d events to be exported, got %d", 2, exported)
+	}
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected %d lines, got %d", 2, len(lines))
+	}
+	original, err := eventRepository.GetByAggregate("1wqoyqIRsZTtnP3wjKh2Mq1Qp03")
+	if err != nil {
+		t.Fatalf("unexpected error getting events '%s'", err)
+	}
+
+	t.Run("import into an empty store", func(t *testing.T) {
+		gormDB.Where("1 = 1").Unscoped().Delete(weos.GormEvent{})
+		imported, err := repository.Import(context.TODO(), bytes.NewReader(buffer.Bytes()))
+		if err != nil {
+			t.Fatalf("unexpected error importing events '%s'", err)
+		}
+		if imported != 2 {
+			t.Fatalf("expected %d events to be imported, got %d", 2, imported)
+		}
+		events, err := eventRepository.GetByAggregate("1wqoyqIRsZTtnP3wjKh2Mq1Qp03")
+		if err != nil {
+			t.Fatalf("unexpected error getting events '%s'", err)
+		}
+		if len(events) != len(original) {
+			t.Fatalf("expected %d events, got %d", len(original), len(events))
+		}
+		for i, event := range events {
+			if event.ID != original[i].ID || event.Meta.SequenceNo != original[i].Meta.SequenceNo || event.Meta.Created != original[i].Meta.Created {
+				t.Errorf("expected event '%s' to be imported as is, got '%s'", original[i].ID, event.ID)
+			}
+			if string(event.Payload) != string(original[i].Payload) {
+				t.Errorf("expected the payload to be '%s', got '%s'", original[i].Payload, event.Payload)
+			}
+		}
+	})
+
+	t.Run("re-running the import is idempotent", func(t *testing.T) {
+		imported, err := repository.Import(context.TODO(), bytes.NewReader(buffer.Bytes()))
+		if err != nil {
+			t.Fatalf("unexpected error importing events '%s'", err)
+		}
+		if imported != 0 {
+			t.Errorf("expected no events to be imported, got %d", imported)
+		}
+	})
+
+	t.Run("invalid events are rejected", func(t *testing.T) {
+		_, err := repository.Import(context.TODO(), strings.NewReader(`{"id":"1wqoyqIRsZTtnP3wjKh2Mq1Qp05","type":"CREATE_POST","version":1}`+"\n"))
+		if err == nil {
+			t.Fatal("expected an error importing an event without an entity")
+		}
+		events, err := repository.GetEvents(weos.EventFilter{ID: "1wqoyqIRsZTtnP3wjKh2Mq1Qp05"})
+		if err != nil {
+			t.Fatalf("unexpected error getting events '%s'", err)
+		}
+		if len(events) != 0 {
+			t.Error("expected the invalid event not to be imported")
+		}
+	})
+}
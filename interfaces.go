@@ -52,8 +52,15 @@ type EventRepository interface {
 	//GetByAggregateAndSequenceRange this returns a sequence of events.
 	//Deprecated: 08/17/2021 This isn't actually used and would need to be updated to account for the new RootID property on events
 	GetByAggregateAndSequenceRange(ID string, start int64, end int64) ([]*Event, error)
+	//GetByCorrelationID returns all the events that were created as a result of the command that started the correlation
+	GetByCorrelationID(correlationID string) ([]*Event, error)
+	//GetEvents returns the events that match the filter in the order they were stored
+	GetEvents(filter EventFilter) ([]*Event, error)
 	AddSubscriber(handler EventHandler)
 	GetSubscribers() ([]EventHandler, error)
+	//WithContext returns the repository scoped to the authenticated account in the context. Handlers should read events
+	//through it so that a repository shared by tenants only returns the events of the account making the request
+	WithContext(ctxt context.Context) (EventRepository, error)
 }
 
 type Datastore interface {
@@ -0,0 +1,276 @@
+package weos
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"golang.org/x/net/context"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+//JWTClaims are the claims of a verified token
+type JWTClaims map[string]interface{}
+
+//String returns the claim if it's a string
+func (c JWTClaims) String(name string) string {
+	if value, ok := c[name].(string); ok {
+		return value
+	}
+	return ""
+}
+
+//Strings returns the claim if it's a list of strings (or a single string)
+func (c JWTClaims) Strings(name string) []string {
+	switch value := c[name].(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		var values []string
+		for _, v := range value {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+//JWTAuthenticator verifies JSON Web Tokens signed with HS256 (using the application secret) or RS256 (using the keys
+//in a JWKS file) and adds the user and account in the claims to the request context
+type JWTAuthenticator struct {
+	secret []byte
+	keys   map[string]*rsa.PublicKey
+	//Issuer and Audience are checked if they are set
+	Issuer   string
+	Audience string
+	//Leeway is the clock skew allowed when checking the expiry and not before times
+	Leeway time.Duration
+	//Required rejects requests without a token. Otherwise they continue without a user
+	Required bool
+	//AllowNoExpiry accepts tokens without an expiry (exp) claim. Tokens must expire by default
+	AllowNoExpiry bool
+	//the claims that are mapped to the context
+	UserClaim        string
+	AccountClaim     string
+	RolesClaim       string
+	PermissionsClaim string
+	//Logger is used to log why tokens are rejected. The standard logger is used if it's nil
+	Logger Log
+}
+
+//NewJWTAuthenticator creates an authenticator that uses the secret and the JWKS file in the config
+func NewJWTAuthenticator(config *ApplicationConfig) (*JWTAuthenticator, error) {
+	authenticator := &JWTAuthenticator{
+		keys:             make(map[string]*rsa.PublicKey),
+		Leeway:           time.Minute,
+		UserClaim:        "sub",
+		AccountClaim:     "account_id",
+		RolesClaim:       "roles",
+		PermissionsClaim: "permissions",
+	}
+	if config.JWTSecret != "" {
+		authenticator.secret = []byte(config.JWTSecret)
+	} else if config.Secret != "" && config.DeriveJWTKey {
+		authenticator.secret = DeriveKey(config.Secret, "jwt")
+	} else if config.Secret != "" {
+		authenticator.secret = []byte(config.Secret)
+	}
+	if config.JWKSFile != "" {
+		data, err := ioutil.ReadFile(config.JWKSFile)
+		if err != nil {
+			return nil, NewError(fmt.Sprintf("error reading jwks file '%s'", config.JWKSFile), err)
+		}
+		if authenticator.keys, err = ParseJWKS(data); err != nil {
+			return nil, NewError(fmt.Sprintf("error parsing jwks file '%s'", config.JWKSFile), err)
+		}
+	}
+	if authenticator.secret == nil && len(authenticator.keys) == 0 {
+		return nil, NewError("a secret or a jwks file is required to verify tokens", nil)
+	}
+	return authenticator, nil
+}
+
+//ParseJWKS returns the RSA keys in a JSON Web Key Set by key id
+func ParseJWKS(data []byte) (map[string]*rsa.PublicKey, error) {
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]*rsa.PublicKey)
+	for _, key := range set.Keys {
+		if key.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(key.N)
+		if err != nil {
+			return nil, NewError(fmt.Sprintf("invalid modulus for key '%s'", key.Kid), err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(key.E)
+		if err != nil {
+			return nil, NewError(fmt.Sprintf("invalid exponent for key '%s'", key.Kid), err)
+		}
+		keys[key.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	return keys, nil
+}
+
+//Verify checks the signature and the time, issuer, audience and user claims of the token and returns the claims
+func (a *JWTAuthenticator) Verify(token string) (JWTClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, NewError("the token is malformed", nil)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTSegment(parts[0], &header); err != nil {
+		return nil, NewError("the token header is invalid", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, NewError("the token signature is invalid", err)
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+	switch header.Alg {
+	case "HS256":
+		if a.secret == nil {
+			return nil, NewError("HS256 tokens are not accepted", nil)
+		}
+		mac := hmac.New(sha256.New, a.secret)
+		mac.Write(signed)
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return nil, NewError("the token signature is invalid", nil)
+		}
+	case "RS256":
+		key, err := a.key(header.Kid)
+		if err != nil {
+			return nil, err
+		}
+		digest := sha256.Sum256(signed)
+		if err = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+			return nil, NewError("the token signature is invalid", err)
+		}
+	default:
+		return nil, NewError(fmt.Sprintf("the token algorithm '%s' is not supported", header.Alg), nil)
+	}
+	claims := JWTClaims{}
+	if err = decodeJWTSegment(parts[1], &claims); err != nil {
+		return nil, NewError("the token claims are invalid", err)
+	}
+	now := time.Now()
+	expires, ok := claims["exp"].(float64)
+	if !ok && !a.AllowNoExpiry {
+		return nil, NewError("the token has no expiry", nil)
+	}
+	if ok && now.After(time.Unix(int64(expires), 0).Add(a.Leeway)) {
+		return nil, NewError("the token has expired", nil)
+	}
+	if notBefore, ok := claims["nbf"].(float64); ok && now.Add(a.Leeway).Before(time.Unix(int64(notBefore), 0)) {
+		return nil, NewError("the token is not valid yet", nil)
+	}
+	if a.Issuer != "" && claims.String("iss") != a.Issuer {
+		return nil, NewError("the token issuer is not accepted", nil)
+	}
+	if a.Audience != "" {
+		accepted := false
+		for _, audience := range claims.Strings("aud") {
+			if audience == a.Audience {
+				accepted = true
+				break
+			}
+		}
+		if !accepted {
+			return nil, NewError("the token audience is not accepted", nil)
+		}
+	}
+	if claims.String(a.UserClaim) == "" {
+		return nil, NewError("the token has no user", nil)
+	}
+	return claims, nil
+}
+
+func (a *JWTAuthenticator) key(kid string) (*rsa.PublicKey, error) {
+	if key, ok := a.keys[kid]; ok {
+		return key, nil
+	}
+	//tokens without a key id can be used if there is only one key
+	if kid == "" && len(a.keys) == 1 {
+		for _, key := range a.keys {
+			return key, nil
+		}
+	}
+	return nil, NewError(fmt.Sprintf("the token key '%s' is not known", kid), nil)
+}
+
+//Middleware authenticates requests with a bearer token. The user and account in the token are added to the context
+//and requests with an invalid token are rejected
+func (a *JWTAuthenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := bearerToken(r)
+		if token == "" {
+			if a.Required {
+				writeError(w, r, a.Logger, NewUnauthorizedError(r.Context(), "missing_token", "a bearer token is required", nil))
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		claims, err := a.Verify(token)
+		if err != nil {
+			//the reason is only logged so that clients can't probe how tokens are verified
+			LoggerWithContext(r.Context(), defaultLogger(a.Logger)).Infof("invalid token: %s", errorChain(err))
+			writeError(w, r, a.Logger, NewUnauthorizedError(r.Context(), "invalid_token", "the token is invalid", nil))
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(a.Context(r.Context(), claims)))
+	})
+}
+
+//Context adds the user and account in the claims to the context. The account is always set (even if the token has none)
+//so that the account can't come from anywhere else (e.g. the command metadata)
+func (a *JWTAuthenticator) Context(ctx context.Context, claims JWTClaims) context.Context {
+	user := &User{
+		BasicEntity: BasicEntity{ID: claims.String(a.UserClaim)},
+		Roles:       claims.Strings(a.RolesClaim),
+		Permissions: claims.Strings(a.PermissionsClaim),
+	}
+	ctx = context.WithValue(ctx, USER_ID, user.ID)
+	ctx = context.WithValue(ctx, CURRENT_USER, user)
+	return context.WithValue(ctx, ACCOUNT_ID, claims.String(a.AccountClaim))
+}
+
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return ""
+}
+
+func decodeJWTSegment(segment string, value interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, value)
+}
@@ -0,0 +1,230 @@
+package weos_test
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/wepala/weos"
+	"golang.org/x/net/context"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func signJWT(t *testing.T, header map[string]interface{}, claims map[string]interface{}, sign func(signed []byte) []byte) string {
+	headerJSON, _ := json.Marshal(header)
+	claimsJSON, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(signed)))
+}
+
+func hs256(secret string) func(signed []byte) []byte {
+	return func(signed []byte) []byte {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(signed)
+		return mac.Sum(nil)
+	}
+}
+
+func rs256(t *testing.T, key *rsa.PrivateKey) func(signed []byte) []byte {
+	return func(signed []byte) []byte {
+		digest := sha256.Sum256(signed)
+		signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatalf("unexpected error signing token '%s'", err)
+		}
+		return signature
+	}
+}
+
+func TestJWTAuthenticator_Middleware(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unexpected error generating key '%s'", err)
+	}
+	jwks, _ := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "key-1",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}},
+	})
+	jwksFile, err := ioutil.TempFile("", "jwks*.json")
+	if err != nil {
+		t.Fatalf("unexpected error creating jwks file '%s'", err)
+	}
+	defer os.Remove(jwksFile.Name())
+	jwksFile.Write(jwks)
+	jwksFile.Close()
+
+	authenticator, err := weos.NewJWTAuthenticator(&weos.ApplicationConfig{JWTSecret: "secret", JWKSFile: jwksFile.Name()})
+	if err != nil {
+		t.Fatalf("unexpected error creating authenticator '%s'", err)
+	}
+	authenticator.Audience = "weos"
+
+	var user *weos.User
+	var accountID string
+	handler := authenticator.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user = weos.GetCurrentUser(r.Context())
+		accountID = weos.GetAccount(r.Context())
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	claims := map[string]interface{}{
+		"sub":        "user-1",
+		"account_id": "account-1",
+		"roles":      []string{"editor"},
+		"aud":        "weos",
+		"exp":        time.Now().Add(time.Hour).Unix(),
+	}
+	request := func(token string) *httptest.ResponseRecorder {
+		user, accountID = nil, ""
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, r)
+		return rw
+	}
+
+	valid := []struct {
+		name  string
+		token string
+	}{
+		{"HS256", signJWT(t, map[string]interface{}{"alg": "HS256", "typ": "JWT"}, claims, hs256("secret"))},
+		{"RS256", signJWT(t, map[string]interface{}{"alg": "RS256", "kid": "key-1"}, claims, rs256(t, key))},
+	}
+	for _, test := range valid {
+		t.Run(test.name, func(t *testing.T) {
+			rw := request(test.token)
+			if rw.Code != http.StatusNoContent {
+				t.Fatalf("expected the status to be %d, got %d: %s", http.StatusNoContent, rw.Code, rw.Body.String())
+			}
+			if user == nil || user.ID != "user-1" || !user.HasRole("editor") {
+				t.Errorf("expected the user from the token to be in the context, got %v", user)
+			}
+			if accountID != "account-1" {
+				t.Errorf("expected the account to be '%s', got '%s'", "account-1", accountID)
+			}
+		})
+	}
+
+	expired := map[string]interface{}{"sub": "user-1", "aud": "weos", "exp": time.Now().Add(-time.Hour).Unix()}
+	otherAudience := map[string]interface{}{"sub": "user-1", "aud": "other", "exp": time.Now().Add(time.Hour).Unix()}
+	noExpiry := map[string]interface{}{"sub": "user-1", "aud": "weos"}
+	noSubject := map[string]interface{}{"aud": "weos", "exp": time.Now().Add(time.Hour).Unix()}
+	invalid := []struct {
+		name  string
+		token string
+	}{
+		{"wrong secret", signJWT(t, map[string]interface{}{"alg": "HS256"}, claims, hs256("wrong"))},
+		{"unknown key", signJWT(t, map[string]interface{}{"alg": "RS256", "kid": "key-2"}, claims, rs256(t, key))},
+		{"unsigned", signJWT(t, map[string]interface{}{"alg": "none"}, claims, func([]byte) []byte { return nil })},
+		{"expired", signJWT(t, map[string]interface{}{"alg": "HS256"}, expired, hs256("secret"))},
+		{"other audience", signJWT(t, map[string]interface{}{"alg": "HS256"}, otherAudience, hs256("secret"))},
+		{"no subject", signJWT(t, map[string]interface{}{"alg": "HS256"}, noSubject, hs256("secret"))},
+		{"no expiry", signJWT(t, map[string]interface{}{"alg": "HS256"}, noExpiry, hs256("secret"))},
+		{"malformed", "not-a-token"},
+	}
+	for _, test := range invalid {
+		t.Run(test.name, func(t *testing.T) {
+			rw := request(test.token)
+			if rw.Code != http.StatusUnauthorized {
+				t.Fatalf("expected the status to be %d, got %d", http.StatusUnauthorized, rw.Code)
+			}
+			if !strings.Contains(rw.Body.String(), `"code":"invalid_token"`) {
+				t.Errorf("expected a WeOS error in the response, got '%s'", rw.Body.String())
+			}
+			if strings.Contains(rw.Body.String(), "cause") {
+				t.Errorf("expected the reason the token is invalid not to be in the response, got '%s'", rw.Body.String())
+			}
+			if user != nil {
+				t.Error("expected the handler not to be called")
+			}
+		})
+	}
+
+	t.Run("tokens without an expiry can be allowed", func(t *testing.T) {
+		authenticator.AllowNoExpiry = true
+		defer func() { authenticator.AllowNoExpiry = false }()
+		if rw := request(signJWT(t, map[string]interface{}{"alg": "HS256"}, noExpiry, hs256("secret"))); rw.Code != http.StatusNoContent {
+			t.Errorf("expected the status to be %d, got %d", http.StatusNoContent, rw.Code)
+		}
+	})
+
+	t.Run("requests without a token", func(t *testing.T) {
+		if rw := request(""); rw.Code != http.StatusNoContent || user != nil {
+			t.Errorf("expected anonymous requests to continue without a user, got status %d", rw.Code)
+		}
+		authenticator.Required = true
+		defer func() { authenticator.Required = false }()
+		if rw := request(""); rw.Code != http.StatusUnauthorized {
+			t.Errorf("expected the status to be %d, got %d", http.StatusUnauthorized, rw.Code)
+		}
+	})
+}
+
+func TestJWTAuthenticator_Context(t *testing.T) {
+	authenticator, err := weos.NewJWTAuthenticator(&weos.ApplicationConfig{Secret: "secret"})
+	if err != nil {
+		t.Fatalf("unexpected error creating authenticator '%s'", err)
+	}
+	//the token has no account so the command can't choose one
+	ctx := authenticator.Context(context.TODO(), weos.JWTClaims{"sub": "user-1"})
+	dispatcher := &weos.DefaultCommandDispatcher{}
+	dispatcher.AddSubscriber(&weos.Command{Type: "CREATE_POST"}, func(ctx context.Context, command *weos.Command) error {
+		return nil
+	})
+	err = dispatcher.Dispatch(ctx, &weos.Command{Type: "CREATE_POST", Metadata: weos.CommandMetadata{AccountID: "account-2"}})
+	if weos.GetErrorCategory(err) != weos.ErrorCategoryForbidden {
+		t.Errorf("expected a forbidden error, got '%v'", err)
+	}
+}
+
+func TestNewJWTAuthenticator(t *testing.T) {
+	t.Run("tokens are signed with the application secret", func(t *testing.T) {
+		authenticator, err := weos.NewJWTAuthenticator(&weos.ApplicationConfig{Secret: "secret"})
+		if err != nil {
+			t.Fatalf("unexpected error creating authenticator '%s'", err)
+		}
+		claims := map[string]interface{}{"sub": "user-1", "exp": time.Now().Add(time.Hour).Unix()}
+		if _, err = authenticator.Verify(signJWT(t, map[string]interface{}{"alg": "HS256"}, claims, hs256("secret"))); err != nil {
+			t.Errorf("expected a token signed with the application secret to be valid, got '%s'", err)
+		}
+		if _, err = authenticator.Verify(signJWT(t, map[string]interface{}{"alg": "HS256"}, claims, hs256(string(weos.DeriveKey("secret", "jwt"))))); err == nil {
+			t.Error("expected a token signed with the derived key to be invalid unless derivation is enabled")
+		}
+	})
+
+	t.Run("the key can be derived from the application secret", func(t *testing.T) {
+		authenticator, err := weos.NewJWTAuthenticator(&weos.ApplicationConfig{Secret: "secret", DeriveJWTKey: true})
+		if err != nil {
+			t.Fatalf("unexpected error creating authenticator '%s'", err)
+		}
+		claims := map[string]interface{}{"sub": "user-1", "exp": time.Now().Add(time.Hour).Unix()}
+		if _, err = authenticator.Verify(signJWT(t, map[string]interface{}{"alg": "HS256"}, claims, hs256(string(weos.DeriveKey("secret", "jwt"))))); err != nil {
+			t.Errorf("expected a token signed with the derived key to be valid, got '%s'", err)
+		}
+		if _, err = authenticator.Verify(signJWT(t, map[string]interface{}{"alg": "HS256"}, claims, hs256("secret"))); err == nil {
+			t.Error("expected a token signed with the application secret to be invalid")
+		}
+	})
+	if _, err := weos.NewJWTAuthenticator(&weos.ApplicationConfig{}); err == nil {
+		t.Error("expected an error creating an authenticator without a secret or keys")
+	}
+	if _, err := weos.NewJWTAuthenticator(&weos.ApplicationConfig{JWKSFile: fmt.Sprintf("%s/missing-jwks.json", os.TempDir())}); err == nil {
+		t.Error("expected an error creating an authenticator with a missing jwks file")
+	}
+}
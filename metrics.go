@@ -0,0 +1,349 @@
+package weos
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//UnknownLabel is the label commands and queries without a handler are counted under. Their types come from clients so
+//counting each one would let a client create as many series as it likes
+const UnknownLabel = "unknown"
+
+//DefaultBuckets are the histogram buckets (in seconds) used for durations
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type collector interface {
+	write(w io.Writer) error
+}
+
+//Metrics is a registry of the counters and histograms collected by the application. They are exposed in the prometheus
+//text exposition format so that they can be scraped without the application depending on a prometheus server
+type Metrics struct {
+	CommandsDispatched   *CounterVec
+	CommandDuration      *HistogramVec
+	CommandErrors        *CounterVec
+	CommandPanics        *CounterVec
+	QueriesDispatched    *CounterVec
+	QueryDuration        *HistogramVec
+	QueryErrors          *CounterVec
+	EventsDispatched     *CounterVec
+	EventHandlerDuration *HistogramVec
+	EventHandlerPanics   *CounterVec
+	EventsPersisted      *CounterVec
+	PersistDuration      *HistogramVec
+	PersistErrors        *CounterVec
+	collectors           []collector
+	mutex                sync.RWMutex
+}
+
+func NewMetrics() *Metrics {
+	metrics := &Metrics{}
+	metrics.CommandsDispatched = metrics.NewCounter("weos_commands_dispatched_total", "Number of commands dispatched", "command")
+	metrics.CommandDuration = metrics.NewHistogram("weos_command_handler_duration_seconds", "Time taken by command handlers", DefaultBuckets, "command")
+	metrics.CommandErrors = metrics.NewCounter("weos_command_errors_total", "Number of command handlers that returned an error", "command")
+	metrics.CommandPanics = metrics.NewCounter("weos_command_handler_panics_total", "Number of command handlers that panicked", "command")
+	metrics.QueriesDispatched = metrics.NewCounter("weos_queries_dispatched_total", "Number of queries dispatched", "query")
+	metrics.QueryDuration = metrics.NewHistogram("weos_query_handler_duration_seconds", "Time taken by query handlers", DefaultBuckets, "query")
+	metrics.QueryErrors = metrics.NewCounter("weos_query_errors_total", "Number of query handlers that returned an error", "query")
+	metrics.EventsDispatched = metrics.NewCounter("weos_events_dispatched_total", "Number of events dispatched to event handlers", "event")
+	metrics.EventHandlerDuration = metrics.NewHistogram("weos_event_handler_duration_seconds", "Time taken by event handlers", DefaultBuckets, "event")
+	metrics.EventHandlerPanics = metrics.NewCounter("weos_event_handler_panics_total", "Number of event handlers that panicked", "event")
+	metrics.EventsPersisted = metrics.NewCounter("weos_events_persisted_total", "Number of events persisted to the event store", "event")
+	metrics.PersistDuration = metrics.NewHistogram("weos_event_persist_duration_seconds", "Time taken to persist events", DefaultBuckets)
+	metrics.PersistErrors = metrics.NewCounter("weos_event_persist_errors_total", "Number of errors persisting events")
+	return metrics
+}
+
+//NewCounter creates a counter and adds it to the registry
+func (m *Metrics) NewCounter(name string, help string, labels ...string) *CounterVec {
+	counter := &CounterVec{name: name, help: help, labels: labels, values: make(map[string]*counterValue)}
+	m.mutex.Lock()
+	m.collectors = append(m.collectors, counter)
+	m.mutex.Unlock()
+	return counter
+}
+
+//NewHistogram creates a histogram and adds it to the registry
+func (m *Metrics) NewHistogram(name string, help string, buckets []float64, labels ...string) *HistogramVec {
+	sortedBuckets := append([]float64{}, buckets...)
+	sort.Float64s(sortedBuckets)
+	histogram := &HistogramVec{name: name, help: help, labels: labels, buckets: sortedBuckets, values: make(map[string]*histogramValue)}
+	m.mutex.Lock()
+	m.collectors = append(m.collectors, histogram)
+	m.mutex.Unlock()
+	return histogram
+}
+
+//Write writes all the metrics in the prometheus text format
+func (m *Metrics) Write(w io.Writer) error {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	buffered := bufio.NewWriter(w)
+	for _, c := range m.collectors {
+		if err := c.write(buffered); err != nil {
+			return err
+		}
+	}
+	return buffered.Flush()
+}
+
+//Handler exposes the metrics so that they can be scraped
+func (m *Metrics) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := m.Write(w); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+//the helpers below are safe to call on a nil registry so that components work without metrics configured
+
+func (m *Metrics) observeCommand(commandType string, duration time.Duration, err error, panicked bool) {
+	if m == nil {
+		return
+	}
+	m.CommandDuration.Observe(duration.Seconds(), commandType)
+	if panicked {
+		m.CommandPanics.Inc(commandType)
+	}
+	if err != nil {
+		m.CommandErrors.Inc(commandType)
+	}
+}
+
+func (m *Metrics) commandDispatched(commandType string) {
+	if m == nil {
+		return
+	}
+	m.CommandsDispatched.Inc(commandType)
+}
+
+func (m *Metrics) observeQuery(queryType string, duration time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	m.QueriesDispatched.Inc(queryType)
+	m.QueryDuration.Observe(duration.Seconds(), queryType)
+	if err != nil {
+		m.QueryErrors.Inc(queryType)
+	}
+}
+
+func (m *Metrics) observeEventHandler(eventType string, duration time.Duration, panicked bool) {
+	if m == nil {
+		return
+	}
+	m.EventHandlerDuration.Observe(duration.Seconds(), eventType)
+	if panicked {
+		m.EventHandlerPanics.Inc(eventType)
+	}
+}
+
+func (m *Metrics) eventDispatched(eventType string) {
+	if m == nil {
+		return
+	}
+	m.EventsDispatched.Inc(eventType)
+}
+
+func (m *Metrics) observePersist(events []Entity, duration time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	m.PersistDuration.Observe(duration.Seconds())
+	if err != nil {
+		m.PersistErrors.Inc()
+		return
+	}
+	for _, entity := range events {
+		if event, ok := entity.(*Event); ok {
+			m.EventsPersisted.Inc(event.Type)
+		}
+	}
+}
+
+type counterValue struct {
+	labelValues []string
+	value       float64
+}
+
+//CounterVec is a counter partitioned by label values
+type CounterVec struct {
+	name   string
+	help   string
+	labels []string
+	values map[string]*counterValue
+	mutex  sync.RWMutex
+}
+
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *CounterVec) Add(value float64, labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, ok := c.values[key]; !ok {
+		c.values[key] = &counterValue{labelValues: labelValues}
+	}
+	c.values[key].value += value
+}
+
+//Value returns the current value of the counter for the label values
+func (c *CounterVec) Value(labelValues ...string) float64 {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if value, ok := c.values[strings.Join(labelValues, "\xff")]; ok {
+		return value.value
+	}
+	return 0
+}
+
+func (c *CounterVec) write(w io.Writer) error {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, escapeHelp(c.help), c.name); err != nil {
+		return err
+	}
+	for _, key := range sortedValueKeys(c.values) {
+		value := c.values[key]
+		if _, err := fmt.Fprintf(w, "%s%s %s\n", c.name, formatLabels(c.labels, value.labelValues, "", ""), formatFloat(value.value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type histogramValue struct {
+	labelValues []string
+	counts      []uint64
+	count       uint64
+	sum         float64
+}
+
+//HistogramVec is a histogram partitioned by label values
+type HistogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+	values  map[string]*histogramValue
+	mutex   sync.RWMutex
+}
+
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if _, ok := h.values[key]; !ok {
+		h.values[key] = &histogramValue{labelValues: labelValues, counts: make([]uint64, len(h.buckets))}
+	}
+	histogram := h.values[key]
+	for i, bucket := range h.buckets {
+		if value <= bucket {
+			histogram.counts[i] += 1
+		}
+	}
+	histogram.count += 1
+	histogram.sum += value
+}
+
+//Count returns the number of observations for the label values
+func (h *HistogramVec) Count(labelValues ...string) uint64 {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	if value, ok := h.values[strings.Join(labelValues, "\xff")]; ok {
+		return value.count
+	}
+	return 0
+}
+
+func (h *HistogramVec) write(w io.Writer) error {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, escapeHelp(h.help), h.name); err != nil {
+		return err
+	}
+	for _, key := range sortedHistogramKeys(h.values) {
+		value := h.values[key]
+		for i, bucket := range h.buckets {
+			if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, value.labelValues, "le", formatFloat(bucket)), value.counts[i]); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, value.labelValues, "le", "+Inf"), value.count); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%s_sum%s %s\n", h.name, formatLabels(h.labels, value.labelValues, "", ""), formatFloat(value.sum)); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labels, value.labelValues, "", ""), value.count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatLabels(labels []string, values []string, extraLabel string, extraValue string) string {
+	var pairs []string
+	for i, label := range labels {
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", label, escapeLabelValue(value)))
+	}
+	if extraLabel != "" {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", extraLabel, extraValue))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var labelValueReplacer = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n")
+var helpReplacer = strings.NewReplacer("\\", "\\\\", "\n", "\\n")
+
+func escapeLabelValue(value string) string {
+	return labelValueReplacer.Replace(value)
+}
+
+func escapeHelp(help string) string {
+	return helpReplacer.Replace(help)
+}
+
+func sortedValueKeys(values map[string]*counterValue) []string {
+	var keys []string
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedHistogramKeys(values map[string]*histogramValue) []string {
+	var keys []string
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
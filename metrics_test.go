@@ -0,0 +1,172 @@
+package weos_test
+
+import (
+	"bytes"
+	"errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/wepala/weos"
+	"golang.org/x/net/context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetrics_Write(t *testing.T) {
+	metrics := &weos.Metrics{}
+	counter := metrics.NewCounter("test_total", "Test counter", "type")
+	counter.Inc("b")
+	counter.Add(2, "a\"quoted\"")
+	histogram := metrics.NewHistogram("test_seconds", "Test histogram", []float64{1, 0.5})
+	histogram.Observe(0.25)
+	histogram.Observe(0.75)
+
+	buffer := &bytes.Buffer{}
+	if err := metrics.Write(buffer); err != nil {
+		t.Fatalf("unexpected error writing metrics '%s'", err)
+	}
+	expected := `# HELP test_total Test counter
+# TYPE test_total counter
+test_total{type="a\"quoted\""} 2
+test_total{type="b"} 1
+# HELP test_seconds Test histogram
+# TYPE test_seconds histogram
+test_seconds_bucket{le="0.5"} 1
+test_seconds_bucket{le="1"} 2
+test_seconds_bucket{le="+Inf"} 2
+test_seconds_sum 1
+test_seconds_count 2
+`
+	if buffer.String() != expected {
+		t.Errorf("expected the metrics to be \n%s\ngot\n%s", expected, buffer.String())
+	}
+}
+
+func TestMetrics_Handler(t *testing.T) {
+	metrics := weos.NewMetrics()
+	metrics.CommandsDispatched.Inc("CREATE_POST")
+	recorder := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("expected the status code to be %d, got %d", http.StatusOK, recorder.Code)
+	}
+	if !strings.HasPrefix(recorder.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("expected a text response, got '%s'", recorder.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(recorder.Body.String(), `weos_commands_dispatched_total{command="CREATE_POST"} 1`) {
+		t.Errorf("expected the command counter to be exposed, got \n%s", recorder.Body.String())
+	}
+}
+
+func TestMetrics_Instrumentation(t *testing.T) {
+	metrics := weos.NewMetrics()
+
+	t.Run("command dispatcher", func(t *testing.T) {
+		dispatcher := &weos.DefaultCommandDispatcher{Metrics: metrics}
+		dispatcher.AddSubscriber(&weos.Command{Type: "FAIL"}, func(ctx context.Context, command *weos.Command) error {
+			return errors.New("some error")
+		})
+		dispatcher.AddSubscriber(&weos.Command{Type: "PANIC"}, func(ctx context.Context, command *weos.Command) error {
+			panic("some panic")
+		})
+		dispatcher.Dispatch(context.TODO(), &weos.Command{Type: "FAIL"})
+		dispatcher.Dispatch(context.TODO(), &weos.Command{Type: "PANIC"})
+
+		if metrics.CommandsDispatched.Value("FAIL") != 1 {
+			t.Errorf("expected %d FAIL command to be dispatched, got %f", 1, metrics.CommandsDispatched.Value("FAIL"))
+		}
+		if metrics.CommandErrors.Value("FAIL") != 1 {
+			t.Errorf("expected %d FAIL error, got %f", 1, metrics.CommandErrors.Value("FAIL"))
+		}
+		if metrics.CommandPanics.Value("PANIC") != 1 {
+			t.Errorf("expected %d PANIC panic, got %f", 1, metrics.CommandPanics.Value("PANIC"))
+		}
+		if metrics.CommandDuration.Count("FAIL") != 1 {
+			t.Errorf("expected %d FAIL duration observation, got %d", 1, metrics.CommandDuration.Count("FAIL"))
+		}
+	})
+
+	t.Run("types without a handler are counted as unknown", func(t *testing.T) {
+		metrics := weos.NewMetrics()
+		commands := &weos.DefaultCommandDispatcher{Metrics: metrics}
+		commands.AddSubscriber(&weos.Command{Type: "CREATE_POST"}, func(ctx context.Context, command *weos.Command) error {
+			return nil
+		})
+		commands.Dispatch(context.TODO(), &weos.Command{Type: "SOME_RANDOM_TYPE"})
+		if metrics.CommandsDispatched.Value("SOME_RANDOM_TYPE") != 0 || metrics.CommandsDispatched.Value(weos.UnknownLabel) != 1 {
+			t.Errorf("expected the command to be counted as '%s'", weos.UnknownLabel)
+		}
+		commands.Authorizer = weos.AuthorizerFunc(func(ctx context.Context, user *weos.User, command *weos.Command) error {
+			return errors.New("not allowed")
+		})
+		commands.Dispatch(context.TODO(), &weos.Command{Type: "CREATE_POST"})
+		if metrics.CommandsDispatched.Value("CREATE_POST") != 0 {
+			t.Errorf("expected commands that aren't authorized not to be counted, got %f", metrics.CommandsDispatched.Value("CREATE_POST"))
+		}
+
+		queries := &weos.DefaultQueryDispatcher{Metrics: metrics}
+		queries.AddSubscriber(&weos.Query{Type: "GET_POST"}, func(ctx context.Context, query *weos.Query) (interface{}, error) {
+			return nil, nil
+		})
+		queries.Dispatch(context.TODO(), &weos.Query{Type: "SOME_RANDOM_TYPE"})
+		queries.Dispatch(context.TODO(), &weos.Query{Type: "GET_POST"})
+		if metrics.QueriesDispatched.Value("SOME_RANDOM_TYPE") != 0 || metrics.QueriesDispatched.Value(weos.UnknownLabel) != 1 {
+			t.Errorf("expected the query to be counted as '%s'", weos.UnknownLabel)
+		}
+		if metrics.QueriesDispatched.Value("GET_POST") != 1 {
+			t.Errorf("expected %d GET_POST query, got %f", 1, metrics.QueriesDispatched.Value("GET_POST"))
+		}
+	})
+
+	t.Run("event dispatcher", func(t *testing.T) {
+		dispatcher := &weos.EventDisptacher{Metrics: metrics}
+		dispatcher.AddSubscriber(func(ctx context.Context, event weos.Event) {})
+		dispatcher.AddSubscriber(func(ctx context.Context, event weos.Event) {
+			panic("some panic")
+		})
+		dispatcher.Dispatch(context.TODO(), weos.Event{Type: "POST_CREATED"})
+
+		if metrics.EventsDispatched.Value("POST_CREATED") != 1 {
+			t.Errorf("expected %d event to be dispatched, got %f", 1, metrics.EventsDispatched.Value("POST_CREATED"))
+		}
+		if metrics.EventHandlerDuration.Count("POST_CREATED") != 2 {
+			t.Errorf("expected %d handler duration observations, got %d", 2, metrics.EventHandlerDuration.Count("POST_CREATED"))
+		}
+		if metrics.EventHandlerPanics.Value("POST_CREATED") != 1 {
+			t.Errorf("expected %d handler panic, got %f", 1, metrics.EventHandlerPanics.Value("POST_CREATED"))
+		}
+	})
+
+	t.Run("event repository", func(t *testing.T) {
+		repository, err := weos.NewBasicEventRepository(newMigrationTestDB(t), log.New(), false, "", "")
+		if err != nil {
+			t.Fatalf("unexpected error creating repository '%s'", err)
+		}
+		if err = repository.Migrate(context.TODO()); err != nil {
+			t.Fatalf("unexpected error migrating repository '%s'", err)
+		}
+		repository.(*weos.EventRepositoryGorm).SetMetrics(metrics)
+
+		entity := &weos.AggregateRoot{BasicEntity: weos.BasicEntity{ID: "1wqoyqIRsZTtnP3wjKh2Mq1Qp03"}}
+		entity.NewChange(weos.NewEntityEvent("POST_CREATED", entity, entity.ID, nil))
+		entity.NewChange(weos.NewEntityEvent("POST_UPDATED", entity, entity.ID, nil))
+		if err = repository.Persist(context.TODO(), entity); err != nil {
+			t.Fatalf("unexpected error persisting events '%s'", err)
+		}
+		invalid := &weos.AggregateRoot{}
+		invalid.NewChange(&weos.Event{})
+		if err = repository.Persist(context.TODO(), invalid); err == nil {
+			t.Fatal("expected an error persisting an invalid event")
+		}
+
+		if metrics.EventsPersisted.Value("POST_CREATED") != 1 {
+			t.Errorf("expected %d event to be persisted, got %f", 1, metrics.EventsPersisted.Value("POST_CREATED"))
+		}
+		if metrics.PersistDuration.Count() != 2 {
+			t.Errorf("expected %d persist duration observations, got %d", 2, metrics.PersistDuration.Count())
+		}
+		if metrics.PersistErrors.Value() != 1 {
+			t.Errorf("expected %d persist error, got %f", 1, metrics.PersistErrors.Value())
+		}
+	})
+}
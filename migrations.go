@@ -0,0 +1,247 @@
+package weos
+
+import (
+	"fmt"
+	"github.com/segmentio/ksuid"
+	"golang.org/x/net/context"
+	"gorm.io/gorm"
+	"sort"
+	"time"
+)
+
+//Migration is a versioned change to the database schema. Up applies the change and Down reverts it.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+//MigrationProvider is implemented by datastores (e.g. the event repository, projections) that manage their schema with
+//versioned migrations. Each provider owns the migrations in its namespace
+type MigrationProvider interface {
+	MigrationNamespace() string
+	Migrations() []*Migration
+}
+
+//SchemaMigration is a record of a migration that has been applied
+type SchemaMigration struct {
+	Namespace string `gorm:"primaryKey"`
+	Version   int64  `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+//SchemaMigrationLock is used to make sure only one instance runs migrations at a time
+type SchemaMigrationLock struct {
+	ID       string `gorm:"primaryKey"`
+	Owner    string
+	LockedAt time.Time
+}
+
+func (SchemaMigrationLock) TableName() string {
+	return "schema_migration_locks"
+}
+
+const migrationLockID = "weos"
+
+//Migrator runs versioned migrations in order and keeps track of the ones that have been applied in the
+//schema_migrations table
+type Migrator struct {
+	db         *gorm.DB
+	logger     Log
+	namespaces []string
+	migrations map[string][]*Migration
+	//LockTimeout is how long to wait for another instance to finish migrating
+	LockTimeout time.Duration
+	//StaleLockTimeout is how old a lock should be before it's assumed the instance holding it died
+	StaleLockTimeout time.Duration
+	//PollInterval is how often to check if the lock has been released
+	PollInterval time.Duration
+}
+
+func NewMigrator(db *gorm.DB, logger Log) *Migrator {
+	return &Migrator{
+		db:               db,
+		logger:           logger,
+		migrations:       make(map[string][]*Migration),
+		LockTimeout:      time.Minute,
+		StaleLockTimeout: 15 * time.Minute,
+		PollInterval:     500 * time.Millisecond,
+	}
+}
+
+//Register adds migrations to a namespace. Namespaces are migrated in the order they are registered
+func (m *Migrator) Register(namespace string, migrations ...*Migration) error {
+	if namespace == "" {
+		return NewError("migrations must have a namespace", nil)
+	}
+	if _, ok := m.migrations[namespace]; !ok {
+		m.namespaces = append(m.namespaces, namespace)
+	}
+	versions := make(map[int64]bool)
+	for _, migration := range m.migrations[namespace] {
+		versions[migration.Version] = true
+	}
+	for _, migration := range migrations {
+		if migration.Version <= 0 {
+			return NewError(fmt.Sprintf("migration '%s' in namespace '%s' must have a positive version", migration.Name, namespace), nil)
+		}
+		if versions[migration.Version] {
+			return NewError(fmt.Sprintf("migration version %d is registered more than once in namespace '%s'", migration.Version, namespace), nil)
+		}
+		if migration.Up == nil {
+			return NewError(fmt.Sprintf("migration '%s' in namespace '%s' must have an up function", migration.Name, namespace), nil)
+		}
+		versions[migration.Version] = true
+		m.migrations[namespace] = append(m.migrations[namespace], migration)
+	}
+	sort.Slice(m.migrations[namespace], func(i, j int) bool {
+		return m.migrations[namespace][i].Version < m.migrations[namespace][j].Version
+	})
+	return nil
+}
+
+//RegisterProvider adds the migrations of a datastore
+func (m *Migrator) RegisterProvider(provider MigrationProvider) error {
+	return m.Register(provider.MigrationNamespace(), provider.Migrations()...)
+}
+
+//Namespaces returns the namespaces that have migrations registered
+func (m *Migrator) Namespaces() []string {
+	return m.namespaces
+}
+
+//Applied returns the migrations that have been applied in a namespace
+func (m *Migrator) Applied(ctx context.Context, namespace string) ([]SchemaMigration, error) {
+	var applied []SchemaMigration
+	if err := m.db.WithContext(ctx).AutoMigrate(&SchemaMigration{}); err != nil {
+		return nil, err
+	}
+	result := m.db.WithContext(ctx).Where("namespace = ?", namespace).Order("version asc").Find(&applied)
+	return applied, result.Error
+}
+
+//Up applies all the migrations that have not been applied yet
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.withLock(ctx, func() error {
+		for _, namespace := range m.namespaces {
+			applied, err := m.appliedVersions(ctx, namespace)
+			if err != nil {
+				return err
+			}
+			for _, migration := range m.migrations[namespace] {
+				if applied[migration.Version] {
+					continue
+				}
+				m.logger.Infof("applying migration %s/%d '%s'", namespace, migration.Version, migration.Name)
+				err = m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+					if err := migration.Up(tx); err != nil {
+						return err
+					}
+					return tx.Create(&SchemaMigration{
+						Namespace: namespace,
+						Version:   migration.Version,
+						Name:      migration.Name,
+						AppliedAt: time.Now(),
+					}).Error
+				})
+				if err != nil {
+					return NewError(fmt.Sprintf("error applying migration %s/%d '%s'", namespace, migration.Version, migration.Name), err)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+//Down reverts the last n migrations that were applied in a namespace
+func (m *Migrator) Down(ctx context.Context, namespace string, steps int) error {
+	return m.withLock(ctx, func() error {
+		applied, err := m.appliedVersions(ctx, namespace)
+		if err != nil {
+			return err
+		}
+		migrations := m.migrations[namespace]
+		for i := len(migrations) - 1; i >= 0 && steps > 0; i-- {
+			migration := migrations[i]
+			if !applied[migration.Version] {
+				continue
+			}
+			if migration.Down == nil {
+				return NewError(fmt.Sprintf("migration %s/%d '%s' can't be rolled back", namespace, migration.Version, migration.Name), nil)
+			}
+			m.logger.Infof("rolling back migration %s/%d '%s'", namespace, migration.Version, migration.Name)
+			err = m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+				if err := migration.Down(tx); err != nil {
+					return err
+				}
+				return tx.Where("namespace = ? AND version = ?", namespace, migration.Version).Delete(&SchemaMigration{}).Error
+			})
+			if err != nil {
+				return NewError(fmt.Sprintf("error rolling back migration %s/%d '%s'", namespace, migration.Version, migration.Name), err)
+			}
+			steps -= 1
+		}
+		return nil
+	})
+}
+
+func (m *Migrator) appliedVersions(ctx context.Context, namespace string) (map[int64]bool, error) {
+	applied, err := m.Applied(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+	versions := make(map[int64]bool)
+	for _, migration := range applied {
+		versions[migration.Version] = true
+	}
+	return versions, nil
+}
+
+//withLock runs the function while holding the migration lock so that concurrent instances don't migrate twice
+func (m *Migrator) withLock(ctx context.Context, f func() error) error {
+	db := m.db.WithContext(ctx)
+	if err := db.AutoMigrate(&SchemaMigrationLock{}); err != nil {
+		return err
+	}
+
+	owner := ksuid.New().String()
+	deadline := time.Now().Add(m.LockTimeout)
+	for {
+		err := db.Create(&SchemaMigrationLock{ID: migrationLockID, Owner: owner, LockedAt: time.Now()}).Error
+		if err == nil {
+			break
+		}
+		//if the instance that has the lock died the lock is removed
+		var lock SchemaMigrationLock
+		if result := db.Where("id = ?", migrationLockID).Limit(1).Find(&lock); result.Error == nil && result.RowsAffected > 0 {
+			if time.Since(lock.LockedAt) > m.StaleLockTimeout {
+				m.logger.Infof("removing stale migration lock held by '%s'", lock.Owner)
+				db.Where("id = ? AND owner = ?", migrationLockID, lock.Owner).Delete(&SchemaMigrationLock{})
+				continue
+			}
+		}
+		if time.Now().After(deadline) {
+			return NewError("timed out waiting for the migration lock", err)
+		}
+		m.logger.Debugf("waiting for migration lock")
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(m.PollInterval):
+		}
+	}
+
+	defer func() {
+		if err := db.Where("id = ? AND owner = ?", migrationLockID, owner).Delete(&SchemaMigrationLock{}).Error; err != nil {
+			m.logger.Errorf("error releasing migration lock '%s'", err)
+		}
+	}()
+
+	return f()
+}
@@ -0,0 +1,202 @@
+package weos_test
+
+import (
+	"database/sql"
+	"errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/wepala/weos"
+	"golang.org/x/net/context"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"testing"
+	"time"
+)
+
+func newMigrationTestDB(t *testing.T) *gorm.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("error opening database '%s'", err)
+	}
+	//each connection to an in memory database is a new database
+	db.SetMaxOpenConns(1)
+	gormDB, err := gorm.Open(&sqlite.Dialector{Conn: db}, nil)
+	if err != nil {
+		t.Fatalf("error setting up gorm '%s'", err)
+	}
+	return gormDB
+}
+
+type migrationTestPost struct {
+	ID    string `gorm:"primaryKey"`
+	Title string
+}
+
+type migrationTestPostDescription struct {
+	Description string
+}
+
+func (migrationTestPostDescription) TableName() string {
+	return "migration_test_posts"
+}
+
+func migrationTestMigrations() []*weos.Migration {
+	return []*weos.Migration{
+		{
+			Version: 2,
+			Name:    "add description",
+			Up: func(tx *gorm.DB) error {
+				return tx.Migrator().AddColumn(&migrationTestPostDescription{}, "Description")
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropColumn(&migrationTestPostDescription{}, "Description")
+			},
+		},
+		{
+			Version: 1,
+			Name:    "create posts",
+			Up: func(tx *gorm.DB) error {
+				return tx.Migrator().CreateTable(&migrationTestPost{})
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable(&migrationTestPost{})
+			},
+		},
+	}
+}
+
+func TestMigrator_Up(t *testing.T) {
+	gormDB := newMigrationTestDB(t)
+	migrator := weos.NewMigrator(gormDB, log.New())
+	err := migrator.Register("posts", migrationTestMigrations()...)
+	if err != nil {
+		t.Fatalf("unexpected error registering migrations '%s'", err)
+	}
+
+	t.Run("migrations are applied in order", func(t *testing.T) {
+		err = migrator.Up(context.TODO())
+		if err != nil {
+			t.Fatalf("unexpected error running migrations '%s'", err)
+		}
+		if !gormDB.Migrator().HasColumn(&migrationTestPostDescription{}, "Description") {
+			t.Error("expected the description column to be added")
+		}
+		applied, err := migrator.Applied(context.TODO(), "posts")
+		if err != nil {
+			t.Fatalf("unexpected error getting applied migrations '%s'", err)
+		}
+		if len(applied) != 2 {
+			t.Fatalf("expected %d migrations to be applied, got %d", 2, len(applied))
+		}
+		if applied[0].Version != 1 || applied[1].Version != 2 {
+			t.Errorf("expected versions 1 and 2 to be recorded, got %d and %d", applied[0].Version, applied[1].Version)
+		}
+	})
+
+	t.Run("applied migrations are not run again", func(t *testing.T) {
+		err = migrator.Up(context.TODO())
+		if err != nil {
+			t.Fatalf("unexpected error running migrations '%s'", err)
+		}
+	})
+
+	t.Run("migrations are rolled back", func(t *testing.T) {
+		err = migrator.Down(context.TODO(), "posts", 1)
+		if err != nil {
+			t.Fatalf("unexpected error rolling back migrations '%s'", err)
+		}
+		if gormDB.Migrator().HasColumn(&migrationTestPostDescription{}, "Description") {
+			t.Error("expected the description column to be removed")
+		}
+		if !gormDB.Migrator().HasTable(&migrationTestPost{}) {
+			t.Error("expected only the last migration to be rolled back")
+		}
+		applied, err := migrator.Applied(context.TODO(), "posts")
+		if err != nil {
+			t.Fatalf("unexpected error getting applied migrations '%s'", err)
+		}
+		if len(applied) != 1 {
+			t.Errorf("expected %d migration to be applied, got %d", 1, len(applied))
+		}
+	})
+
+	t.Run("failed migrations are not recorded", func(t *testing.T) {
+		failingMigrator := weos.NewMigrator(gormDB, log.New())
+		err = failingMigrator.Register("failing", &weos.Migration{
+			Version: 1,
+			Name:    "fails",
+			Up: func(tx *gorm.DB) error {
+				return errors.New("some error")
+			},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error registering migrations '%s'", err)
+		}
+		if err = failingMigrator.Up(context.TODO()); err == nil {
+			t.Fatal("expected an error running the migration")
+		}
+		applied, err := failingMigrator.Applied(context.TODO(), "failing")
+		if err != nil {
+			t.Fatalf("unexpected error getting applied migrations '%s'", err)
+		}
+		if len(applied) != 0 {
+			t.Errorf("expected no migrations to be recorded, got %d", len(applied))
+		}
+	})
+}
+
+func TestMigrator_Register(t *testing.T) {
+	migrator := weos.NewMigrator(nil, log.New())
+	err := migrator.Register("posts", migrationTestMigrations()...)
+	if err != nil {
+		t.Fatalf("unexpected error registering migrations '%s'", err)
+	}
+	err = migrator.Register("posts", &weos.Migration{Version: 1, Name: "duplicate", Up: func(tx *gorm.DB) error {
+		return nil
+	}})
+	if err == nil {
+		t.Error("expected an error registering the same version twice")
+	}
+}
+
+func TestMigrator_Lock(t *testing.T) {
+	gormDB := newMigrationTestDB(t)
+	err := gormDB.AutoMigrate(&weos.SchemaMigrationLock{})
+	if err != nil {
+		t.Fatalf("unexpected error setting up lock table '%s'", err)
+	}
+
+	t.Run("wait for lock held by another instance", func(t *testing.T) {
+		gormDB.Create(&weos.SchemaMigrationLock{ID: "weos", Owner: "other", LockedAt: time.Now()})
+		migrator := weos.NewMigrator(gormDB, log.New())
+		migrator.LockTimeout = 50 * time.Millisecond
+		migrator.PollInterval = 10 * time.Millisecond
+		err = migrator.Register("posts", migrationTestMigrations()...)
+		if err != nil {
+			t.Fatalf("unexpected error registering migrations '%s'", err)
+		}
+		if err = migrator.Up(context.TODO()); err == nil {
+			t.Fatal("expected an error while another instance holds the lock")
+		}
+		if gormDB.Migrator().HasTable(&migrationTestPost{}) {
+			t.Error("expected migrations not to run without the lock")
+		}
+	})
+
+	t.Run("stale locks are removed", func(t *testing.T) {
+		gormDB.Where("id = ?", "weos").Delete(&weos.SchemaMigrationLock{})
+		gormDB.Create(&weos.SchemaMigrationLock{ID: "weos", Owner: "other", LockedAt: time.Now().Add(-time.Hour)})
+		migrator := weos.NewMigrator(gormDB, log.New())
+		err = migrator.Register("posts", migrationTestMigrations()...)
+		if err != nil {
+			t.Fatalf("unexpected error registering migrations '%s'", err)
+		}
+		if err = migrator.Up(context.TODO()); err != nil {
+			t.Fatalf("unexpected error running migrations '%s'", err)
+		}
+		var count int64
+		gormDB.Model(&weos.SchemaMigrationLock{}).Count(&count)
+		if count != 0 {
+			t.Errorf("expected the lock to be released, found %d locks", count)
+		}
+	})
+}
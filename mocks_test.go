@@ -40,9 +40,15 @@ var _ weos.EventRepository = &EventRepositoryMock{}
 //             GetByAggregateAndTypeFunc: func(ID string, entityType string) ([]*weos.Event, error) {
 // 	               panic("mock out the GetByAggregateAndType method")
 //             },
+//             GetByCorrelationIDFunc: func(correlationID string) ([]*weos.Event, error) {
+// 	               panic("mock out the GetByCorrelationID method")
+//             },
 //             GetByEntityAndAggregateFunc: func(entityID string, entityType string, rootID string) ([]*weos.Event, error) {
 // 	               panic("mock out the GetByEntityAndAggregate method")
 //             },
+//             GetEventsFunc: func(filter weos.EventFilter) ([]*weos.Event, error) {
+// 	               panic("mock out the GetEvents method")
+//             },
 //             GetSubscribersFunc: func() ([]weos.EventHandler, error) {
 // 	               panic("mock out the GetSubscribers method")
 //             },
@@ -52,6 +58,9 @@ var _ weos.EventRepository = &EventRepositoryMock{}
 //             PersistFunc: func(ctxt context.Context, entity weos.AggregateInterface) error {
 // 	               panic("mock out the Persist method")
 //             },
+//             WithContextFunc: func(ctxt context.Context) (weos.EventRepository, error) {
+// 	               panic("mock out the WithContext method")
+//             },
 //         }
 //
 //         // use mockedEventRepository in code that requires weos.EventRepository
@@ -77,9 +86,15 @@ type EventRepositoryMock struct {
 	// GetByAggregateAndTypeFunc mocks the GetByAggregateAndType method.
 	GetByAggregateAndTypeFunc func(ID string, entityType string) ([]*weos.Event, error)
 
+	// GetByCorrelationIDFunc mocks the GetByCorrelationID method.
+	GetByCorrelationIDFunc func(correlationID string) ([]*weos.Event, error)
+
 	// GetByEntityAndAggregateFunc mocks the GetByEntityAndAggregate method.
 	GetByEntityAndAggregateFunc func(entityID string, entityType string, rootID string) ([]*weos.Event, error)
 
+	// GetEventsFunc mocks the GetEvents method.
+	GetEventsFunc func(filter weos.EventFilter) ([]*weos.Event, error)
+
 	// GetSubscribersFunc mocks the GetSubscribers method.
 	GetSubscribersFunc func() ([]weos.EventHandler, error)
 
@@ -89,6 +104,9 @@ type EventRepositoryMock struct {
 	// PersistFunc mocks the Persist method.
 	PersistFunc func(ctxt context.Context, entity weos.AggregateInterface) error
 
+	// WithContextFunc mocks the WithContext method.
+	WithContextFunc func(ctxt context.Context) (weos.EventRepository, error)
+
 	// calls tracks calls to the methods.
 	calls struct {
 		// AddSubscriber holds details about calls to the AddSubscriber method.
@@ -125,6 +143,11 @@ type EventRepositoryMock struct {
 			// EntityType is the entityType argument value.
 			EntityType string
 		}
+		// GetByCorrelationID holds details about calls to the GetByCorrelationID method.
+		GetByCorrelationID []struct {
+			// CorrelationID is the correlationID argument value.
+			CorrelationID string
+		}
 		// GetByEntityAndAggregate holds details about calls to the GetByEntityAndAggregate method.
 		GetByEntityAndAggregate []struct {
 			// EntityID is the entityID argument value.
@@ -134,6 +157,11 @@ type EventRepositoryMock struct {
 			// RootID is the rootID argument value.
 			RootID string
 		}
+		// GetEvents holds details about calls to the GetEvents method.
+		GetEvents []struct {
+			// Filter is the filter argument value.
+			Filter weos.EventFilter
+		}
 		// GetSubscribers holds details about calls to the GetSubscribers method.
 		GetSubscribers []struct {
 		}
@@ -149,6 +177,11 @@ type EventRepositoryMock struct {
 			// Entity is the entity argument value.
 			Entity weos.AggregateInterface
 		}
+		// WithContext holds details about calls to the WithContext method.
+		WithContext []struct {
+			// Ctxt is the ctxt argument value.
+			Ctxt context.Context
+		}
 	}
 	lockAddSubscriber                  sync.RWMutex
 	lockFlush                          sync.RWMutex
@@ -156,10 +189,13 @@ type EventRepositoryMock struct {
 	lockGetByAggregate                 sync.RWMutex
 	lockGetByAggregateAndSequenceRange sync.RWMutex
 	lockGetByAggregateAndType          sync.RWMutex
+	lockGetByCorrelationID             sync.RWMutex
 	lockGetByEntityAndAggregate        sync.RWMutex
+	lockGetEvents                      sync.RWMutex
 	lockGetSubscribers                 sync.RWMutex
 	lockMigrate                        sync.RWMutex
 	lockPersist                        sync.RWMutex
+	lockWithContext                    sync.RWMutex
 }
 
 // AddSubscriber calls AddSubscriberFunc.
@@ -355,6 +391,37 @@ func (mock *EventRepositoryMock) GetByAggregateAndTypeCalls() []struct {
 	return calls
 }
 
+// GetByCorrelationID calls GetByCorrelationIDFunc.
+func (mock *EventRepositoryMock) GetByCorrelationID(correlationID string) ([]*weos.Event, error) {
+	if mock.GetByCorrelationIDFunc == nil {
+		panic("EventRepositoryMock.GetByCorrelationIDFunc: method is nil but EventRepository.GetByCorrelationID was just called")
+	}
+	callInfo := struct {
+		CorrelationID string
+	}{
+		CorrelationID: correlationID,
+	}
+	mock.lockGetByCorrelationID.Lock()
+	mock.calls.GetByCorrelationID = append(mock.calls.GetByCorrelationID, callInfo)
+	mock.lockGetByCorrelationID.Unlock()
+	return mock.GetByCorrelationIDFunc(correlationID)
+}
+
+// GetByCorrelationIDCalls gets all the calls that were made to GetByCorrelationID.
+// Check the length with:
+//     len(mockedEventRepository.GetByCorrelationIDCalls())
+func (mock *EventRepositoryMock) GetByCorrelationIDCalls() []struct {
+	CorrelationID string
+} {
+	var calls []struct {
+		CorrelationID string
+	}
+	mock.lockGetByCorrelationID.RLock()
+	calls = mock.calls.GetByCorrelationID
+	mock.lockGetByCorrelationID.RUnlock()
+	return calls
+}
+
 // GetByEntityAndAggregate calls GetByEntityAndAggregateFunc.
 func (mock *EventRepositoryMock) GetByEntityAndAggregate(entityID string, entityType string, rootID string) ([]*weos.Event, error) {
 	if mock.GetByEntityAndAggregateFunc == nil {
@@ -394,6 +461,37 @@ func (mock *EventRepositoryMock) GetByEntityAndAggregateCalls() []struct {
 	return calls
 }
 
+// GetEvents calls GetEventsFunc.
+func (mock *EventRepositoryMock) GetEvents(filter weos.EventFilter) ([]*weos.Event, error) {
+	if mock.GetEventsFunc == nil {
+		panic("EventRepositoryMock.GetEventsFunc: method is nil but EventRepository.GetEvents was just called")
+	}
+	callInfo := struct {
+		Filter weos.EventFilter
+	}{
+		Filter: filter,
+	}
+	mock.lockGetEvents.Lock()
+	mock.calls.GetEvents = append(mock.calls.GetEvents, callInfo)
+	mock.lockGetEvents.Unlock()
+	return mock.GetEventsFunc(filter)
+}
+
+// GetEventsCalls gets all the calls that were made to GetEvents.
+// Check the length with:
+//     len(mockedEventRepository.GetEventsCalls())
+func (mock *EventRepositoryMock) GetEventsCalls() []struct {
+	Filter weos.EventFilter
+} {
+	var calls []struct {
+		Filter weos.EventFilter
+	}
+	mock.lockGetEvents.RLock()
+	calls = mock.calls.GetEvents
+	mock.lockGetEvents.RUnlock()
+	return calls
+}
+
 // GetSubscribers calls GetSubscribersFunc.
 func (mock *EventRepositoryMock) GetSubscribers() ([]weos.EventHandler, error) {
 	if mock.GetSubscribersFunc == nil {
@@ -486,6 +584,37 @@ func (mock *EventRepositoryMock) PersistCalls() []struct {
 	return calls
 }
 
+// WithContext calls WithContextFunc.
+func (mock *EventRepositoryMock) WithContext(ctxt context.Context) (weos.EventRepository, error) {
+	if mock.WithContextFunc == nil {
+		panic("EventRepositoryMock.WithContextFunc: method is nil but EventRepository.WithContext was just called")
+	}
+	callInfo := struct {
+		Ctxt context.Context
+	}{
+		Ctxt: ctxt,
+	}
+	mock.lockWithContext.Lock()
+	mock.calls.WithContext = append(mock.calls.WithContext, callInfo)
+	mock.lockWithContext.Unlock()
+	return mock.WithContextFunc(ctxt)
+}
+
+// WithContextCalls gets all the calls that were made to WithContext.
+// Check the length with:
+//     len(mockedEventRepository.WithContextCalls())
+func (mock *EventRepositoryMock) WithContextCalls() []struct {
+	Ctxt context.Context
+} {
+	var calls []struct {
+		Ctxt context.Context
+	}
+	mock.lockWithContext.RLock()
+	calls = mock.calls.WithContext
+	mock.lockWithContext.RUnlock()
+	return calls
+}
+
 // Ensure, that ProjectionMock does implement weos.Projection.
 // If this is not the case, regenerate this file with moq.
 var _ weos.Projection = &ProjectionMock{}
@@ -1327,9 +1456,15 @@ var _ weos.Application = &ApplicationMock{}
 //
 //         // make and configure a mocked weos.Application
 //         mockedApplication := &ApplicationMock{
+//             AddHealthCheckFunc: func(name string, check weos.HealthCheck)  {
+// 	               panic("mock out the AddHealthCheck method")
+//             },
 //             AddProjectionFunc: func(projection weos.Projection) error {
 // 	               panic("mock out the AddProjection method")
 //             },
+//             ClockFunc: func() weos.Clock {
+// 	               panic("mock out the Clock method")
+//             },
 //             ConfigFunc: func() *weos.ApplicationConfig {
 // 	               panic("mock out the Config method")
 //             },
@@ -1348,21 +1483,45 @@ var _ weos.Application = &ApplicationMock{}
 //             HTTPClientFunc: func() *http.Client {
 // 	               panic("mock out the HTTPClient method")
 //             },
+//             HealthFunc: func(ctx context.Context) *weos.HealthReport {
+// 	               panic("mock out the Health method")
+//             },
 //             IDFunc: func() string {
 // 	               panic("mock out the ID method")
 //             },
+//             IDGeneratorFunc: func() weos.IDGenerator {
+// 	               panic("mock out the IDGenerator method")
+//             },
 //             LoggerFunc: func() weos.Log {
 // 	               panic("mock out the Logger method")
 //             },
+//             MetricsFunc: func() *weos.Metrics {
+// 	               panic("mock out the Metrics method")
+//             },
 //             MigrateFunc: func(ctx context.Context) error {
 // 	               panic("mock out the Migrate method")
 //             },
 //             ProjectionsFunc: func() []weos.Projection {
 // 	               panic("mock out the Projections method")
 //             },
+//             QueryDispatcherFunc: func() weos.QueryDispatcher {
+// 	               panic("mock out the QueryDispatcher method")
+//             },
+//             SetClockFunc: func(clock weos.Clock)  {
+// 	               panic("mock out the SetClock method")
+//             },
+//             SetIDGeneratorFunc: func(generator weos.IDGenerator)  {
+// 	               panic("mock out the SetIDGenerator method")
+//             },
+//             StatisticsFunc: func(ctx context.Context, filter weos.EventFilter) (*weos.EventStatistics, error) {
+// 	               panic("mock out the Statistics method")
+//             },
 //             TitleFunc: func() string {
 // 	               panic("mock out the Title method")
 //             },
+//             TracerFunc: func() *weos.Tracer {
+// 	               panic("mock out the Tracer method")
+//             },
 //         }
 //
 //         // use mockedApplication in code that requires weos.Application
@@ -1370,9 +1529,15 @@ var _ weos.Application = &ApplicationMock{}
 //
 //     }
 type ApplicationMock struct {
+	// AddHealthCheckFunc mocks the AddHealthCheck method.
+	AddHealthCheckFunc func(name string, check weos.HealthCheck)
+
 	// AddProjectionFunc mocks the AddProjection method.
 	AddProjectionFunc func(projection weos.Projection) error
 
+	// ClockFunc mocks the Clock method.
+	ClockFunc func() weos.Clock
+
 	// ConfigFunc mocks the Config method.
 	ConfigFunc func() *weos.ApplicationConfig
 
@@ -1391,28 +1556,62 @@ type ApplicationMock struct {
 	// HTTPClientFunc mocks the HTTPClient method.
 	HTTPClientFunc func() *http.Client
 
+	// HealthFunc mocks the Health method.
+	HealthFunc func(ctx context.Context) *weos.HealthReport
+
 	// IDFunc mocks the ID method.
 	IDFunc func() string
 
+	// IDGeneratorFunc mocks the IDGenerator method.
+	IDGeneratorFunc func() weos.IDGenerator
+
 	// LoggerFunc mocks the Logger method.
 	LoggerFunc func() weos.Log
 
+	// MetricsFunc mocks the Metrics method.
+	MetricsFunc func() *weos.Metrics
+
 	// MigrateFunc mocks the Migrate method.
 	MigrateFunc func(ctx context.Context) error
 
 	// ProjectionsFunc mocks the Projections method.
 	ProjectionsFunc func() []weos.Projection
 
+	// QueryDispatcherFunc mocks the QueryDispatcher method.
+	QueryDispatcherFunc func() weos.QueryDispatcher
+
+	// SetClockFunc mocks the SetClock method.
+	SetClockFunc func(clock weos.Clock)
+
+	// SetIDGeneratorFunc mocks the SetIDGenerator method.
+	SetIDGeneratorFunc func(generator weos.IDGenerator)
+
+	// StatisticsFunc mocks the Statistics method.
+	StatisticsFunc func(ctx context.Context, filter weos.EventFilter) (*weos.EventStatistics, error)
+
 	// TitleFunc mocks the Title method.
 	TitleFunc func() string
 
+	// TracerFunc mocks the Tracer method.
+	TracerFunc func() *weos.Tracer
+
 	// calls tracks calls to the methods.
 	calls struct {
+		// AddHealthCheck holds details about calls to the AddHealthCheck method.
+		AddHealthCheck []struct {
+			// Name is the name argument value.
+			Name string
+			// Check is the check argument value.
+			Check weos.HealthCheck
+		}
 		// AddProjection holds details about calls to the AddProjection method.
 		AddProjection []struct {
 			// Projection is the projection argument value.
 			Projection weos.Projection
 		}
+		// Clock holds details about calls to the Clock method.
+		Clock []struct {
+		}
 		// Config holds details about calls to the Config method.
 		Config []struct {
 		}
@@ -1431,12 +1630,23 @@ type ApplicationMock struct {
 		// HTTPClient holds details about calls to the HTTPClient method.
 		HTTPClient []struct {
 		}
+		// Health holds details about calls to the Health method.
+		Health []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+		}
 		// ID holds details about calls to the ID method.
 		ID []struct {
 		}
+		// IDGenerator holds details about calls to the IDGenerator method.
+		IDGenerator []struct {
+		}
 		// Logger holds details about calls to the Logger method.
 		Logger []struct {
 		}
+		// Metrics holds details about calls to the Metrics method.
+		Metrics []struct {
+		}
 		// Migrate holds details about calls to the Migrate method.
 		Migrate []struct {
 			// Ctx is the ctx argument value.
@@ -1445,22 +1655,90 @@ type ApplicationMock struct {
 		// Projections holds details about calls to the Projections method.
 		Projections []struct {
 		}
+		// QueryDispatcher holds details about calls to the QueryDispatcher method.
+		QueryDispatcher []struct {
+		}
+		// SetClock holds details about calls to the SetClock method.
+		SetClock []struct {
+			// Clock is the clock argument value.
+			Clock weos.Clock
+		}
+		// SetIDGenerator holds details about calls to the SetIDGenerator method.
+		SetIDGenerator []struct {
+			// Generator is the generator argument value.
+			Generator weos.IDGenerator
+		}
+		// Statistics holds details about calls to the Statistics method.
+		Statistics []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Filter is the filter argument value.
+			Filter weos.EventFilter
+		}
 		// Title holds details about calls to the Title method.
 		Title []struct {
 		}
+		// Tracer holds details about calls to the Tracer method.
+		Tracer []struct {
+		}
 	}
+	lockAddHealthCheck  sync.RWMutex
 	lockAddProjection   sync.RWMutex
+	lockClock           sync.RWMutex
 	lockConfig          sync.RWMutex
 	lockDB              sync.RWMutex
 	lockDBConnection    sync.RWMutex
 	lockDispatcher      sync.RWMutex
 	lockEventRepository sync.RWMutex
 	lockHTTPClient      sync.RWMutex
+	lockHealth          sync.RWMutex
 	lockID              sync.RWMutex
+	lockIDGenerator     sync.RWMutex
 	lockLogger          sync.RWMutex
+	lockMetrics         sync.RWMutex
 	lockMigrate         sync.RWMutex
 	lockProjections     sync.RWMutex
+	lockQueryDispatcher sync.RWMutex
+	lockSetClock        sync.RWMutex
+	lockSetIDGenerator  sync.RWMutex
+	lockStatistics      sync.RWMutex
 	lockTitle           sync.RWMutex
+	lockTracer          sync.RWMutex
+}
+
+// AddHealthCheck calls AddHealthCheckFunc.
+func (mock *ApplicationMock) AddHealthCheck(name string, check weos.HealthCheck) {
+	if mock.AddHealthCheckFunc == nil {
+		panic("ApplicationMock.AddHealthCheckFunc: method is nil but Application.AddHealthCheck was just called")
+	}
+	callInfo := struct {
+		Name  string
+		Check weos.HealthCheck
+	}{
+		Name:  name,
+		Check: check,
+	}
+	mock.lockAddHealthCheck.Lock()
+	mock.calls.AddHealthCheck = append(mock.calls.AddHealthCheck, callInfo)
+	mock.lockAddHealthCheck.Unlock()
+	mock.AddHealthCheckFunc(name, check)
+}
+
+// AddHealthCheckCalls gets all the calls that were made to AddHealthCheck.
+// Check the length with:
+//     len(mockedApplication.AddHealthCheckCalls())
+func (mock *ApplicationMock) AddHealthCheckCalls() []struct {
+	Name  string
+	Check weos.HealthCheck
+} {
+	var calls []struct {
+		Name  string
+		Check weos.HealthCheck
+	}
+	mock.lockAddHealthCheck.RLock()
+	calls = mock.calls.AddHealthCheck
+	mock.lockAddHealthCheck.RUnlock()
+	return calls
 }
 
 // AddProjection calls AddProjectionFunc.
@@ -1494,6 +1772,32 @@ func (mock *ApplicationMock) AddProjectionCalls() []struct {
 	return calls
 }
 
+// Clock calls ClockFunc.
+func (mock *ApplicationMock) Clock() weos.Clock {
+	if mock.ClockFunc == nil {
+		panic("ApplicationMock.ClockFunc: method is nil but Application.Clock was just called")
+	}
+	callInfo := struct {
+	}{}
+	mock.lockClock.Lock()
+	mock.calls.Clock = append(mock.calls.Clock, callInfo)
+	mock.lockClock.Unlock()
+	return mock.ClockFunc()
+}
+
+// ClockCalls gets all the calls that were made to Clock.
+// Check the length with:
+//     len(mockedApplication.ClockCalls())
+func (mock *ApplicationMock) ClockCalls() []struct {
+} {
+	var calls []struct {
+	}
+	mock.lockClock.RLock()
+	calls = mock.calls.Clock
+	mock.lockClock.RUnlock()
+	return calls
+}
+
 // Config calls ConfigFunc.
 func (mock *ApplicationMock) Config() *weos.ApplicationConfig {
 	if mock.ConfigFunc == nil {
@@ -1650,6 +1954,37 @@ func (mock *ApplicationMock) HTTPClientCalls() []struct {
 	return calls
 }
 
+// Health calls HealthFunc.
+func (mock *ApplicationMock) Health(ctx context.Context) *weos.HealthReport {
+	if mock.HealthFunc == nil {
+		panic("ApplicationMock.HealthFunc: method is nil but Application.Health was just called")
+	}
+	callInfo := struct {
+		Ctx context.Context
+	}{
+		Ctx: ctx,
+	}
+	mock.lockHealth.Lock()
+	mock.calls.Health = append(mock.calls.Health, callInfo)
+	mock.lockHealth.Unlock()
+	return mock.HealthFunc(ctx)
+}
+
+// HealthCalls gets all the calls that were made to Health.
+// Check the length with:
+//     len(mockedApplication.HealthCalls())
+func (mock *ApplicationMock) HealthCalls() []struct {
+	Ctx context.Context
+} {
+	var calls []struct {
+		Ctx context.Context
+	}
+	mock.lockHealth.RLock()
+	calls = mock.calls.Health
+	mock.lockHealth.RUnlock()
+	return calls
+}
+
 // ID calls IDFunc.
 func (mock *ApplicationMock) ID() string {
 	if mock.IDFunc == nil {
@@ -1676,6 +2011,32 @@ func (mock *ApplicationMock) IDCalls() []struct {
 	return calls
 }
 
+// IDGenerator calls IDGeneratorFunc.
+func (mock *ApplicationMock) IDGenerator() weos.IDGenerator {
+	if mock.IDGeneratorFunc == nil {
+		panic("ApplicationMock.IDGeneratorFunc: method is nil but Application.IDGenerator was just called")
+	}
+	callInfo := struct {
+	}{}
+	mock.lockIDGenerator.Lock()
+	mock.calls.IDGenerator = append(mock.calls.IDGenerator, callInfo)
+	mock.lockIDGenerator.Unlock()
+	return mock.IDGeneratorFunc()
+}
+
+// IDGeneratorCalls gets all the calls that were made to IDGenerator.
+// Check the length with:
+//     len(mockedApplication.IDGeneratorCalls())
+func (mock *ApplicationMock) IDGeneratorCalls() []struct {
+} {
+	var calls []struct {
+	}
+	mock.lockIDGenerator.RLock()
+	calls = mock.calls.IDGenerator
+	mock.lockIDGenerator.RUnlock()
+	return calls
+}
+
 // Logger calls LoggerFunc.
 func (mock *ApplicationMock) Logger() weos.Log {
 	if mock.LoggerFunc == nil {
@@ -1702,6 +2063,32 @@ func (mock *ApplicationMock) LoggerCalls() []struct {
 	return calls
 }
 
+// Metrics calls MetricsFunc.
+func (mock *ApplicationMock) Metrics() *weos.Metrics {
+	if mock.MetricsFunc == nil {
+		panic("ApplicationMock.MetricsFunc: method is nil but Application.Metrics was just called")
+	}
+	callInfo := struct {
+	}{}
+	mock.lockMetrics.Lock()
+	mock.calls.Metrics = append(mock.calls.Metrics, callInfo)
+	mock.lockMetrics.Unlock()
+	return mock.MetricsFunc()
+}
+
+// MetricsCalls gets all the calls that were made to Metrics.
+// Check the length with:
+//     len(mockedApplication.MetricsCalls())
+func (mock *ApplicationMock) MetricsCalls() []struct {
+} {
+	var calls []struct {
+	}
+	mock.lockMetrics.RLock()
+	calls = mock.calls.Metrics
+	mock.lockMetrics.RUnlock()
+	return calls
+}
+
 // Migrate calls MigrateFunc.
 func (mock *ApplicationMock) Migrate(ctx context.Context) error {
 	if mock.MigrateFunc == nil {
@@ -1759,6 +2146,129 @@ func (mock *ApplicationMock) ProjectionsCalls() []struct {
 	return calls
 }
 
+// QueryDispatcher calls QueryDispatcherFunc.
+func (mock *ApplicationMock) QueryDispatcher() weos.QueryDispatcher {
+	if mock.QueryDispatcherFunc == nil {
+		panic("ApplicationMock.QueryDispatcherFunc: method is nil but Application.QueryDispatcher was just called")
+	}
+	callInfo := struct {
+	}{}
+	mock.lockQueryDispatcher.Lock()
+	mock.calls.QueryDispatcher = append(mock.calls.QueryDispatcher, callInfo)
+	mock.lockQueryDispatcher.Unlock()
+	return mock.QueryDispatcherFunc()
+}
+
+// QueryDispatcherCalls gets all the calls that were made to QueryDispatcher.
+// Check the length with:
+//     len(mockedApplication.QueryDispatcherCalls())
+func (mock *ApplicationMock) QueryDispatcherCalls() []struct {
+} {
+	var calls []struct {
+	}
+	mock.lockQueryDispatcher.RLock()
+	calls = mock.calls.QueryDispatcher
+	mock.lockQueryDispatcher.RUnlock()
+	return calls
+}
+
+// SetClock calls SetClockFunc.
+func (mock *ApplicationMock) SetClock(clock weos.Clock) {
+	if mock.SetClockFunc == nil {
+		panic("ApplicationMock.SetClockFunc: method is nil but Application.SetClock was just called")
+	}
+	callInfo := struct {
+		Clock weos.Clock
+	}{
+		Clock: clock,
+	}
+	mock.lockSetClock.Lock()
+	mock.calls.SetClock = append(mock.calls.SetClock, callInfo)
+	mock.lockSetClock.Unlock()
+	mock.SetClockFunc(clock)
+}
+
+// SetClockCalls gets all the calls that were made to SetClock.
+// Check the length with:
+//     len(mockedApplication.SetClockCalls())
+func (mock *ApplicationMock) SetClockCalls() []struct {
+	Clock weos.Clock
+} {
+	var calls []struct {
+		Clock weos.Clock
+	}
+	mock.lockSetClock.RLock()
+	calls = mock.calls.SetClock
+	mock.lockSetClock.RUnlock()
+	return calls
+}
+
+// SetIDGenerator calls SetIDGeneratorFunc.
+func (mock *ApplicationMock) SetIDGenerator(generator weos.IDGenerator) {
+	if mock.SetIDGeneratorFunc == nil {
+		panic("ApplicationMock.SetIDGeneratorFunc: method is nil but Application.SetIDGenerator was just called")
+	}
+	callInfo := struct {
+		Generator weos.IDGenerator
+	}{
+		Generator: generator,
+	}
+	mock.lockSetIDGenerator.Lock()
+	mock.calls.SetIDGenerator = append(mock.calls.SetIDGenerator, callInfo)
+	mock.lockSetIDGenerator.Unlock()
+	mock.SetIDGeneratorFunc(generator)
+}
+
+// SetIDGeneratorCalls gets all the calls that were made to SetIDGenerator.
+// Check the length with:
+//     len(mockedApplication.SetIDGeneratorCalls())
+func (mock *ApplicationMock) SetIDGeneratorCalls() []struct {
+	Generator weos.IDGenerator
+} {
+	var calls []struct {
+		Generator weos.IDGenerator
+	}
+	mock.lockSetIDGenerator.RLock()
+	calls = mock.calls.SetIDGenerator
+	mock.lockSetIDGenerator.RUnlock()
+	return calls
+}
+
+// Statistics calls StatisticsFunc.
+func (mock *ApplicationMock) Statistics(ctx context.Context, filter weos.EventFilter) (*weos.EventStatistics, error) {
+	if mock.StatisticsFunc == nil {
+		panic("ApplicationMock.StatisticsFunc: method is nil but Application.Statistics was just called")
+	}
+	callInfo := struct {
+		Ctx    context.Context
+		Filter weos.EventFilter
+	}{
+		Ctx:    ctx,
+		Filter: filter,
+	}
+	mock.lockStatistics.Lock()
+	mock.calls.Statistics = append(mock.calls.Statistics, callInfo)
+	mock.lockStatistics.Unlock()
+	return mock.StatisticsFunc(ctx, filter)
+}
+
+// StatisticsCalls gets all the calls that were made to Statistics.
+// Check the length with:
+//     len(mockedApplication.StatisticsCalls())
+func (mock *ApplicationMock) StatisticsCalls() []struct {
+	Ctx    context.Context
+	Filter weos.EventFilter
+} {
+	var calls []struct {
+		Ctx    context.Context
+		Filter weos.EventFilter
+	}
+	mock.lockStatistics.RLock()
+	calls = mock.calls.Statistics
+	mock.lockStatistics.RUnlock()
+	return calls
+}
+
 // Title calls TitleFunc.
 func (mock *ApplicationMock) Title() string {
 	if mock.TitleFunc == nil {
@@ -1784,3 +2294,29 @@ func (mock *ApplicationMock) TitleCalls() []struct {
 	mock.lockTitle.RUnlock()
 	return calls
 }
+
+// Tracer calls TracerFunc.
+func (mock *ApplicationMock) Tracer() *weos.Tracer {
+	if mock.TracerFunc == nil {
+		panic("ApplicationMock.TracerFunc: method is nil but Application.Tracer was just called")
+	}
+	callInfo := struct {
+	}{}
+	mock.lockTracer.Lock()
+	mock.calls.Tracer = append(mock.calls.Tracer, callInfo)
+	mock.lockTracer.Unlock()
+	return mock.TracerFunc()
+}
+
+// TracerCalls gets all the calls that were made to Tracer.
+// Check the length with:
+//     len(mockedApplication.TracerCalls())
+func (mock *ApplicationMock) TracerCalls() []struct {
+} {
+	var calls []struct {
+	}
+	mock.lockTracer.RLock()
+	calls = mock.calls.Tracer
+	mock.lockTracer.RUnlock()
+	return calls
+}
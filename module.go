@@ -4,6 +4,7 @@ package weos
 
 import (
 	"database/sql"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	_ "github.com/lib/pq"
@@ -18,25 +19,35 @@ import (
 	"gorm.io/gorm"
 	"net/http"
 	"os"
-	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 type ApplicationConfig struct {
-	ModuleID      string     `json:"moduleId"`
-	Title         string     `json:"title"`
-	AccountID     string     `json:"accountId"`
-	ApplicationID string     `json:"applicationId"`
-	AccountName   string     `json:"accountName"`
-	Database      *DBConfig  `json:"database"`
-	Log           *LogConfig `json:"log"`
-	BaseURL       string     `json:"baseURL"`
-	LoginURL      string     `json:"loginURL"`
-	GraphQLURL    string     `json:"graphQLURL"`
-	SessionKey    string     `json:"sessionKey"`
-	Secret        string     `json:"secret"`
-	AccountURL    string     `json:"accountURL"`
+	ModuleID      string         `json:"moduleId"`
+	Title         string         `json:"title"`
+	AccountID     string         `json:"accountId"`
+	ApplicationID string         `json:"applicationId"`
+	AccountName   string         `json:"accountName"`
+	Database      *DBConfig      `json:"database"`
+	Log           *LogConfig     `json:"log"`
+	BaseURL       string         `json:"baseURL"`
+	LoginURL      string         `json:"loginURL"`
+	GraphQLURL    string         `json:"graphQLURL"`
+	SessionKey    string         `json:"sessionKey"`
+	Secret        string         `json:"secret"`
+	AccountURL    string         `json:"accountURL"`
+	Tracing       *TracingConfig `json:"tracing"`
+	//JWKSFile is a JSON Web Key Set with the public keys used to verify RS256 tokens
+	JWKSFile string `json:"jwksFile"`
+	//JWTSecret is the secret HS256 tokens are signed with. If it's empty tokens are signed with the Secret
+	JWTSecret string `json:"jwtSecret"`
+	//DeriveJWTKey signs HS256 tokens with a key derived from the Secret (DeriveKey(secret, "jwt")) instead of the Secret
+	//so that the Secret isn't shared with token issuers. Issuers sign tokens with the derived key
+	DeriveJWTKey bool `json:"deriveJWTKey"`
+	//HashChain makes the event store tamper evident. The hashes are HMACs if a Secret is set
+	HashChain bool `json:"hashChain"`
 }
 
 type DBConfig struct {
@@ -48,6 +59,22 @@ type DBConfig struct {
 	Driver   string `json:"driver"`
 	MaxOpen  int    `json:"max-open"`
 	MaxIdle  int    `json:"max-idle"`
+	//DSN is used as the connection string as is instead of building one from the other settings
+	DSN string `json:"dsn"`
+	//timeouts and connection lifetimes are in seconds
+	ConnectTimeout  int               `json:"connect-timeout"`
+	ReadTimeout     int               `json:"read-timeout"`
+	WriteTimeout    int               `json:"write-timeout"`
+	ConnMaxLifetime int               `json:"conn-max-lifetime"`
+	ConnMaxIdleTime int               `json:"conn-max-idle-time"`
+	TLS             *TLSConfig        `json:"tls"`
+	Params          map[string]string `json:"params"`
+}
+
+type TracingConfig struct {
+	//Exporter is the built in exporter to send spans to. Only "stdout" is supported, other exporters can be set on
+	//the tracer
+	Exporter string `json:"exporter"`
 }
 
 type LogConfig struct {
@@ -69,6 +96,16 @@ type Application interface {
 	EventRepository() EventRepository
 	HTTPClient() *http.Client
 	Dispatcher() Dispatcher
+	QueryDispatcher() QueryDispatcher
+	AddHealthCheck(name string, check HealthCheck)
+	Health(ctx context.Context) *HealthReport
+	Metrics() *Metrics
+	Tracer() *Tracer
+	Statistics(ctx context.Context, filter EventFilter) (*EventStatistics, error)
+	Clock() Clock
+	IDGenerator() IDGenerator
+	SetClock(clock Clock)
+	SetIDGenerator(generator IDGenerator)
 }
 
 //Module is the core of the WeOS framework. It has a config, command handler and basic metadata as a default.
@@ -84,6 +121,17 @@ type BaseApplication struct {
 	eventRepository EventRepository
 	httpClient      *http.Client
 	dispatcher      Dispatcher
+	queryDispatcher QueryDispatcher
+	health          *HealthRegistry
+	healthOnce      sync.Once
+	metrics         *Metrics
+	tracer          *Tracer
+	clock           Clock
+	idGenerator     IDGenerator
+	hosted          bool
+	hostMutex       sync.RWMutex
+	//moduleRepository stamps the events persisted by a hosted module with the module id
+	moduleRepository EventRepository
 }
 
 func (w *BaseApplication) Logger() Log {
@@ -109,11 +157,43 @@ func (w *BaseApplication) DBConnection() *sql.DB {
 func (w *BaseApplication) AddProjection(projection Projection) error {
 	w.projections = append(w.projections, projection)
 	if w.eventRepository != nil {
-		w.eventRepository.AddSubscriber(projection.GetEventHandler())
+		//the handler is tracked so that the projection lag can be reported in health checks
+		tracker := &ProjectionTracker{}
+		w.eventRepository.AddSubscriber(w.moduleEvents(tracker.Track(projection.GetEventHandler())))
+		w.healthRegistry().AddProjection(ProjectionName(projection), tracker)
+	}
+	if checker, ok := projection.(HealthChecker); ok {
+		w.AddHealthCheck("projection:"+ProjectionName(projection)+":status", checker.HealthCheck)
 	}
 	return nil
 }
 
+//moduleEvents wraps the event handler of a projection so that once the application is hosted as a module it only
+//receives the events of the module. Modules use Host.SubscribeToModule to react to the events of other modules
+func (w *BaseApplication) moduleEvents(handler EventHandler) EventHandler {
+	return func(ctx context.Context, event Event) {
+		if w.isHosted() && event.Meta.Module != w.id {
+			return
+		}
+		handler(ctx, event)
+	}
+}
+
+//setHosted is called by the host the application is added to as a module. From then on the event repository of the
+//application stamps the events it persists with the module id so that they reach the module's projections
+func (w *BaseApplication) setHosted() {
+	w.hostMutex.Lock()
+	defer w.hostMutex.Unlock()
+	w.hosted = true
+	w.moduleRepository = &moduleEventRepository{EventRepository: w.eventRepository, moduleID: w.id}
+}
+
+func (w *BaseApplication) isHosted() bool {
+	w.hostMutex.RLock()
+	defer w.hostMutex.RUnlock()
+	return w.hosted
+}
+
 func (w *BaseApplication) Projections() []Projection {
 	return w.projections
 }
@@ -124,13 +204,30 @@ func (w *BaseApplication) DB() *gorm.DB {
 
 func (w *BaseApplication) Migrate(ctx context.Context) error {
 	w.logger.Infof("preparing to migrate %d projections", len(w.projections))
+	//projections with versioned migrations are migrated together so that the migration lock is only taken once
+	var migrator *Migrator
 	for _, projection := range w.projections {
+		if provider, ok := projection.(MigrationProvider); ok {
+			if migrator == nil {
+				migrator = NewMigrator(w.db, w.logger)
+			}
+			if err := migrator.RegisterProvider(provider); err != nil {
+				return err
+			}
+			continue
+		}
 		err := projection.Migrate(ctx)
 		if err != nil {
 			return err
 		}
 	}
 
+	if migrator != nil {
+		if err := migrator.Up(ctx); err != nil {
+			return err
+		}
+	}
+
 	err := w.EventRepository().Migrate(ctx)
 	if err != nil {
 		return err
@@ -140,6 +237,11 @@ func (w *BaseApplication) Migrate(ctx context.Context) error {
 }
 
 func (w *BaseApplication) EventRepository() EventRepository {
+	w.hostMutex.RLock()
+	defer w.hostMutex.RUnlock()
+	if w.hosted {
+		return w.moduleRepository
+	}
 	return w.eventRepository
 }
 
@@ -151,6 +253,95 @@ func (w *BaseApplication) Dispatcher() Dispatcher {
 	return w.dispatcher
 }
 
+//QueryDispatcher sends queries to the handler registered for the query type and returns the result
+func (w *BaseApplication) QueryDispatcher() QueryDispatcher {
+	return w.queryDispatcher
+}
+
+//AddHealthCheck registers a check that is run when the application health is requested
+func (w *BaseApplication) AddHealthCheck(name string, check HealthCheck) {
+	w.healthRegistry().AddCheck(name, check)
+}
+
+//Health runs all the registered health checks and reports on the status of the application
+func (w *BaseApplication) Health(ctx context.Context) *HealthReport {
+	return w.healthRegistry().Check(ctx)
+}
+
+//Metrics is the registry of the metrics collected by the application. Use Metrics().Handler() to expose them
+func (w *BaseApplication) Metrics() *Metrics {
+	return w.metrics
+}
+
+//Tracer creates the spans for commands, persisted events and event handlers. Use Tracer().SetExporter to change where
+//spans are sent
+func (w *BaseApplication) Tracer() *Tracer {
+	return w.tracer
+}
+
+//Statistics summarizes the events in the event repository for dashboards and reports
+func (w *BaseApplication) Statistics(ctx context.Context, filter EventFilter) (*EventStatistics, error) {
+	provider, ok := w.eventRepository.(StatisticsProvider)
+	if !ok {
+		return nil, NewError("the event repository doesn't support statistics", nil)
+	}
+	return provider.Statistics(ctx, filter)
+}
+
+//Clock is the clock used by the dispatchers and event repository
+func (w *BaseApplication) Clock() Clock {
+	if w.clock == nil {
+		return DefaultClock
+	}
+	return w.clock
+}
+
+//SetClock changes the clock of the dispatchers and event repository e.g. to a FakeClock in tests
+func (w *BaseApplication) SetClock(clock Clock) {
+	w.clock = clock
+	if dispatcher, ok := w.dispatcher.(*DefaultCommandDispatcher); ok {
+		dispatcher.Clock = clock
+	}
+	if dispatcher, ok := w.queryDispatcher.(*DefaultQueryDispatcher); ok {
+		dispatcher.Clock = clock
+	}
+	if repository, ok := w.eventRepository.(interface{ SetClock(clock Clock) }); ok {
+		repository.SetClock(clock)
+	}
+}
+
+//IDGenerator generates the ids of commands, queries and events
+func (w *BaseApplication) IDGenerator() IDGenerator {
+	if w.idGenerator == nil {
+		return DefaultIDGenerator
+	}
+	return w.idGenerator
+}
+
+//SetIDGenerator changes the id generator of the dispatchers and event repository e.g. to a FakeIDGenerator in tests
+func (w *BaseApplication) SetIDGenerator(generator IDGenerator) {
+	w.idGenerator = generator
+	if dispatcher, ok := w.dispatcher.(*DefaultCommandDispatcher); ok {
+		dispatcher.IDGenerator = generator
+	}
+	if dispatcher, ok := w.queryDispatcher.(*DefaultQueryDispatcher); ok {
+		dispatcher.IDGenerator = generator
+	}
+	if repository, ok := w.eventRepository.(interface{ SetIDGenerator(generator IDGenerator) }); ok {
+		repository.SetIDGenerator(generator)
+	}
+}
+
+func (w *BaseApplication) healthRegistry() *HealthRegistry {
+	//applications that weren't created with NewApplicationFromConfig get a registry the first time it's used
+	w.healthOnce.Do(func() {
+		if w.health == nil {
+			w.health = &HealthRegistry{}
+		}
+	})
+	return w.health
+}
+
 var NewApplicationFromConfig = func(config *ApplicationConfig, logger Log, db *sql.DB, client *http.Client, eventRepository EventRepository) (*BaseApplication, error) {
 
 	var err error
@@ -193,58 +384,32 @@ var NewApplicationFromConfig = func(config *ApplicationConfig, logger Log, db *s
 	}
 
 	if db == nil && config.Database != nil {
-		var connStr string
-
-		switch config.Database.Driver {
-		case "sqlite3":
-			//check if file exists and if not create it. We only do this if a memory only db is NOT asked for
-			//(Note that if it's a combination we go ahead and create the file) https://www.sqlite.org/inmemorydb.html
-			if config.Database.Database != ":memory:" {
-				if _, err = os.Stat(config.Database.Database); os.IsNotExist(err) {
-					_, err = os.Create(strings.Replace(config.Database.Database, ":memory:", "", -1))
-					if err != nil {
-						return nil, NewError(fmt.Sprintf("error creating sqlite database '%s'", config.Database.Database), err)
-					}
+		//check if file exists and if not create it. We only do this if a memory only db is NOT asked for
+		//(Note that if it's a combination we go ahead and create the file) https://www.sqlite.org/inmemorydb.html
+		if config.Database.Driver == "sqlite3" && config.Database.DSN == "" && config.Database.Database != ":memory:" {
+			if _, err = os.Stat(config.Database.Database); os.IsNotExist(err) {
+				_, err = os.Create(strings.Replace(config.Database.Database, ":memory:", "", -1))
+				if err != nil {
+					return nil, NewError(fmt.Sprintf("error creating sqlite database '%s'", config.Database.Database), err)
 				}
 			}
+		}
 
-			connStr = fmt.Sprintf("%s",
-				config.Database.Database)
-
-			//update connection string to include authentication IF a username is set
-			if config.Database.User != "" {
-				authenticationString := fmt.Sprintf("?_auth&_auth_user=%s&_auth_pass=%s&_auth_crypt=sha512&_foreign_keys=on",
-					config.Database.User, config.Database.Password)
-				connStr = connStr + authenticationString
-			} else {
-				connStr = connStr + "?_foreign_keys=on"
-			}
-			log.Debugf("sqlite connection string '%s'", connStr)
-		case "sqlserver":
-			connStr = fmt.Sprintf("sqlserver://%s:%s@%s:%s/%s",
-				config.Database.User, config.Database.Password, config.Database.Host, strconv.Itoa(config.Database.Port), config.Database.Database)
-		case "ramsql":
-			connStr = "Testing"
-		case "mysql":
-			connStr = fmt.Sprintf("%s:%s@tcp(%s:%s/%s)",
-				config.Database.User, config.Database.Password, config.Database.Host, strconv.Itoa(config.Database.Port), config.Database.Database)
-		case "clickhouse":
-			connStr = fmt.Sprintf("tcp://%s:%s?username=%s&password=%s&database=%s",
-				config.Database.Host, strconv.Itoa(config.Database.Port), config.Database.User, config.Database.Password, config.Database.Database)
-		case "postgres":
-			connStr = fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-				config.Database.Host, strconv.Itoa(config.Database.Port), config.Database.User, config.Database.Password, config.Database.Database)
-		default:
-			return nil, errors.New(fmt.Sprintf("db driver '%s' is not supported ", config.Database.Driver))
+		var connStr string
+		connStr, err = NewDSN(config.Database)
+		if err != nil {
+			return nil, err
 		}
 
-		db, err = sql.Open(config.Database.Driver, connStr)
+		db, err = openDB(config.Database, connStr)
 		if err != nil {
 			return nil, NewError("error setting up connection to database", err)
 		}
 
 		db.SetMaxOpenConns(config.Database.MaxOpen)
 		db.SetMaxIdleConns(config.Database.MaxIdle)
+		db.SetConnMaxLifetime(time.Duration(config.Database.ConnMaxLifetime) * time.Second)
+		db.SetConnMaxIdleTime(time.Duration(config.Database.ConnMaxIdleTime) * time.Second)
 
 	}
 
@@ -297,6 +462,8 @@ var NewApplicationFromConfig = func(config *ApplicationConfig, logger Log, db *s
 			Timeout: time.Second * 10,
 		}
 	}
+	//outbound requests carry the id of the request that made them
+	client = withRequestID(client)
 
 	if eventRepository == nil {
 		eventRepository, err = NewBasicEventRepository(gormDB, logger, false, config.AccountID, config.ApplicationID)
@@ -305,7 +472,31 @@ var NewApplicationFromConfig = func(config *ApplicationConfig, logger Log, db *s
 		}
 	}
 
-	return &BaseApplication{
+	if config.HashChain {
+		if chained, ok := eventRepository.(interface{ EnableHashChain(secret string) }); ok {
+			secret := ""
+			if config.Secret != "" {
+				secret = hex.EncodeToString(DeriveKey(config.Secret, "hash-chain"))
+			}
+			chained.EnableHashChain(secret)
+		}
+	}
+
+	//instrument the dispatcher and event repository
+	metrics := NewMetrics()
+	if instrumented, ok := eventRepository.(interface{ SetMetrics(metrics *Metrics) }); ok {
+		instrumented.SetMetrics(metrics)
+	}
+	var exporter SpanExporter
+	if config.Tracing != nil && config.Tracing.Exporter == "stdout" {
+		exporter = NewStdoutSpanExporter()
+	}
+	tracer := NewTracer(exporter, logger)
+	if traced, ok := eventRepository.(interface{ SetTracer(tracer *Tracer) }); ok {
+		traced.SetTracer(tracer)
+	}
+
+	app := &BaseApplication{
 		id:              config.ModuleID,
 		title:           config.Title,
 		logger:          logger,
@@ -314,6 +505,21 @@ var NewApplicationFromConfig = func(config *ApplicationConfig, logger Log, db *s
 		config:          config,
 		httpClient:      client,
 		eventRepository: eventRepository,
-		dispatcher:      &DefaultCommandDispatcher{},
-	}, nil
+		dispatcher:      &DefaultCommandDispatcher{Metrics: metrics, Tracer: tracer},
+		queryDispatcher: &DefaultQueryDispatcher{Metrics: metrics, Tracer: tracer},
+		health:          &HealthRegistry{},
+		metrics:         metrics,
+		tracer:          tracer,
+	}
+
+	//register health checks for the core components
+	app.AddHealthCheck("database", DBHealthCheck(db))
+	if checker, ok := eventRepository.(HealthChecker); ok {
+		app.AddHealthCheck("event_repository", checker.HealthCheck)
+	}
+	if checker, ok := app.dispatcher.(HealthChecker); ok {
+		app.AddHealthCheck("dispatcher", checker.HealthCheck)
+	}
+
+	return app, nil
 }
@@ -57,6 +57,10 @@ func TestNewApplicationFromConfig(t *testing.T) {
 		if app.EventRepository() == nil {
 			t.Errorf("expected a default event repository to be setup")
 		}
+
+		if app.Metrics() == nil {
+			t.Errorf("expected the metrics registry to be setup")
+		}
 	})
 
 	t.Run("override logger", func(t *testing.T) {
@@ -0,0 +1,217 @@
+package weos
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Query is a request to read data. Unlike commands, queries don't change state and their handler returns a result
+type Query struct {
+	ID      string          `json:"id"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+type QueryHandler func(ctx context.Context, query *Query) (interface{}, error)
+
+//QueryMiddleware wraps query handlers so that concerns like authorization, caching and logging are applied to all
+//queries
+type QueryMiddleware func(next QueryHandler) QueryHandler
+
+type QueryDispatcher interface {
+	Dispatch(ctx context.Context, query *Query) (interface{}, error)
+	AddSubscriber(query *Query, handler QueryHandler) map[string]QueryHandler
+	GetSubscribers() map[string]QueryHandler
+	Use(middleware ...QueryMiddleware)
+}
+
+//DefaultQueryDispatcher sends each query to the one handler registered for its type
+type DefaultQueryDispatcher struct {
+	handlers   map[string]QueryHandler
+	middleware []QueryMiddleware
+	mutex      sync.RWMutex
+	Metrics    *Metrics
+	Tracer     *Tracer
+	//Clock and IDGenerator are added to the context of handlers
+	Clock       Clock
+	IDGenerator IDGenerator
+}
+
+func (d *DefaultQueryDispatcher) Dispatch(ctx context.Context, query *Query) (result interface{}, err error) {
+	ctx = clockContext(ctx, d.Clock, d.IDGenerator)
+	if query.ID == "" {
+		query.ID = GetIDGenerator(ctx).NewID()
+	}
+	ctx, span := d.Tracer.StartSpan(ctx, "query.dispatch")
+	span.SetAttribute("query.type", query.Type)
+	span.SetAttribute("query.id", query.ID)
+	start := time.Now()
+	metricLabel := UnknownLabel
+	defer func() {
+		d.Metrics.observeQuery(metricLabel, time.Since(start), err)
+		span.SetError(err)
+		span.Finish()
+	}()
+
+	d.mutex.RLock()
+	handler, ok := d.handlers[query.Type]
+	middleware := d.middleware
+	d.mutex.RUnlock()
+	if !ok {
+		return nil, NewNotFoundError(ctx, "query_not_found", fmt.Sprintf("no handler registered for query '%s'", query.Type), nil)
+	}
+	metricLabel = query.Type
+	//the first middleware added is the outermost
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler(ctx, query)
+}
+
+//AddSubscriber sets the handler for the query type. There is only one handler per query type since it returns the result
+func (d *DefaultQueryDispatcher) AddSubscriber(query *Query, handler QueryHandler) map[string]QueryHandler {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.handlers == nil {
+		d.handlers = map[string]QueryHandler{}
+	}
+	d.handlers[query.Type] = handler
+	return d.handlers
+}
+
+func (d *DefaultQueryDispatcher) GetSubscribers() map[string]QueryHandler {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	handlers := make(map[string]QueryHandler, len(d.handlers))
+	for queryType, handler := range d.handlers {
+		handlers[queryType] = handler
+	}
+	return handlers
+}
+
+//Use adds middleware that is run around every query handler
+func (d *DefaultQueryDispatcher) Use(middleware ...QueryMiddleware) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.middleware = append(d.middleware, middleware...)
+}
+
+//NewQueryHandler exposes the query dispatcher over HTTP. Queries are either POSTed as JSON or sent with GET where the
+//type is the "type" parameter and the other parameters are the payload
+func NewQueryHandler(app Application) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := &Query{}
+		switch r.Method {
+		case http.MethodGet:
+			parameters := r.URL.Query()
+			query.Type = parameters.Get("type")
+			parameters.Del("type")
+			payload := make(map[string]string)
+			for name := range parameters {
+				payload[name] = parameters.Get(name)
+			}
+			query.Payload, _ = json.Marshal(payload)
+		case http.MethodPost:
+			if err := json.NewDecoder(r.Body).Decode(query); err != nil {
+				writeError(w, r, app.Logger(), NewValidationError(r.Context(), "invalid_query", "invalid query", err))
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]interface{}{"error": NewError("method not allowed", nil)})
+			return
+		}
+		if query.Type == "" {
+			writeError(w, r, app.Logger(), NewValidationError(r.Context(), "invalid_query", "a query type is required", nil))
+			return
+		}
+		result, err := app.QueryDispatcher().Dispatch(r.Context(), query)
+		if err != nil {
+			writeError(w, r, app.Logger(), err)
+			return
+		}
+		writeJSON(w, http.StatusOK, result)
+	}
+}
+
+//NewCommandHandler exposes the command dispatcher over HTTP. Commands are POSTed as JSON and the id of the dispatched
+//command is returned. The metadata user and account are set from the request context and a body naming someone else is
+//rejected with 403
+func NewCommandHandler(app Application) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]interface{}{"error": NewError("method not allowed", nil)})
+			return
+		}
+		command := &Command{}
+		if err := json.NewDecoder(r.Body).Decode(command); err != nil {
+			writeError(w, r, app.Logger(), NewValidationError(r.Context(), "invalid_command", "invalid command", err))
+			return
+		}
+		if command.Type == "" {
+			writeError(w, r, app.Logger(), NewValidationError(r.Context(), "invalid_command", "a command type is required", nil))
+			return
+		}
+		//the user and account that issued the command come from the authenticated request, not the body
+		if err := checkCommandMetadata(r.Context(), command); err != nil {
+			writeError(w, r, app.Logger(), err)
+			return
+		}
+		command.Metadata.UserID = GetUser(r.Context())
+		command.Metadata.AccountID = GetAccount(r.Context())
+		if err := app.Dispatcher().Dispatch(r.Context(), command); err != nil {
+			writeError(w, r, app.Logger(), err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"id": command.ID})
+	}
+}
+
+//writeError writes the error with the status code of its category. Internal errors are logged and the response only
+//has a generic message so that the details of the application (e.g. database errors) aren't sent to clients. Errors
+//that aren't WeOS errors are wrapped so that the response has the same shape
+func writeError(w http.ResponseWriter, r *http.Request, logger Log, err error) {
+	status := HTTPStatus(err)
+	if GetErrorCategory(err) == ErrorCategoryInternal {
+		LoggerWithContext(r.Context(), defaultLogger(logger)).Errorf("error handling request '%s': %s", r.URL.Path, errorChain(err))
+		internalError := NewErrorWithContext(r.Context(), "an internal error occurred", nil)
+		internalError.SetCode("internal_error", ErrorCategoryInternal)
+		err = internalError
+	} else if _, ok := err.(json.Marshaler); !ok {
+		err = NewError(err.Error(), nil)
+	}
+	writeJSON(w, status, map[string]interface{}{"error": err})
+}
+
+//errorChain is the message of the error and the errors it wraps (WeOS errors only return their own message)
+func errorChain(err error) string {
+	messages := []string{err.Error()}
+	for cause := errors.Unwrap(err); cause != nil; cause = errors.Unwrap(cause) {
+		if message := cause.Error(); message != messages[len(messages)-1] {
+			messages = append(messages, message)
+		}
+	}
+	return strings.Join(messages, ": ")
+}
+
+//defaultLogger falls back to the standard logger for components that weren't given one
+func defaultLogger(logger Log) Log {
+	if logger == nil {
+		return log.StandardLogger()
+	}
+	return logger
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(value)
+}
@@ -0,0 +1,246 @@
+package weos_test
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/wepala/weos"
+	"golang.org/x/net/context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestQueryDispatcher_Dispatch(t *testing.T) {
+	dispatcher := &weos.DefaultQueryDispatcher{}
+	dispatcher.AddSubscriber(&weos.Query{Type: "GET_POST"}, func(ctx context.Context, query *weos.Query) (interface{}, error) {
+		var payload struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(query.Payload, &payload); err != nil {
+			return nil, err
+		}
+		return "post " + payload.ID, nil
+	})
+
+	t.Run("the handler result is returned", func(t *testing.T) {
+		query := &weos.Query{Type: "GET_POST", Payload: json.RawMessage(`{"id":"123"}`)}
+		result, err := dispatcher.Dispatch(context.TODO(), query)
+		if err != nil {
+			t.Fatalf("unexpected error dispatching query '%s'", err)
+		}
+		if result != "post 123" {
+			t.Errorf("expected the result to be '%s', got '%v'", "post 123", result)
+		}
+		if query.ID == "" {
+			t.Error("expected the query to be assigned an id")
+		}
+	})
+
+	t.Run("an error is returned for unknown queries", func(t *testing.T) {
+		_, err := dispatcher.Dispatch(context.TODO(), &weos.Query{Type: "UNKNOWN"})
+		if err == nil {
+			t.Fatal("expected an error dispatching a query with no handler")
+		}
+	})
+
+	t.Run("middleware runs in the order it was added", func(t *testing.T) {
+		var calls []string
+		tracking := func(name string) weos.QueryMiddleware {
+			return func(next weos.QueryHandler) weos.QueryHandler {
+				return func(ctx context.Context, query *weos.Query) (interface{}, error) {
+					calls = append(calls, name)
+					return next(ctx, query)
+				}
+			}
+		}
+		dispatcher.Use(tracking("first"), tracking("second"))
+		dispatcher.Use(func(next weos.QueryHandler) weos.QueryHandler {
+			return func(ctx context.Context, query *weos.Query) (interface{}, error) {
+				if query.Type == "GET_POST" && strings.Contains(string(query.Payload), "secret") {
+					return nil, errors.New("forbidden")
+				}
+				return next(ctx, query)
+			}
+		})
+		if _, err := dispatcher.Dispatch(context.TODO(), &weos.Query{Type: "GET_POST", Payload: json.RawMessage(`{"id":"1"}`)}); err != nil {
+			t.Fatalf("unexpected error dispatching query '%s'", err)
+		}
+		if strings.Join(calls, ",") != "first,second" {
+			t.Errorf("expected the middleware to be called in order, got '%v'", calls)
+		}
+		if _, err := dispatcher.Dispatch(context.TODO(), &weos.Query{Type: "GET_POST", Payload: json.RawMessage(`{"id":"secret"}`)}); err == nil {
+			t.Error("expected the middleware to be able to stop the query")
+		}
+	})
+}
+
+func TestNewQueryHandler(t *testing.T) {
+	config := &weos.ApplicationConfig{
+		ModuleID: "1iPwGftUqaP4rkWdvFp6BBW2tOf",
+		Title:    "Test Module",
+		Database: &weos.DBConfig{
+			Driver:   "sqlite3",
+			Database: ":memory:",
+		},
+	}
+	app, err := weos.NewApplicationFromConfig(config, nil, nil, nil, &EventRepositoryMock{})
+	if err != nil {
+		t.Fatalf("unexpected error setting up app '%s'", err)
+	}
+	app.QueryDispatcher().AddSubscriber(&weos.Query{Type: "GET_POST"}, func(ctx context.Context, query *weos.Query) (interface{}, error) {
+		var payload map[string]string
+		if err := json.Unmarshal(query.Payload, &payload); err != nil {
+			return nil, err
+		}
+		if payload["id"] == "missing" {
+			return nil, errors.New("something went wrong")
+		}
+		return map[string]string{"id": payload["id"], "title": "First Post"}, nil
+	})
+	handler := weos.NewQueryHandler(app)
+
+	t.Run("query sent with GET", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		handler(rw, httptest.NewRequest(http.MethodGet, "/query?type=GET_POST&id=123", nil))
+		if rw.Code != http.StatusOK {
+			t.Fatalf("expected the status to be %d, got %d", http.StatusOK, rw.Code)
+		}
+		var result map[string]string
+		if err := json.NewDecoder(rw.Body).Decode(&result); err != nil {
+			t.Fatalf("unexpected error decoding result '%s'", err)
+		}
+		if result["id"] != "123" {
+			t.Errorf("expected the id to be '%s', got '%s'", "123", result["id"])
+		}
+	})
+
+	t.Run("query sent with POST", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		handler(rw, httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(`{"type":"GET_POST","payload":{"id":"456"}}`)))
+		if rw.Code != http.StatusOK {
+			t.Fatalf("expected the status to be %d, got %d", http.StatusOK, rw.Code)
+		}
+		if !strings.Contains(rw.Body.String(), `"456"`) {
+			t.Errorf("expected the result to contain the id, got '%s'", rw.Body.String())
+		}
+	})
+
+	t.Run("errors are mapped to status codes", func(t *testing.T) {
+		tests := []struct {
+			request *http.Request
+			status  int
+		}{
+			{httptest.NewRequest(http.MethodGet, "/query?type=UNKNOWN", nil), http.StatusNotFound},
+			{httptest.NewRequest(http.MethodGet, "/query", nil), http.StatusBadRequest},
+			{httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(`{`)), http.StatusBadRequest},
+			{httptest.NewRequest(http.MethodDelete, "/query", nil), http.StatusMethodNotAllowed},
+			{httptest.NewRequest(http.MethodGet, "/query?type=GET_POST&id=missing", nil), http.StatusInternalServerError},
+		}
+		for _, test := range tests {
+			rw := httptest.NewRecorder()
+			handler(rw, test.request)
+			if rw.Code != test.status {
+				t.Errorf("expected %s %s to return %d, got %d", test.request.Method, test.request.URL, test.status, rw.Code)
+			}
+		}
+	})
+
+	t.Run("internal errors are not sent to clients", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		handler(rw, httptest.NewRequest(http.MethodGet, "/query?type=GET_POST&id=missing", nil))
+		if strings.Contains(rw.Body.String(), "something went wrong") {
+			t.Errorf("expected the internal error not to be in the response, got '%s'", rw.Body.String())
+		}
+		if !strings.Contains(rw.Body.String(), `"code":"internal_error"`) {
+			t.Errorf("expected a generic error in the response, got '%s'", rw.Body.String())
+		}
+	})
+}
+
+func TestNewCommandHandler(t *testing.T) {
+	dispatched := &weos.Command{}
+	app := &ApplicationMock{
+		DispatcherFunc: func() weos.Dispatcher {
+			return &DispatcherMock{
+				DispatchFunc: func(ctx context.Context, command *weos.Command) error {
+					command.ID = "command-1"
+					dispatched = command
+					return nil
+				},
+			}
+		},
+	}
+	rw := httptest.NewRecorder()
+	weos.NewCommandHandler(app)(rw, httptest.NewRequest(http.MethodPost, "/command", strings.NewReader(`{"type":"CREATE_POST","payload":{"title":"First Post"}}`)))
+	if rw.Code != http.StatusOK {
+		t.Fatalf("expected the status to be %d, got %d", http.StatusOK, rw.Code)
+	}
+	if dispatched.Type != "CREATE_POST" {
+		t.Errorf("expected the command type to be '%s', got '%s'", "CREATE_POST", dispatched.Type)
+	}
+	if !strings.Contains(rw.Body.String(), "command-1") {
+		t.Errorf("expected the command id to be returned, got '%s'", rw.Body.String())
+	}
+}
+
+func TestNewCommandHandler_Metadata(t *testing.T) {
+	authorizer := weos.NewPolicyAuthorizer()
+	authorizer.SetPolicy("CREATE_POST", weos.RequireUser())
+	var dispatched *weos.Command
+	dispatcher := &weos.DefaultCommandDispatcher{Authorizer: authorizer}
+	dispatcher.AddSubscriber(&weos.Command{Type: "CREATE_POST"}, func(ctx context.Context, command *weos.Command) error {
+		dispatched = command
+		return nil
+	})
+	app := &ApplicationMock{
+		DispatcherFunc: func() weos.Dispatcher {
+			return dispatcher
+		},
+		LoggerFunc: func() weos.Log {
+			return &LogMock{ErrorfFunc: func(format string, args ...interface{}) {}}
+		},
+	}
+	body := `{"type":"CREATE_POST","metadata":{"userId":"user-1","accountId":"account-1"}}`
+
+	t.Run("anonymous requests can't claim a user in the metadata", func(t *testing.T) {
+		dispatched = nil
+		rw := httptest.NewRecorder()
+		weos.NewCommandHandler(app)(rw, httptest.NewRequest(http.MethodPost, "/command", strings.NewReader(body)))
+		if rw.Code != http.StatusUnauthorized {
+			t.Errorf("expected the status to be %d, got %d", http.StatusUnauthorized, rw.Code)
+		}
+		if dispatched != nil {
+			t.Error("expected the handler not to be called")
+		}
+	})
+
+	t.Run("metadata naming another user is forbidden", func(t *testing.T) {
+		dispatched = nil
+		r := httptest.NewRequest(http.MethodPost, "/command", strings.NewReader(body))
+		r = r.WithContext(context.WithValue(r.Context(), weos.USER_ID, "user-2"))
+		rw := httptest.NewRecorder()
+		weos.NewCommandHandler(app)(rw, r)
+		if rw.Code != http.StatusForbidden {
+			t.Errorf("expected the status to be %d, got %d", http.StatusForbidden, rw.Code)
+		}
+		if dispatched != nil {
+			t.Error("expected the handler not to be called")
+		}
+	})
+
+	t.Run("the metadata is set from the context", func(t *testing.T) {
+		dispatched = nil
+		r := httptest.NewRequest(http.MethodPost, "/command", strings.NewReader(`{"type":"CREATE_POST"}`))
+		ctx := context.WithValue(r.Context(), weos.USER_ID, "user-2")
+		ctx = context.WithValue(ctx, weos.ACCOUNT_ID, "account-2")
+		rw := httptest.NewRecorder()
+		weos.NewCommandHandler(app)(rw, r.WithContext(ctx))
+		if rw.Code != http.StatusOK {
+			t.Fatalf("expected the status to be %d, got %d", http.StatusOK, rw.Code)
+		}
+		if dispatched.Metadata.UserID != "user-2" || dispatched.Metadata.AccountID != "account-2" {
+			t.Errorf("expected the metadata to be set from the context, got '%+v'", dispatched.Metadata)
+		}
+	})
+}
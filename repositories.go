@@ -2,8 +2,13 @@ package weos
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
-	"github.com/segmentio/ksuid"
 	"golang.org/x/net/context"
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
@@ -12,9 +17,18 @@ import (
 type EventRepositoryGorm struct {
 	DB              *gorm.DB
 	gormDB          *gorm.DB
-	eventDispatcher EventDisptacher
+	eventDispatcher *EventDisptacher
 	logger          Log
 	unitOfWork      bool
+	metrics         *Metrics
+	tracer          *Tracer
+	keyStore        KeyStore
+	encryptionRules []EncryptionRule
+	hashChain       bool
+	hashSecret      []byte
+	chainMutex      *sync.Mutex
+	clock           Clock
+	idGenerator     IDGenerator
 	AccountID       string
 	ApplicationID   string
 	GroupID         string
@@ -30,8 +44,14 @@ type GormEvent struct {
 	Type          string `gorm:"index"`
 	RootID        string `gorm:"index"`
 	ApplicationID string `gorm:"index"`
+	AccountID     string `gorm:"index"`
 	User          string `gorm:"index"`
 	SequenceNo    int64
+	CorrelationID string `gorm:"index"`
+	CausationID   string `gorm:"index"`
+	RequestID     string `gorm:"index"`
+	Hash          string
+	PreviousHash  string
 }
 
 //NewGormEvent converts a domain event to something that is a bit easier for Gorm to work with
@@ -49,16 +69,64 @@ func NewGormEvent(event *Event) (GormEvent, error) {
 		Type:          event.Type,
 		RootID:        event.Meta.RootID,
 		ApplicationID: event.Meta.Module,
+		AccountID:     event.Meta.AccountID,
 		User:          event.Meta.User,
 		SequenceNo:    event.Meta.SequenceNo,
+		CorrelationID: event.Meta.CorrelationID,
+		CausationID:   event.Meta.CausationID,
+		RequestID:     event.Meta.RequestID,
 	}, nil
 }
 
-func (e *EventRepositoryGorm) Persist(ctxt context.Context, entity AggregateInterface) error {
-	//TODO use the information in the context to get account info, module info. //didn't think it should barf if an empty list is passed
+//NewEventsFromGorm converts the events retrieved by Gorm back to domain events
+func NewEventsFromGorm(events []GormEvent) []*Event {
+	var tevents []*Event
+
+	for _, event := range events {
+		var created string
+		if !event.CreatedAt.IsZero() {
+			created = event.CreatedAt.Format(time.RFC3339Nano)
+		}
+		tevents = append(tevents, &Event{
+			ID:      event.ID,
+			Type:    event.Type,
+			Payload: json.RawMessage(event.Payload),
+			Meta: EventMeta{
+				EntityID:      event.EntityID,
+				EntityType:    event.EntityType,
+				RootID:        event.RootID,
+				Module:        event.ApplicationID,
+				AccountID:     event.AccountID,
+				User:          event.User,
+				SequenceNo:    event.SequenceNo,
+				CorrelationID: event.CorrelationID,
+				CausationID:   event.CausationID,
+				RequestID:     event.RequestID,
+				Created:       created,
+			},
+			Version: 0,
+		})
+	}
+	return tevents
+}
+
+func (e *EventRepositoryGorm) Persist(ctxt context.Context, entity AggregateInterface) (err error) {
+	//TODO use the information in the context to get module info. //didn't think it should barf if an empty list is passed
 	var gormEvents []GormEvent
 	entities := entity.GetNewChanges()
-	savePointID := "s" + ksuid.New().String() //NOTE the save point can't start with a number
+	start := time.Now()
+	ctxt, span := e.tracer.StartSpan(ctxt, "event_store.persist")
+	span.SetAttribute("events", strconv.Itoa(len(entities)))
+	defer func() {
+		e.metrics.observePersist(entities, time.Since(start), err)
+		span.SetError(err)
+		span.Finish()
+	}()
+	accountID, err := e.account(ctxt)
+	if err != nil {
+		return err
+	}
+	savePointID := savePointName(e.newID()) //NOTE the save point can't start with a number
 	e.logger.Infof("persisting %d events with save point %s", len(entities), savePointID)
 	if e.unitOfWork {
 		e.DB.SavePoint(savePointID)
@@ -68,14 +136,40 @@ func (e *EventRepositoryGorm) Persist(ctxt context.Context, entity AggregateInte
 		event := entity.(*Event)
 		//let's fill in meta data if it's not already in the object
 		if event.Meta.User == "" {
-			event.Meta.User = GetUser(ctxt)
+			event.Meta.User = ContextUser(ctxt)
+		}
+		if event.Meta.AccountID == "" {
+			event.Meta.AccountID = accountID
+		}
+		if event.Meta.AccountID == "" {
+			event.Meta.AccountID = ContextAccount(ctxt)
+		}
+		//events can only be written to the tenant the repository is scoped to
+		if accountID != "" && event.Meta.AccountID != accountID {
+			e.logger.Errorf("event '%s' belongs to account '%s' not '%s'", event.ID, event.Meta.AccountID, accountID)
+			if e.unitOfWork {
+				e.logger.Debugf("rolling back saving events to %s", savePointID)
+				e.DB.RollbackTo(savePointID)
+			}
+			domainError := NewDomainErrorWithContext(ctxt, "event belongs to another account", "Event", event.Meta.EntityID, nil)
+			domainError.SetCode("account_mismatch", ErrorCategoryUnauthorized)
+			return domainError
 		}
-		if event.Meta.RootID == "" {
-			event.Meta.RootID = GetAccount(ctxt)
+		if event.Meta.Module == "" {
+			event.Meta.Module = GetModuleID(ctxt)
 		}
 		if event.Meta.Module == "" {
 			event.Meta.Module = e.ApplicationID
 		}
+		if event.Meta.CorrelationID == "" {
+			event.Meta.CorrelationID = GetCorrelationID(ctxt)
+		}
+		if event.Meta.CausationID == "" {
+			event.Meta.CausationID = GetCausationID(ctxt)
+		}
+		if event.Meta.RequestID == "" {
+			event.Meta.RequestID = GetRequestID(ctxt)
+		}
 		if event.Meta.Group == "" {
 			event.Meta.Group = e.GroupID
 		}
@@ -95,11 +189,23 @@ func (e *EventRepositoryGorm) Persist(ctxt context.Context, entity AggregateInte
 		if err != nil {
 			return err
 		}
+		gormEvent.CreatedAt = e.now()
+		//personal data is only encrypted in the store, subscribers receive the event as is
+		if e.keyStore != nil {
+			payload, err := encryptPayload(ctxt, e.keyStore, e.encryptionRules, event)
+			if err != nil {
+				return err
+			}
+			gormEvent.Payload = datatypes.JSON(payload)
+		}
 		gormEvents = append(gormEvents, gormEvent)
 	}
-	db := e.DB.Create(gormEvents)
-	if db.Error != nil {
-		return db.Error
+	if err = e.create(gormEvents); err != nil {
+		return err
+	}
+	//subscribers get the time the events were stored at so that checkpoints line up with the events in the store
+	for i, entity := range entities {
+		entity.(*Event).Meta.Created = gormEvents[i].CreatedAt.Format(time.RFC3339Nano)
 	}
 
 	//call persist on the aggregate root to clear the new changes array
@@ -114,30 +220,12 @@ func (e *EventRepositoryGorm) Persist(ctxt context.Context, entity AggregateInte
 //GetByAggregate get events for a root aggregate
 func (e *EventRepositoryGorm) GetByAggregate(ID string) ([]*Event, error) {
 	var events []GormEvent
-	result := e.DB.Order("sequence_no asc").Where("root_id = ?", ID).Find(&events)
+	result := e.scoped().Order("sequence_no asc").Where("root_id = ?", ID).Find(&events)
 	if result.Error != nil {
 		return nil, result.Error
 	}
 
-	var tevents []*Event
-
-	for _, event := range events {
-		tevents = append(tevents, &Event{
-			ID:      event.ID,
-			Type:    event.Type,
-			Payload: json.RawMessage(event.Payload),
-			Meta: EventMeta{
-				EntityID:   event.EntityID,
-				EntityType: event.EntityType,
-				RootID:     event.RootID,
-				Module:     event.ApplicationID,
-				User:       event.User,
-				SequenceNo: event.SequenceNo,
-			},
-			Version: 0,
-		})
-	}
-	return tevents, nil
+	return e.decryptEvents(e.ctxt(), NewEventsFromGorm(events))
 
 }
 
@@ -146,64 +234,28 @@ func (e *EventRepositoryGorm) GetByAggregate(ID string) ([]*Event, error) {
 //events should now be retrieved by root id,entity type and entity id. Use GetByEntityAndAggregate instead
 func (e *EventRepositoryGorm) GetByAggregateAndType(ID string, entityType string) ([]*Event, error) {
 	var events []GormEvent
-	result := e.DB.Order("sequence_no asc").Where("entity_id = ? AND entity_type = ?", ID, entityType).Find(&events)
+	result := e.scoped().Order("sequence_no asc").Where("entity_id = ? AND entity_type = ?", ID, entityType).Find(&events)
 	if result.Error != nil {
 		return nil, result.Error
 	}
 
-	var tevents []*Event
-
-	for _, event := range events {
-		tevents = append(tevents, &Event{
-			ID:      event.ID,
-			Type:    event.Type,
-			Payload: json.RawMessage(event.Payload),
-			Meta: EventMeta{
-				EntityID:   event.EntityID,
-				EntityType: event.EntityType,
-				RootID:     event.RootID,
-				Module:     event.ApplicationID,
-				User:       event.User,
-				SequenceNo: event.SequenceNo,
-			},
-			Version: 0,
-		})
-	}
-	return tevents, nil
+	return e.decryptEvents(e.ctxt(), NewEventsFromGorm(events))
 }
 
 func (e *EventRepositoryGorm) GetByEntityAndAggregate(EntityID string, Type string, RootID string) ([]*Event, error) {
 	var events []GormEvent
-	result := e.DB.Order("sequence_no asc").Where("entity_id = ? AND entity_type = ? AND root_id = ?", EntityID, Type, RootID).Find(&events)
+	result := e.scoped().Order("sequence_no asc").Where("entity_id = ? AND entity_type = ? AND root_id = ?", EntityID, Type, RootID).Find(&events)
 	if result.Error != nil {
 		return nil, result.Error
 	}
 
-	var tevents []*Event
-
-	for _, event := range events {
-		tevents = append(tevents, &Event{
-			ID:      event.ID,
-			Type:    event.Type,
-			Payload: json.RawMessage(event.Payload),
-			Meta: EventMeta{
-				EntityID:   event.EntityID,
-				EntityType: event.EntityType,
-				RootID:     event.RootID,
-				Module:     event.ApplicationID,
-				User:       event.User,
-				SequenceNo: event.SequenceNo,
-			},
-			Version: 0,
-		})
-	}
-	return tevents, nil
+	return e.decryptEvents(e.ctxt(), NewEventsFromGorm(events))
 }
 
 //GetAggregateSequenceNumber gets the latest sequence number for the aggregate entity
 func (e *EventRepositoryGorm) GetAggregateSequenceNumber(ID string) (int64, error) {
 	var event GormEvent
-	result := e.DB.Order("sequence_no desc").Where("root_id = ?", ID).Find(&event)
+	result := e.scoped().Order("sequence_no desc").Where("root_id = ?", ID).Find(&event)
 	if result.Error != nil {
 		return 0, result.Error
 	}
@@ -212,29 +264,266 @@ func (e *EventRepositoryGorm) GetAggregateSequenceNumber(ID string) (int64, erro
 
 func (e *EventRepositoryGorm) GetByAggregateAndSequenceRange(ID string, start int64, end int64) ([]*Event, error) {
 	var events []GormEvent
-	result := e.DB.Order("sequence_no asc").Where("entity_id = ? AND sequence_no >=? AND sequence_no <= ?", ID, start, end).Find(&events)
+	result := e.scoped().Order("sequence_no asc").Where("entity_id = ? AND sequence_no >=? AND sequence_no <= ?", ID, start, end).Find(&events)
 	if result.Error != nil {
 		return nil, result.Error
 	}
-	var tevents []*Event
+	return e.decryptEvents(e.ctxt(), NewEventsFromGorm(events))
+}
+
+//EventFilter narrows down the events returned by GetEvents. Empty fields are ignored
+type EventFilter struct {
+	ID            string
+	ApplicationID string
+	RootID        string
+	EntityID      string
+	EntityType    string
+	Type          string
+	//From and To limit the events to the ones created in the time range (From is inclusive and To is exclusive)
+	From time.Time
+	To   time.Time
+	//Limit is the maximum number of events to return. There is no limit if it's 0
+	Limit int
+}
+
+//GetEvents returns the events that match the filter in the order they were stored
+func (e *EventRepositoryGorm) GetEvents(filter EventFilter) ([]*Event, error) {
+	var events []GormEvent
+	result := e.filtered(filter).Find(&events)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return e.decryptEvents(e.ctxt(), NewEventsFromGorm(events))
+}
+
+//DefaultEventPageSize is the number of events ForEachEvent reads at a time
+const DefaultEventPageSize = 500
+
+//ForEachEvent calls handle with the events that match the filter in the order they were stored. The events are read a
+//page at a time so that the whole store doesn't have to be in memory. The filter Limit is the maximum number of events
+//handled (there is no limit if it's 0). It returns the number of events handled
+func ForEachEvent(repository EventRepository, filter EventFilter, pageSize int, handle func(event *Event) error) (int, error) {
+	return eachEvent(filter, pageSize, repository.GetEvents, handle)
+}
 
+//eachEvent pages through the events returned by get. The next page starts at the creation time of the last event and
+//the events at that time that were already handled are skipped
+func eachEvent(filter EventFilter, pageSize int, get func(filter EventFilter) ([]*Event, error), handle func(event *Event) error) (int, error) {
+	if pageSize <= 0 {
+		pageSize = DefaultEventPageSize
+	}
+	limit := filter.Limit
+	handled := 0
+	//seen are the events handled that were created at the start of the next page
+	seen := make(map[string]bool)
+	for {
+		page := filter
+		page.Limit = pageSize + len(seen)
+		events, err := get(page)
+		if err != nil {
+			return handled, err
+		}
+		for _, event := range events {
+			if seen[event.ID] {
+				continue
+			}
+			if limit > 0 && handled >= limit {
+				return handled, nil
+			}
+			if err = handle(event); err != nil {
+				return handled, err
+			}
+			handled += 1
+			created, err := time.Parse(time.RFC3339Nano, event.Meta.Created)
+			if err != nil {
+				return handled, NewError(fmt.Sprintf("event '%s' has an invalid creation time '%s'", event.ID, event.Meta.Created), err)
+			}
+			if !created.Equal(filter.From) {
+				filter.From = created
+				seen = make(map[string]bool)
+			}
+			seen[event.ID] = true
+		}
+		if len(events) < page.Limit {
+			return handled, nil
+		}
+	}
+}
+
+//filtered returns a query for the events that match the filter in the order they were stored. Events stored at the same
+//time are ordered by id so that the order is the same for every query
+func (e *EventRepositoryGorm) filtered(filter EventFilter) *gorm.DB {
+	query := e.conditions(filter).Order("created_at asc").Order("sequence_no asc").Order("id asc")
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+	return query
+}
+
+//conditions returns a query limited to the events that match the filter (the limit is not applied)
+func (e *EventRepositoryGorm) conditions(filter EventFilter) *gorm.DB {
+	query := e.scoped()
+	if filter.ID != "" {
+		query = query.Where("id = ?", filter.ID)
+	}
+	if filter.ApplicationID != "" {
+		query = query.Where("application_id = ?", filter.ApplicationID)
+	}
+	if filter.RootID != "" {
+		query = query.Where("root_id = ?", filter.RootID)
+	}
+	if filter.EntityID != "" {
+		query = query.Where("entity_id = ?", filter.EntityID)
+	}
+	if filter.EntityType != "" {
+		query = query.Where("entity_type = ?", filter.EntityType)
+	}
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("created_at < ?", filter.To)
+	}
+	return query
+}
+
+//GetByCorrelationID returns all the events that were created as a result of the command that started the correlation
+func (e *EventRepositoryGorm) GetByCorrelationID(correlationID string) ([]*Event, error) {
+	var events []GormEvent
+	result := e.scoped().Order("created_at asc").Order("sequence_no asc").Where("correlation_id = ?", correlationID).Find(&events)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return e.decryptEvents(e.ctxt(), NewEventsFromGorm(events))
+}
+
+//WithContext returns a copy of the repository that is scoped to the account in the context. If the repository is
+//already scoped to an account then the context can't be used to read or write another account's events. An error is
+//returned if there is no account to scope the repository to
+func (e *EventRepositoryGorm) WithContext(ctxt context.Context) (EventRepository, error) {
+	accountID, err := e.account(ctxt)
+	if err != nil {
+		return nil, err
+	}
+	if accountID == "" {
+		return nil, NewUnauthorizedError(ctxt, "account_required", "an account is required to scope the events", nil)
+	}
+	//the copy shares the connection and subscribers of the original repository
+	repository := *e
+	repository.AccountID = accountID
+	repository.DB = e.DB.WithContext(ctxt)
+	return &repository, nil
+}
+
+//ctxt returns the context of the repository connection (the one the repository was scoped with)
+func (e *EventRepositoryGorm) ctxt() context.Context {
+	if e.DB != nil && e.DB.Statement != nil && e.DB.Statement.Context != nil {
+		return e.DB.Statement.Context
+	}
+	return context.Background()
+}
+
+//account determines the account events should be scoped to. A repository that is not scoped to an account (e.g. one
+//shared by tenants) uses the authenticated account in the context
+func (e *EventRepositoryGorm) account(ctxt context.Context) (string, error) {
+	ctxtAccount := GetAccount(ctxt)
+	if e.AccountID == "" {
+		return ctxtAccount, nil
+	}
+	if ctxtAccount != "" && ctxtAccount != e.AccountID {
+		return "", NewUnauthorizedError(ctxt, "account_mismatch", fmt.Sprintf("account '%s' can't access events for account '%s'", ctxtAccount, e.AccountID), nil)
+	}
+	return e.AccountID, nil
+}
+
+//scoped returns a query that is limited to the events of the repository account
+func (e *EventRepositoryGorm) scoped() *gorm.DB {
+	if e.AccountID == "" {
+		return e.DB
+	}
+	return e.DB.Where("account_id = ?", e.AccountID)
+}
+
+//SetEncryption encrypts the payload fields in the rules with the keys of the subjects the data belongs to. The fields
+//are decrypted when events are read and are null once the subject is forgotten
+func (e *EventRepositoryGorm) SetEncryption(keyStore KeyStore, rules ...EncryptionRule) {
+	e.keyStore = keyStore
+	e.encryptionRules = rules
+}
+
+//ForgetSubject destroys the key of the subject so that the personal data in their events can no longer be read
+//(including in replays and exports)
+func (e *EventRepositoryGorm) ForgetSubject(ctx context.Context, subjectID string) error {
+	if e.keyStore == nil {
+		return NewError("encryption is not configured on the event repository", nil)
+	}
+	return e.keyStore.DeleteKey(ctx, subjectID)
+}
+
+//decryptEvents decrypts the payload fields that were encrypted when the events were persisted
+func (e *EventRepositoryGorm) decryptEvents(ctxt context.Context, events []*Event) ([]*Event, error) {
+	if e.keyStore == nil {
+		return events, nil
+	}
+	keys := make(map[string][]byte)
 	for _, event := range events {
-		tevents = append(tevents, &Event{
-			ID:      event.ID,
-			Type:    event.Type,
-			Payload: json.RawMessage(event.Payload),
-			Meta: EventMeta{
-				EntityID:   event.EntityID,
-				EntityType: event.EntityType,
-				RootID:     event.RootID,
-				Module:     event.ApplicationID,
-				User:       event.User,
-				SequenceNo: event.SequenceNo,
-			},
-			Version: 0,
-		})
+		payload, err := decryptPayload(ctxt, e.keyStore, e.encryptionRules, event, keys)
+		if err != nil {
+			return nil, err
+		}
+		event.Payload = payload
 	}
-	return tevents, nil
+	return events, nil
+}
+
+//SetMetrics sets the registry used to instrument persisting and dispatching events
+func (e *EventRepositoryGorm) SetMetrics(metrics *Metrics) {
+	e.metrics = metrics
+	e.eventDispatcher.Metrics = metrics
+}
+
+//SetTracer sets the tracer used to create spans when persisting and dispatching events
+func (e *EventRepositoryGorm) SetTracer(tracer *Tracer) {
+	e.tracer = tracer
+	e.eventDispatcher.Tracer = tracer
+}
+
+//SetClock sets the clock used for the time events are stored at and by the event dispatcher health check
+func (e *EventRepositoryGorm) SetClock(clock Clock) {
+	e.clock = clock
+	e.eventDispatcher.Clock = clock
+}
+
+//SetIDGenerator sets the id generator used for save points
+func (e *EventRepositoryGorm) SetIDGenerator(generator IDGenerator) {
+	e.idGenerator = generator
+}
+
+func (e *EventRepositoryGorm) now() time.Time {
+	if e.clock == nil {
+		return DefaultClock.Now()
+	}
+	return e.clock.Now()
+}
+
+func (e *EventRepositoryGorm) newID() string {
+	if e.idGenerator == nil {
+		return DefaultIDGenerator.NewID()
+	}
+	return e.idGenerator.NewID()
+}
+
+//savePointName makes an id usable as a save point name (a letter followed by letters, digits and underscores)
+func savePointName(id string) string {
+	return "s" + strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, id)
 }
 
 //AddSubscriber Allows you to add a handler that is triggered when events are dispatched
@@ -247,19 +536,44 @@ func (e *EventRepositoryGorm) GetSubscribers() ([]EventHandler, error) {
 	return e.eventDispatcher.GetSubscribers(), nil
 }
 
+//Migrate applies the event store migrations that have not been run yet
 func (e *EventRepositoryGorm) Migrate(ctx context.Context) error {
-	event, err := NewGormEvent(&Event{})
+	migrator := NewMigrator(e.DB, e.logger)
+	err := migrator.RegisterProvider(e)
 	if err != nil {
 		return err
 	}
-	err = e.DB.AutoMigrate(&event)
-	if err != nil {
+	if err = migrator.Up(ctx); err != nil {
 		return err
 	}
-
+	//the keys are migrated in their own database (e.g. the GormKeyStore) so they are kept out of event store backups
+	if keyStore, ok := e.keyStore.(interface {
+		Migrate(ctx context.Context) error
+	}); ok {
+		return keyStore.Migrate(ctx)
+	}
 	return nil
 }
 
+//HealthCheck confirms that the database is reachable, that the events table exists and that none of the event handlers
+//have panicked
+func (e *EventRepositoryGorm) HealthCheck(ctx context.Context) error {
+	if e.DB == nil || e.DB.Config == nil {
+		return errors.New("event repository database not configured")
+	}
+	sqlDB, err := e.DB.DB()
+	if err != nil {
+		return err
+	}
+	if err = sqlDB.PingContext(ctx); err != nil {
+		return err
+	}
+	if !e.DB.Migrator().HasTable(&GormEvent{}) {
+		return errors.New("events table does not exist")
+	}
+	return e.eventDispatcher.HealthCheck(ctx)
+}
+
 func (e *EventRepositoryGorm) Flush() error {
 	err := e.DB.Commit().Error
 	e.DB = e.gormDB.Begin()
@@ -268,7 +582,7 @@ func (e *EventRepositoryGorm) Flush() error {
 
 func (e *EventRepositoryGorm) Remove(entities []Entity) error {
 
-	savePointID := "s" + ksuid.New().String() //NOTE the save point can't start with a number
+	savePointID := savePointName(e.newID()) //NOTE the save point can't start with a number
 	e.logger.Infof("persisting %d events with save point %s", len(entities), savePointID)
 	e.DB.SavePoint(savePointID)
 	for _, event := range entities {
@@ -276,7 +590,7 @@ func (e *EventRepositoryGorm) Remove(entities []Entity) error {
 		if err != nil {
 			return err
 		}
-		db := e.DB.Delete(gormEvent)
+		db := e.scoped().Delete(gormEvent)
 		if db.Error != nil {
 			e.DB.RollbackTo(savePointID)
 			return db.Error
@@ -289,7 +603,7 @@ func (e *EventRepositoryGorm) Remove(entities []Entity) error {
 func NewBasicEventRepository(gormDB *gorm.DB, logger Log, useUnitOfWork bool, accountID string, applicationID string) (EventRepository, error) {
 	if useUnitOfWork {
 		transaction := gormDB.Begin()
-		return &EventRepositoryGorm{DB: transaction, gormDB: gormDB, logger: logger, unitOfWork: useUnitOfWork, AccountID: accountID, ApplicationID: applicationID}, nil
+		return &EventRepositoryGorm{DB: transaction, gormDB: gormDB, eventDispatcher: &EventDisptacher{}, logger: logger, unitOfWork: useUnitOfWork, AccountID: accountID, ApplicationID: applicationID}, nil
 	}
-	return &EventRepositoryGorm{DB: gormDB, logger: logger, AccountID: accountID, ApplicationID: applicationID}, nil
+	return &EventRepositoryGorm{DB: gormDB, eventDispatcher: &EventDisptacher{}, logger: logger, AccountID: accountID, ApplicationID: applicationID}, nil
 }
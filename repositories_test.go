@@ -0,0 +1,61 @@
+package weos_test
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/wepala/weos"
+	"golang.org/x/net/context"
+	"testing"
+	"time"
+)
+
+func TestForEachEvent(t *testing.T) {
+	db := newMigrationTestDB(t)
+	repository, err := weos.NewBasicEventRepository(db, log.New(), false, "", "")
+	if err != nil {
+		t.Fatalf("unexpected error creating repository '%s'", err)
+	}
+	if err = repository.Migrate(context.TODO()); err != nil {
+		t.Fatalf("unexpected error migrating repository '%s'", err)
+	}
+	//the events of each post are stored at the same time so pages start in the middle of events with the same time
+	clock := weos.NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	repository.(*weos.EventRepositoryGorm).SetClock(clock)
+	persistPosts(t, repository, "post1", "POST_CREATED", "POST_UPDATED", "POST_UPDATED")
+	clock.Advance(time.Second)
+	persistPosts(t, repository, "post2", "POST_CREATED", "POST_UPDATED")
+	expected, err := repository.GetEvents(weos.EventFilter{})
+	if err != nil {
+		t.Fatalf("unexpected error getting events '%s'", err)
+	}
+
+	for _, pageSize := range []int{1, 2, 10} {
+		var handled []string
+		count, err := weos.ForEachEvent(repository, weos.EventFilter{}, pageSize, func(event *weos.Event) error {
+			handled = append(handled, event.ID)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error paging events '%s'", err)
+		}
+		if count != len(expected) || len(handled) != len(expected) {
+			t.Fatalf("expected %d events with a page size of %d, got %d", len(expected), pageSize, len(handled))
+		}
+		for i, event := range expected {
+			if handled[i] != event.ID {
+				t.Errorf("expected event %d to be '%s' with a page size of %d, got '%s'", i, event.ID, pageSize, handled[i])
+			}
+		}
+	}
+
+	t.Run("the limit is the number of events handled", func(t *testing.T) {
+		count, err := weos.ForEachEvent(repository, weos.EventFilter{Limit: 4}, 3, func(event *weos.Event) error {
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error paging events '%s'", err)
+		}
+		if count != 4 {
+			t.Errorf("expected %d events, got %d", 4, count)
+		}
+	})
+}
@@ -0,0 +1,152 @@
+package weos
+
+import (
+	"fmt"
+	"github.com/segmentio/ksuid"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+	"net/http"
+)
+
+//RequestIDHeader is the header the request id is read from and sent in
+const RequestIDHeader = "X-Request-ID"
+
+//maxRequestIDLength limits the request ids accepted from clients so that they can't flood logs and events
+const maxRequestIDLength = 128
+
+//RequestIDMiddleware uses the request id sent by the client (e.g. a load balancer) or generates one, adds it to the
+//context and sends it back in the response headers
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = ksuid.New().String()
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), REQUEST_ID, requestID)))
+	})
+}
+
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range requestID {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+//RequestIDTransport adds the request id in the context of outbound requests to their headers so that calls to other
+//services can be traced back to the request that made them
+type RequestIDTransport struct {
+	//Base makes the requests. If it's nil http.DefaultTransport is used
+	Base http.RoundTripper
+}
+
+func (t *RequestIDTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if requestID := GetRequestID(r.Context()); requestID != "" && r.Header.Get(RequestIDHeader) == "" {
+		//round trippers must not modify the request
+		r = r.Clone(r.Context())
+		r.Header.Set(RequestIDHeader, requestID)
+	}
+	return base.RoundTrip(r)
+}
+
+//withRequestID returns a copy of the client that sends the request id with its requests
+func withRequestID(client *http.Client) *http.Client {
+	if _, ok := client.Transport.(*RequestIDTransport); ok {
+		return client
+	}
+	wrapped := *client
+	wrapped.Transport = &RequestIDTransport{Base: client.Transport}
+	return &wrapped
+}
+
+//LoggerWithContext returns a logger that includes the request, correlation and user ids in the context with each
+//message. Logrus loggers get the ids as fields, other loggers get them as a prefix
+func LoggerWithContext(ctx context.Context, logger Log) Log {
+	fields := log.Fields{}
+	if requestID := GetRequestID(ctx); requestID != "" {
+		fields["request_id"] = requestID
+	}
+	if correlationID := GetCorrelationID(ctx); correlationID != "" {
+		fields["correlation_id"] = correlationID
+	}
+	if userID := ContextUser(ctx); userID != "" {
+		fields["user_id"] = userID
+	}
+	if len(fields) == 0 {
+		return logger
+	}
+	if fieldLogger, ok := logger.(log.FieldLogger); ok {
+		return fieldLogger.WithFields(fields)
+	}
+	prefix := ""
+	for _, key := range []string{"request_id", "correlation_id", "user_id"} {
+		if value, ok := fields[key]; ok {
+			prefix += fmt.Sprintf("%s=%s ", key, value)
+		}
+	}
+	return &prefixLogger{Log: logger, prefix: prefix}
+}
+
+//prefixLogger adds a prefix to the messages of a logger
+type prefixLogger struct {
+	Log
+	prefix string
+}
+
+func (p *prefixLogger) Debugf(format string, args ...interface{}) {
+	p.Log.Debugf(p.prefix+format, args...)
+}
+
+func (p *prefixLogger) Infof(format string, args ...interface{}) {
+	p.Log.Infof(p.prefix+format, args...)
+}
+
+func (p *prefixLogger) Printf(format string, args ...interface{}) {
+	p.Log.Printf(p.prefix+format, args...)
+}
+
+func (p *prefixLogger) Errorf(format string, args ...interface{}) {
+	p.Log.Errorf(p.prefix+format, args...)
+}
+
+func (p *prefixLogger) Fatalf(format string, args ...interface{}) {
+	p.Log.Fatalf(p.prefix+format, args...)
+}
+
+func (p *prefixLogger) Panicf(format string, args ...interface{}) {
+	p.Log.Panicf(p.prefix+format, args...)
+}
+
+func (p *prefixLogger) Debug(args ...interface{}) {
+	p.Log.Debug(append([]interface{}{p.prefix}, args...)...)
+}
+
+func (p *prefixLogger) Info(args ...interface{}) {
+	p.Log.Info(append([]interface{}{p.prefix}, args...)...)
+}
+
+func (p *prefixLogger) Print(args ...interface{}) {
+	p.Log.Print(append([]interface{}{p.prefix}, args...)...)
+}
+
+func (p *prefixLogger) Error(args ...interface{}) {
+	p.Log.Error(append([]interface{}{p.prefix}, args...)...)
+}
+
+func (p *prefixLogger) Fatal(args ...interface{}) {
+	p.Log.Fatal(append([]interface{}{p.prefix}, args...)...)
+}
+
+func (p *prefixLogger) Panic(args ...interface{}) {
+	p.Log.Panic(append([]interface{}{p.prefix}, args...)...)
+}
@@ -0,0 +1,115 @@
+package weos_test
+
+import (
+	"bytes"
+	"database/sql"
+	"github.com/sirupsen/logrus"
+	"github.com/wepala/weos"
+	"golang.org/x/net/context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	var requestID string
+	handler := weos.RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID = weos.GetRequestID(r.Context())
+	}))
+
+	t.Run("an id is generated", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/", nil))
+		if requestID == "" {
+			t.Fatal("expected a request id to be added to the context")
+		}
+		if rw.Header().Get(weos.RequestIDHeader) != requestID {
+			t.Errorf("expected the request id to be in the response headers, got '%s'", rw.Header().Get(weos.RequestIDHeader))
+		}
+	})
+
+	t.Run("the id sent by the client is used", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set(weos.RequestIDHeader, "lb-123")
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+		if requestID != "lb-123" {
+			t.Errorf("expected the request id to be '%s', got '%s'", "lb-123", requestID)
+		}
+	})
+
+	t.Run("invalid ids are replaced", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set(weos.RequestIDHeader, strings.Repeat("a", 200))
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+		if len(requestID) == 200 {
+			t.Error("expected a request id that is too long to be replaced")
+		}
+	})
+}
+
+func TestRequestIDTransport(t *testing.T) {
+	var received string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get(weos.RequestIDHeader)
+	}))
+	defer server.Close()
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("error opening database '%s'", err)
+	}
+	app, err := weos.NewApplicationFromConfig(&weos.ApplicationConfig{
+		Database: &weos.DBConfig{Driver: "sqlite3", Database: ":memory:"},
+	}, nil, db, nil, &EventRepositoryMock{})
+	if err != nil {
+		t.Fatalf("unexpected error setting up app '%s'", err)
+	}
+	ctx := context.WithValue(context.TODO(), weos.REQUEST_ID, "request-1")
+	request, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	response, err := app.HTTPClient().Do(request)
+	if err != nil {
+		t.Fatalf("unexpected error making request '%s'", err)
+	}
+	response.Body.Close()
+	if received != "request-1" {
+		t.Errorf("expected the request id to be sent, got '%s'", received)
+	}
+	if request.Header.Get(weos.RequestIDHeader) != "" {
+		t.Error("expected the original request not to be modified")
+	}
+}
+
+func TestLoggerWithContext(t *testing.T) {
+	ctx := context.WithValue(context.TODO(), weos.REQUEST_ID, "request-1")
+	ctx = context.WithValue(ctx, weos.USER_ID, "user-1")
+
+	t.Run("logrus loggers get fields", func(t *testing.T) {
+		var output bytes.Buffer
+		logger := logrus.New()
+		logger.SetOutput(&output)
+		weos.LoggerWithContext(ctx, logger).Errorf("something went wrong")
+		if !strings.Contains(output.String(), "request_id=request-1") || !strings.Contains(output.String(), "user_id=user-1") {
+			t.Errorf("expected the ids to be logged, got '%s'", output.String())
+		}
+	})
+
+	t.Run("other loggers get a prefix", func(t *testing.T) {
+		var message string
+		logger := &LogMock{ErrorfFunc: func(format string, args ...interface{}) {
+			message = format
+		}}
+		weos.LoggerWithContext(ctx, logger).Errorf("something went wrong")
+		if message != "request_id=request-1 user_id=user-1 something went wrong" {
+			t.Errorf("expected the ids to be prefixed, got '%s'", message)
+		}
+	})
+}
+
+func TestNewEntityEventWithContext_RequestID(t *testing.T) {
+	ctx := context.WithValue(context.TODO(), weos.REQUEST_ID, "request-1")
+	event := weos.NewEntityEventWithContext(ctx, "CREATE_POST", &weos.BasicEntity{ID: "post-1"}, "post-1", nil)
+	if event.Meta.RequestID != "request-1" {
+		t.Errorf("expected the request id to be '%s', got '%s'", "request-1", event.Meta.RequestID)
+	}
+}
@@ -0,0 +1,526 @@
+package weos
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/segmentio/ksuid"
+	"golang.org/x/net/context"
+	"gorm.io/gorm"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+//DefaultSessionCookie is the name of the session cookie if the config has no SessionKey
+const DefaultSessionCookie = "weos_session"
+
+//DefaultSessionLifetime is how long a session lasts before the user has to log in again
+const DefaultSessionLifetime = 24 * time.Hour
+
+//Session is the state of a logged in user that is kept between requests
+type Session struct {
+	ID          string            `json:"id"`
+	UserID      string            `json:"userId"`
+	AccountID   string            `json:"accountId"`
+	Roles       []string          `json:"roles,omitempty"`
+	Permissions []string          `json:"permissions,omitempty"`
+	Values      map[string]string `json:"values,omitempty"`
+	CreatedAt   time.Time         `json:"createdAt"`
+	ExpiresAt   time.Time         `json:"expiresAt"`
+}
+
+//User is the user the session belongs to
+func (s *Session) User() *User {
+	return &User{
+		BasicEntity: BasicEntity{ID: s.UserID},
+		Roles:       s.Roles,
+		Permissions: s.Permissions,
+	}
+}
+
+//Expired checks if the session has expired by the time of the DefaultClock
+func (s *Session) Expired() bool {
+	return s.ExpiredAt(DefaultClock.Now())
+}
+
+//ExpiredAt checks if the session has expired by the time given (e.g. from the clock of the session manager)
+func (s *Session) ExpiredAt(now time.Time) bool {
+	return !s.ExpiresAt.IsZero() && now.After(s.ExpiresAt)
+}
+
+//SessionStore converts sessions to and from the value stored in the session cookie
+type SessionStore interface {
+	//Encode saves the session and returns the cookie value
+	Encode(ctx context.Context, session *Session) (string, error)
+	//Decode returns the session of the cookie value or nil if the value is not a valid session
+	Decode(ctx context.Context, value string) (*Session, error)
+	//Delete removes the session so that the cookie value can't be used again
+	Delete(ctx context.Context, session *Session) error
+}
+
+//CookieSessionStore stores the whole session in the cookie. The session is encrypted with AES-GCM so that it can't be
+//read or changed by the client. The cookie can't be changed on the client so sessions that are deleted (e.g. when the
+//session is rotated or the user logs out) are recorded in the SessionRevocations and copies of their cookies are
+//rejected. Without revocations a copy of the cookie is valid until the session expires
+type CookieSessionStore struct {
+	key         []byte
+	revocations SessionRevocations
+}
+
+//NewCookieSessionStore creates a store that encrypts sessions with a key derived from the secret
+func NewCookieSessionStore(secret string) *CookieSessionStore {
+	return &CookieSessionStore{key: DeriveKey(secret, "session-cookie")}
+}
+
+//SetRevocations sets where deleted sessions are recorded so that their cookies can't be used again
+func (c *CookieSessionStore) SetRevocations(revocations SessionRevocations) {
+	c.revocations = revocations
+}
+
+func (c *CookieSessionStore) Encode(ctx context.Context, session *Session) (string, error) {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := seal(c.key, data, []byte("session"))
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+func (c *CookieSessionStore) Decode(ctx context.Context, value string) (*Session, error) {
+	sealed, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, nil
+	}
+	data, err := open(c.key, sealed, []byte("session"))
+	if err != nil {
+		//the cookie was changed or encrypted with another secret
+		return nil, nil
+	}
+	session := &Session{}
+	if err = json.Unmarshal(data, session); err != nil {
+		return nil, nil
+	}
+	if c.revocations != nil {
+		revoked, err := c.revocations.IsRevoked(ctx, session.ID)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, nil
+		}
+	}
+	return session, nil
+}
+
+//Delete revokes the session so that the cookie can't be used again. If the store has no revocations the cookie value
+//stays valid until it expires
+func (c *CookieSessionStore) Delete(ctx context.Context, session *Session) error {
+	if c.revocations == nil {
+		return nil
+	}
+	return c.revocations.Revoke(ctx, session)
+}
+
+//SessionRevocations records the sessions that were deleted from stores that keep the session on the client
+type SessionRevocations interface {
+	Revoke(ctx context.Context, session *Session) error
+	IsRevoked(ctx context.Context, sessionID string) (bool, error)
+}
+
+//RevokedSession is a session that was revoked. It's kept until the session would have expired
+type RevokedSession struct {
+	ID        string    `gorm:"primaryKey"`
+	ExpiresAt time.Time `gorm:"index"`
+	CreatedAt time.Time
+}
+
+func (RevokedSession) TableName() string {
+	return "revoked_sessions"
+}
+
+//GormSessionRevocations stores revoked sessions in a database table so that all the instances of the application
+//reject them
+type GormSessionRevocations struct {
+	db     *gorm.DB
+	logger Log
+	clock  Clock
+}
+
+func NewGormSessionRevocations(db *gorm.DB, logger Log) *GormSessionRevocations {
+	return &GormSessionRevocations{db: db, logger: logger}
+}
+
+func (g *GormSessionRevocations) Revoke(ctx context.Context, session *Session) error {
+	return g.db.WithContext(ctx).Save(&RevokedSession{ID: session.ID, ExpiresAt: session.ExpiresAt}).Error
+}
+
+func (g *GormSessionRevocations) IsRevoked(ctx context.Context, sessionID string) (bool, error) {
+	var revoked int64
+	if err := g.db.WithContext(ctx).Model(&RevokedSession{}).Where("id = ?", sessionID).Count(&revoked).Error; err != nil {
+		return false, err
+	}
+	return revoked > 0, nil
+}
+
+//DeleteExpired removes the revocations of sessions that have expired (their cookies are rejected anyway) and returns the
+//number removed
+func (g *GormSessionRevocations) DeleteExpired(ctx context.Context) (int64, error) {
+	now := DefaultClock.Now()
+	if g.clock != nil {
+		now = g.clock.Now()
+	}
+	result := g.db.WithContext(ctx).Where("expires_at < ?", now).Delete(&RevokedSession{})
+	return result.RowsAffected, result.Error
+}
+
+//SetClock sets the clock used to tell which revocations have expired
+func (g *GormSessionRevocations) SetClock(clock Clock) {
+	g.clock = clock
+}
+
+func (g *GormSessionRevocations) Migrate(ctx context.Context) error {
+	migrator := NewMigrator(g.db, g.logger)
+	if err := migrator.RegisterProvider(g); err != nil {
+		return err
+	}
+	return migrator.Up(ctx)
+}
+
+//revokedSessionV1 is a snapshot of the revoked sessions table used by the migrations
+type revokedSessionV1 struct {
+	ID        string    `gorm:"primaryKey"`
+	ExpiresAt time.Time `gorm:"index"`
+	CreatedAt time.Time
+}
+
+func (revokedSessionV1) TableName() string {
+	return "revoked_sessions"
+}
+
+//MigrationNamespace is the namespace the revocation migrations are tracked under
+func (g *GormSessionRevocations) MigrationNamespace() string {
+	return "revoked_sessions"
+}
+
+//Migrations are the versioned changes to the revoked sessions table
+func (g *GormSessionRevocations) Migrations() []*Migration {
+	return []*Migration{
+		{
+			Version: 1,
+			Name:    "create revoked sessions table",
+			Up: func(tx *gorm.DB) error {
+				return tx.Migrator().CreateTable(&revokedSessionV1{})
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable(&revokedSessionV1{})
+			},
+		},
+	}
+}
+
+//SessionRecord is a session stored by the GormSessionStore
+type SessionRecord struct {
+	ID        string `gorm:"primaryKey"`
+	Data      string
+	ExpiresAt time.Time `gorm:"index"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (SessionRecord) TableName() string {
+	return "sessions"
+}
+
+//GormSessionStore stores sessions in a database table and the cookie only has the signed session id. Sessions can be
+//revoked by deleting them
+type GormSessionStore struct {
+	db     *gorm.DB
+	key    []byte
+	logger Log
+	clock  Clock
+}
+
+//NewGormSessionStore creates a store that signs session ids with a key derived from the secret
+func NewGormSessionStore(db *gorm.DB, secret string, logger Log) *GormSessionStore {
+	return &GormSessionStore{db: db, key: DeriveKey(secret, "session"), logger: logger}
+}
+
+func (g *GormSessionStore) Encode(ctx context.Context, session *Session) (string, error) {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return "", err
+	}
+	record := &SessionRecord{ID: session.ID, Data: string(data), ExpiresAt: session.ExpiresAt, CreatedAt: session.CreatedAt}
+	if err = g.db.WithContext(ctx).Save(record).Error; err != nil {
+		return "", err
+	}
+	return session.ID + "." + g.sign(session.ID), nil
+}
+
+func (g *GormSessionStore) Decode(ctx context.Context, value string) (*Session, error) {
+	parts := strings.SplitN(value, ".", 2)
+	if len(parts) != 2 || !hmac.Equal([]byte(parts[1]), []byte(g.sign(parts[0]))) {
+		return nil, nil
+	}
+	var records []SessionRecord
+	if err := g.db.WithContext(ctx).Where("id = ?", parts[0]).Limit(1).Find(&records).Error; err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	session := &Session{}
+	if err := json.Unmarshal([]byte(records[0].Data), session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (g *GormSessionStore) Delete(ctx context.Context, session *Session) error {
+	return g.db.WithContext(ctx).Where("id = ?", session.ID).Delete(&SessionRecord{}).Error
+}
+
+//DeleteExpired removes the sessions that have expired and returns the number removed
+func (g *GormSessionStore) DeleteExpired(ctx context.Context) (int64, error) {
+	now := DefaultClock.Now()
+	if g.clock != nil {
+		now = g.clock.Now()
+	}
+	result := g.db.WithContext(ctx).Where("expires_at < ?", now).Delete(&SessionRecord{})
+	return result.RowsAffected, result.Error
+}
+
+//SetClock sets the clock used to tell which sessions have expired
+func (g *GormSessionStore) SetClock(clock Clock) {
+	g.clock = clock
+}
+
+func (g *GormSessionStore) sign(id string) string {
+	mac := hmac.New(sha256.New, g.key)
+	mac.Write([]byte(id))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (g *GormSessionStore) Migrate(ctx context.Context) error {
+	migrator := NewMigrator(g.db, g.logger)
+	if err := migrator.RegisterProvider(g); err != nil {
+		return err
+	}
+	return migrator.Up(ctx)
+}
+
+//sessionV1 is a snapshot of the sessions table used by the migrations
+type sessionV1 struct {
+	ID        string `gorm:"primaryKey"`
+	Data      string
+	ExpiresAt time.Time `gorm:"index"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (sessionV1) TableName() string {
+	return "sessions"
+}
+
+//MigrationNamespace is the namespace the session store migrations are tracked under
+func (g *GormSessionStore) MigrationNamespace() string {
+	return "sessions"
+}
+
+//Migrations are the versioned changes to the sessions table
+func (g *GormSessionStore) Migrations() []*Migration {
+	return []*Migration{
+		{
+			Version: 1,
+			Name:    "create sessions table",
+			Up: func(tx *gorm.DB) error {
+				return tx.Migrator().CreateTable(&sessionV1{})
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable(&sessionV1{})
+			},
+		},
+	}
+}
+
+//SessionManager keeps the session cookie of requests. Use Middleware to load the session into the context and
+//RequireSession to send users without a session to the login page
+type SessionManager struct {
+	store      SessionStore
+	cookieName string
+	secure     bool
+	loginURL   string
+	//Lifetime is how long new sessions last
+	Lifetime time.Duration
+	//Clock is used for the time sessions are created and expire. The DefaultClock is used if it's nil
+	Clock Clock
+	//Logger is used to log errors loading sessions. The standard logger is used if it's nil
+	Logger Log
+}
+
+//NewSessionManager creates a session manager that uses the SessionKey as the cookie name and the LoginURL of the config
+func NewSessionManager(config *ApplicationConfig, store SessionStore) *SessionManager {
+	cookieName := config.SessionKey
+	if cookieName == "" {
+		cookieName = DefaultSessionCookie
+	}
+	return &SessionManager{
+		store:      store,
+		cookieName: cookieName,
+		secure:     strings.HasPrefix(config.BaseURL, "https://"),
+		loginURL:   config.LoginURL,
+		Lifetime:   DefaultSessionLifetime,
+	}
+}
+
+//Load returns the session of the request or nil if there isn't a valid session
+func (m *SessionManager) Load(r *http.Request) (*Session, error) {
+	cookie, err := r.Cookie(m.cookieName)
+	if err != nil {
+		return nil, nil
+	}
+	session, err := m.store.Decode(r.Context(), cookie.Value)
+	if err != nil || session == nil || session.UserID == "" {
+		return nil, err
+	}
+	if session.ExpiredAt(m.now()) {
+		return nil, m.store.Delete(r.Context(), session)
+	}
+	return session, nil
+}
+
+//Login starts a new session for the user. Any existing session is removed so that a session id set before logging in
+//can't be used afterwards
+func (m *SessionManager) Login(w http.ResponseWriter, r *http.Request, user *User, accountID string) (*Session, error) {
+	if user == nil || user.ID == "" {
+		return nil, NewError("a session can only be started for a user with an id", nil)
+	}
+	if existing, err := m.Load(r); err == nil && existing != nil {
+		if err = m.store.Delete(r.Context(), existing); err != nil {
+			return nil, err
+		}
+	}
+	now := m.now()
+	session := &Session{
+		ID:          ksuid.New().String(),
+		UserID:      user.ID,
+		AccountID:   accountID,
+		Roles:       user.Roles,
+		Permissions: user.Permissions,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(m.Lifetime),
+	}
+	return session, m.Save(w, r, session)
+}
+
+func (m *SessionManager) now() time.Time {
+	if m.Clock != nil {
+		return m.Clock.Now()
+	}
+	return DefaultClock.Now()
+}
+
+//Save writes the changes to the session
+func (m *SessionManager) Save(w http.ResponseWriter, r *http.Request, session *Session) error {
+	value, err := m.store.Encode(r.Context(), session)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     m.cookieName,
+		Value:    value,
+		Path:     "/",
+		Expires:  session.ExpiresAt,
+		HttpOnly: true,
+		Secure:   m.secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+//Rotate gives the session a new id and deletes the old one from the store so that the old cookie can't be used again.
+//Rotate sessions when the user's privileges change. A CookieSessionStore needs revocations to reject the old cookie
+func (m *SessionManager) Rotate(w http.ResponseWriter, r *http.Request, session *Session) error {
+	if err := m.store.Delete(r.Context(), session); err != nil {
+		return err
+	}
+	session.ID = ksuid.New().String()
+	return m.Save(w, r, session)
+}
+
+//Logout deletes the session from the store and clears the session cookie. A CookieSessionStore needs revocations to
+//reject copies of the cookie
+func (m *SessionManager) Logout(w http.ResponseWriter, r *http.Request) error {
+	session, err := m.Load(r)
+	if err != nil {
+		return err
+	}
+	if session != nil {
+		if err = m.store.Delete(r.Context(), session); err != nil {
+			return err
+		}
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     m.cookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   m.secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+//Middleware adds the session and its user and account to the context of requests that have a session
+func (m *SessionManager) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, err := m.Load(r)
+		if err != nil {
+			writeError(w, r, m.Logger, NewInternalError(r.Context(), "session_error", "error loading session", err))
+			return
+		}
+		if session != nil {
+			r = r.WithContext(SessionContext(r.Context(), session))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+//RequireSession redirects requests without a session to the login page. The page that was requested is sent to the
+//login page in the "redirect" parameter
+func (m *SessionManager) RequireSession(next http.Handler) http.Handler {
+	return m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if GetSession(r.Context()) != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if m.loginURL == "" {
+			writeError(w, r, m.Logger, NewUnauthorizedError(r.Context(), "session_required", "a session is required", nil))
+			return
+		}
+		loginURL := m.loginURL
+		separator := "?"
+		if strings.Contains(loginURL, "?") {
+			separator = "&"
+		}
+		loginURL += separator + "redirect=" + url.QueryEscape(r.URL.RequestURI())
+		http.Redirect(w, r, loginURL, http.StatusFound)
+	}))
+}
+
+//SessionContext adds the session and its user and account to the context. The account is always set (even if the
+//session has none) so that the account can't come from anywhere else (e.g. the command metadata)
+func SessionContext(ctx context.Context, session *Session) context.Context {
+	ctx = context.WithValue(ctx, SESSION, session)
+	ctx = context.WithValue(ctx, USER_ID, session.UserID)
+	ctx = context.WithValue(ctx, CURRENT_USER, session.User())
+	return context.WithValue(ctx, ACCOUNT_ID, session.AccountID)
+}
@@ -0,0 +1,252 @@
+package weos_test
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/wepala/weos"
+	"golang.org/x/net/context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+//sessionRequest makes a request with the cookies set by a previous response
+func sessionRequest(handler http.Handler, target string, previous *httptest.ResponseRecorder) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	if previous != nil {
+		for _, cookie := range previous.Result().Cookies() {
+			r.AddCookie(cookie)
+		}
+	}
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, r)
+	return rw
+}
+
+func testSessionManager(t *testing.T, manager *weos.SessionManager) {
+	var current *weos.Session
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		user := &weos.User{BasicEntity: weos.BasicEntity{ID: "user-1"}, Roles: []string{"editor"}}
+		if _, err := manager.Login(w, r, user, "account-1"); err != nil {
+			t.Fatalf("unexpected error logging in '%s'", err)
+		}
+	})
+	mux.Handle("/rotate", manager.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := manager.Rotate(w, r, weos.GetSession(r.Context())); err != nil {
+			t.Fatalf("unexpected error rotating session '%s'", err)
+		}
+	})))
+	mux.HandleFunc("/logout", func(w http.ResponseWriter, r *http.Request) {
+		if err := manager.Logout(w, r); err != nil {
+			t.Fatalf("unexpected error logging out '%s'", err)
+		}
+	})
+	mux.Handle("/dashboard", manager.RequireSession(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current = weos.GetSession(r.Context())
+		if weos.GetCurrentUser(r.Context()).ID != "user-1" || weos.GetAccount(r.Context()) != "account-1" {
+			t.Errorf("expected the user and account of the session in the context")
+		}
+		if !weos.GetCurrentUser(r.Context()).HasRole("editor") {
+			t.Errorf("expected the user to have the roles of the session")
+		}
+	})))
+
+	t.Run("requests without a session are redirected to login", func(t *testing.T) {
+		rw := sessionRequest(mux, "/dashboard?tab=posts", nil)
+		if rw.Code != http.StatusFound {
+			t.Fatalf("expected the status to be %d, got %d", http.StatusFound, rw.Code)
+		}
+		if location := rw.Header().Get("Location"); location != "/login?redirect=%2Fdashboard%3Ftab%3Dposts" {
+			t.Errorf("expected to be redirected to login, got '%s'", location)
+		}
+	})
+
+	login := sessionRequest(mux, "/login", nil)
+	t.Run("the session is loaded after logging in", func(t *testing.T) {
+		rw := sessionRequest(mux, "/dashboard", login)
+		if rw.Code != http.StatusOK {
+			t.Fatalf("expected the status to be %d, got %d", http.StatusOK, rw.Code)
+		}
+		if current == nil || current.UserID != "user-1" {
+			t.Fatalf("expected the session to be in the context")
+		}
+	})
+
+	t.Run("rotated sessions get a new id", func(t *testing.T) {
+		previousID := current.ID
+		rotated := sessionRequest(mux, "/rotate", login)
+		if rw := sessionRequest(mux, "/dashboard", rotated); rw.Code != http.StatusOK {
+			t.Fatalf("expected the rotated session to be valid, got status %d", rw.Code)
+		}
+		if current.ID == previousID {
+			t.Error("expected the session id to change")
+		}
+		login = rotated
+	})
+
+	t.Run("tampered cookies are ignored", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/dashboard", nil)
+		cookie := login.Result().Cookies()[0]
+		cookie.Value = strings.ToUpper(cookie.Value)
+		r.AddCookie(cookie)
+		rw := httptest.NewRecorder()
+		mux.ServeHTTP(rw, r)
+		if rw.Code != http.StatusFound {
+			t.Errorf("expected the status to be %d, got %d", http.StatusFound, rw.Code)
+		}
+	})
+
+	t.Run("logging out removes the session", func(t *testing.T) {
+		rw := sessionRequest(mux, "/logout", login)
+		cookies := rw.Result().Cookies()
+		if len(cookies) != 1 || cookies[0].MaxAge >= 0 {
+			t.Errorf("expected the session cookie to be removed, got %v", cookies)
+		}
+	})
+}
+
+func TestSessionManager_CookieStore(t *testing.T) {
+	config := &weos.ApplicationConfig{Secret: "secret", SessionKey: "blog_session", LoginURL: "/login"}
+	manager := weos.NewSessionManager(config, weos.NewCookieSessionStore(config.Secret))
+	testSessionManager(t, manager)
+
+	t.Run("expired sessions are not loaded", func(t *testing.T) {
+		manager.Lifetime = -time.Minute
+		defer func() { manager.Lifetime = weos.DefaultSessionLifetime }()
+		login := sessionRequest(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			manager.Login(w, r, &weos.User{BasicEntity: weos.BasicEntity{ID: "user-1"}}, "")
+		}), "/login", nil)
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		for _, cookie := range login.Result().Cookies() {
+			if cookie.Name != "blog_session" {
+				t.Errorf("expected the cookie name to be '%s', got '%s'", "blog_session", cookie.Name)
+			}
+			r.AddCookie(cookie)
+		}
+		session, err := manager.Load(r)
+		if err != nil {
+			t.Fatalf("unexpected error loading session '%s'", err)
+		}
+		if session != nil {
+			t.Error("expected the expired session not to be loaded")
+		}
+	})
+
+	t.Run("sessions expire by the clock of the manager", func(t *testing.T) {
+		clock := weos.NewFakeClock(time.Date(2021, 8, 1, 12, 0, 0, 0, time.UTC))
+		manager.Clock = clock
+		defer func() { manager.Clock = nil }()
+		login := sessionRequest(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			manager.Login(w, r, &weos.User{BasicEntity: weos.BasicEntity{ID: "user-1"}}, "")
+		}), "/login", nil)
+		load := func() *weos.Session {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			for _, cookie := range login.Result().Cookies() {
+				r.AddCookie(cookie)
+			}
+			session, err := manager.Load(r)
+			if err != nil {
+				t.Fatalf("unexpected error loading session '%s'", err)
+			}
+			return session
+		}
+		if session := load(); session == nil || !session.CreatedAt.Equal(clock.Now()) {
+			t.Fatalf("expected the session to be created at the time of the clock")
+		}
+		clock.Advance(weos.DefaultSessionLifetime + time.Minute)
+		if load() != nil {
+			t.Error("expected the session to expire once the clock passes the lifetime")
+		}
+	})
+
+	t.Run("sessions need a user", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		if _, err := manager.Login(rw, httptest.NewRequest(http.MethodGet, "/login", nil), &weos.User{}, "account-1"); err == nil {
+			t.Error("expected an error starting a session without a user")
+		}
+	})
+
+	t.Run("the account of the session is always in the context", func(t *testing.T) {
+		ctx := weos.SessionContext(context.TODO(), &weos.Session{UserID: "user-1"})
+		if account, ok := ctx.Value(weos.ACCOUNT_ID).(string); !ok || account != "" {
+			t.Errorf("expected the session account to be in the context, got '%v'", ctx.Value(weos.ACCOUNT_ID))
+		}
+	})
+}
+
+func TestSessionManager_CookieStoreRevocations(t *testing.T) {
+	db := newMigrationTestDB(t)
+	revocations := weos.NewGormSessionRevocations(db, log.New())
+	if err := revocations.Migrate(context.TODO()); err != nil {
+		t.Fatalf("unexpected error migrating revocations '%s'", err)
+	}
+	store := weos.NewCookieSessionStore("secret")
+	store.SetRevocations(revocations)
+	manager := weos.NewSessionManager(&weos.ApplicationConfig{Secret: "secret", LoginURL: "/login"}, store)
+	testSessionManager(t, manager)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		manager.Login(w, r, &weos.User{BasicEntity: weos.BasicEntity{ID: "user-1"}}, "account-1")
+	})
+	mux.Handle("/rotate", manager.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		manager.Rotate(w, r, weos.GetSession(r.Context()))
+	})))
+	mux.HandleFunc("/logout", func(w http.ResponseWriter, r *http.Request) {
+		manager.Logout(w, r)
+	})
+	mux.Handle("/dashboard", manager.RequireSession(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	login := sessionRequest(mux, "/login", nil)
+	rotated := sessionRequest(mux, "/rotate", login)
+	if rw := sessionRequest(mux, "/dashboard", login); rw.Code != http.StatusFound {
+		t.Errorf("expected the cookie from before the rotation to be rejected, got status %d", rw.Code)
+	}
+	if rw := sessionRequest(mux, "/dashboard", rotated); rw.Code != http.StatusOK {
+		t.Fatalf("expected the rotated session to be valid, got status %d", rw.Code)
+	}
+	sessionRequest(mux, "/logout", rotated)
+	if rw := sessionRequest(mux, "/dashboard", rotated); rw.Code != http.StatusFound {
+		t.Errorf("expected a copy of the cookie to be rejected after logging out, got status %d", rw.Code)
+	}
+
+	clock := weos.NewFakeClock(time.Now().Add(weos.DefaultSessionLifetime + time.Hour))
+	revocations.SetClock(clock)
+	removed, err := revocations.DeleteExpired(context.TODO())
+	if err != nil {
+		t.Fatalf("unexpected error removing expired revocations '%s'", err)
+	}
+	if removed == 0 {
+		t.Error("expected the revocations of expired sessions to be removed")
+	}
+}
+
+func TestSessionManager_GormStore(t *testing.T) {
+	db := newMigrationTestDB(t)
+	store := weos.NewGormSessionStore(db, "secret", log.New())
+	if err := store.Migrate(context.TODO()); err != nil {
+		t.Fatalf("unexpected error migrating sessions '%s'", err)
+	}
+	manager := weos.NewSessionManager(&weos.ApplicationConfig{Secret: "secret", LoginURL: "/login"}, store)
+	testSessionManager(t, manager)
+
+	var count int64
+	db.Model(&weos.SessionRecord{}).Count(&count)
+	if count != 0 {
+		t.Errorf("expected the rotated and logged out sessions to be removed, %d sessions left", count)
+	}
+
+	expired := &weos.Session{ID: "expired", UserID: "user-1", ExpiresAt: time.Now().Add(-time.Hour)}
+	if _, err := store.Encode(context.TODO(), expired); err != nil {
+		t.Fatalf("unexpected error saving session '%s'", err)
+	}
+	removed, err := store.DeleteExpired(context.TODO())
+	if err != nil {
+		t.Fatalf("unexpected error removing expired sessions '%s'", err)
+	}
+	if removed != 1 {
+		t.Errorf("expected %d expired session to be removed, got %d", 1, removed)
+	}
+}
@@ -0,0 +1,96 @@
+package weos
+
+import (
+	"fmt"
+	"golang.org/x/net/context"
+	"gorm.io/gorm"
+)
+
+//DefaultLargestAggregates is the number of aggregates returned in the statistics if the filter has no limit
+const DefaultLargestAggregates = 10
+
+//StatisticCount is the number of events for a value (e.g. an event type or a day)
+type StatisticCount struct {
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
+}
+
+//EventStatistics summarizes the events in the event store
+type EventStatistics struct {
+	Total        int64            `json:"total"`
+	ByType       []StatisticCount `json:"byType"`
+	ByEntityType []StatisticCount `json:"byEntityType"`
+	ByUser       []StatisticCount `json:"byUser"`
+	//PerDay is keyed by the day (YYYY-MM-DD) the events were created on
+	PerDay []StatisticCount `json:"perDay"`
+	//LargestAggregates are the root aggregates with the most events
+	LargestAggregates []StatisticCount `json:"largestAggregates"`
+}
+
+//StatisticsProvider is implemented by event repositories that can summarize the events they store
+type StatisticsProvider interface {
+	Statistics(ctx context.Context, filter EventFilter) (*EventStatistics, error)
+}
+
+//Statistics counts the events that match the filter. The limit of the filter is the number of largest aggregates
+//returned
+func (e *EventRepositoryGorm) Statistics(ctx context.Context, filter EventFilter) (*EventStatistics, error) {
+	day, err := e.dayExpression()
+	if err != nil {
+		return nil, err
+	}
+	query := func() *gorm.DB {
+		return e.conditions(filter).WithContext(ctx).Model(&GormEvent{})
+	}
+	statistics := &EventStatistics{}
+	if err = query().Count(&statistics.Total).Error; err != nil {
+		return nil, err
+	}
+	groups := []struct {
+		column string
+		counts *[]StatisticCount
+	}{
+		{"type", &statistics.ByType},
+		{"entity_type", &statistics.ByEntityType},
+		{"user", &statistics.ByUser},
+	}
+	for _, group := range groups {
+		//the column is quoted since user is a reserved word in some databases (Group quotes it already)
+		column := e.DB.Statement.Quote(group.column)
+		err = query().Select(column + " AS name, count(*) AS count").Group(group.column).Order("count(*) desc").Order(column).Scan(group.counts).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = query().Select(day + " AS name, count(*) AS count").Group(day).Order(day).Scan(&statistics.PerDay).Error
+	if err != nil {
+		return nil, err
+	}
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = DefaultLargestAggregates
+	}
+	err = query().Select("root_id AS name, count(*) AS count").Group("root_id").Order("count(*) desc").Order("root_id").Limit(limit).Scan(&statistics.LargestAggregates).Error
+	if err != nil {
+		return nil, err
+	}
+	return statistics, nil
+}
+
+//dayExpression is the sql that formats the creation date of an event as YYYY-MM-DD for the database driver
+func (e *EventRepositoryGorm) dayExpression() (string, error) {
+	switch e.DB.Dialector.Name() {
+	case "sqlite":
+		return "strftime('%Y-%m-%d', created_at)", nil
+	case "postgres":
+		return "to_char(created_at, 'YYYY-MM-DD')", nil
+	case "mysql":
+		return "DATE_FORMAT(created_at, '%Y-%m-%d')", nil
+	case "sqlserver":
+		return "CONVERT(varchar(10), created_at, 23)", nil
+	case "clickhouse":
+		return "formatDateTime(created_at, '%Y-%m-%d')", nil
+	default:
+		return "", NewError(fmt.Sprintf("statistics are not supported for database driver '%s'", e.DB.Dialector.Name()), nil)
+	}
+}
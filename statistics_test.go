@@ -0,0 +1,60 @@
+package weos_test
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/wepala/weos"
+	"golang.org/x/net/context"
+	"testing"
+	"time"
+)
+
+func TestEventRepositoryGorm_Statistics(t *testing.T) {
+	repository, err := weos.NewBasicEventRepository(newMigrationTestDB(t), log.New(), false, "", "")
+	if err != nil {
+		t.Fatalf("unexpected error creating repository '%s'", err)
+	}
+	if err = repository.Migrate(context.TODO()); err != nil {
+		t.Fatalf("unexpected error migrating repository '%s'", err)
+	}
+	persistPosts(t, repository, "post1", "POST_CREATED", "POST_UPDATED", "POST_UPDATED")
+	persistPosts(t, repository, "post2", "POST_CREATED")
+	ctx := context.WithValue(context.TODO(), weos.USER_ID, "user1")
+	entity := &weos.AggregateRoot{BasicEntity: weos.BasicEntity{ID: "comment1"}}
+	entity.NewChange(weos.NewEntityEvent("COMMENT_CREATED", entity, "post2", nil))
+	if err = repository.Persist(ctx, entity); err != nil {
+		t.Fatalf("unexpected error persisting events '%s'", err)
+	}
+
+	statistics, err := repository.(*weos.EventRepositoryGorm).Statistics(context.TODO(), weos.EventFilter{Limit: 1})
+	if err != nil {
+		t.Fatalf("unexpected error getting statistics '%s'", err)
+	}
+	if statistics.Total != 5 {
+		t.Errorf("expected %d events, got %d", 5, statistics.Total)
+	}
+	expectCounts := func(t *testing.T, name string, counts []weos.StatisticCount, expected []weos.StatisticCount) {
+		if len(counts) != len(expected) {
+			t.Fatalf("expected %d %s counts, got %v", len(expected), name, counts)
+		}
+		for i := range expected {
+			if counts[i] != expected[i] {
+				t.Errorf("expected %s count %d to be %v, got %v", name, i, expected[i], counts[i])
+			}
+		}
+	}
+	expectCounts(t, "type", statistics.ByType, []weos.StatisticCount{{"POST_CREATED", 2}, {"POST_UPDATED", 2}, {"COMMENT_CREATED", 1}})
+	expectCounts(t, "entity type", statistics.ByEntityType, []weos.StatisticCount{{"AggregateRoot", 5}})
+	expectCounts(t, "user", statistics.ByUser, []weos.StatisticCount{{"", 4}, {"user1", 1}})
+	expectCounts(t, "day", statistics.PerDay, []weos.StatisticCount{{time.Now().UTC().Format("2006-01-02"), 5}})
+	expectCounts(t, "aggregate", statistics.LargestAggregates, []weos.StatisticCount{{"post1", 3}})
+
+	t.Run("filtered by time", func(t *testing.T) {
+		statistics, err := repository.(*weos.EventRepositoryGorm).Statistics(context.TODO(), weos.EventFilter{From: time.Now().Add(time.Hour)})
+		if err != nil {
+			t.Fatalf("unexpected error getting statistics '%s'", err)
+		}
+		if statistics.Total != 0 || len(statistics.ByType) != 0 {
+			t.Errorf("expected no events, got %d", statistics.Total)
+		}
+	})
+}
@@ -0,0 +1,174 @@
+package weos
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"golang.org/x/net/context"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+//Span is a timed operation within a trace. Spans started from a context that already has a span are children of
+//that span so that the causal chain from a command to its events and event handlers can be followed
+type Span struct {
+	TraceID    string            `json:"traceId"`
+	SpanID     string            `json:"spanId"`
+	ParentID   string            `json:"parentId,omitempty"`
+	Name       string            `json:"name"`
+	Start      time.Time         `json:"start"`
+	End        time.Time         `json:"end"`
+	Duration   int64             `json:"durationMicroseconds"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	tracer     *Tracer
+	finished   bool
+	mutex      sync.Mutex
+}
+
+//SetAttribute adds information about the operation to the span. It's safe to call on a nil span
+func (s *Span) SetAttribute(key string, value string) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.Attributes == nil {
+		s.Attributes = make(map[string]string)
+	}
+	s.Attributes[key] = value
+}
+
+//SetError records that the operation failed. It's safe to call on a nil span
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.Error = err.Error()
+}
+
+//Finish ends the span and sends it to the exporter. It's safe to call on a nil span
+func (s *Span) Finish() {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	if s.finished {
+		s.mutex.Unlock()
+		return
+	}
+	s.finished = true
+	s.End = time.Now()
+	s.Duration = s.End.Sub(s.Start).Microseconds()
+	s.mutex.Unlock()
+	s.tracer.export(s)
+}
+
+//SpanExporter sends finished spans somewhere they can be inspected
+type SpanExporter interface {
+	ExportSpan(span *Span) error
+}
+
+//Tracer creates spans and passes them to the exporter when they are finished
+type Tracer struct {
+	exporter SpanExporter
+	logger   Log
+	mutex    sync.RWMutex
+}
+
+func NewTracer(exporter SpanExporter, logger Log) *Tracer {
+	return &Tracer{exporter: exporter, logger: logger}
+}
+
+//SetExporter changes where spans are exported to. If the exporter is nil spans are still created (so that the trace
+//is propagated) but they are not exported
+func (t *Tracer) SetExporter(exporter SpanExporter) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.exporter = exporter
+}
+
+//StartSpan creates a span that is a child of the span in the context (if there is one). If the tracer is nil the tracer
+//of the span in the context is used and if there is no span in the context no span is created.
+func (t *Tracer) StartSpan(ctx context.Context, name string) (context.Context, *Span) {
+	parent := GetSpan(ctx)
+	if t == nil {
+		if parent == nil {
+			return ctx, nil
+		}
+		t = parent.tracer
+	}
+	span := &Span{
+		SpanID: newTraceID(8),
+		Name:   name,
+		Start:  time.Now(),
+		tracer: t,
+	}
+	if parent != nil {
+		span.TraceID = parent.TraceID
+		span.ParentID = parent.SpanID
+	} else {
+		span.TraceID = newTraceID(16)
+	}
+	return context.WithValue(ctx, SPAN, span), span
+}
+
+func (t *Tracer) export(span *Span) {
+	if t == nil {
+		return
+	}
+	t.mutex.RLock()
+	exporter := t.exporter
+	t.mutex.RUnlock()
+	if exporter == nil {
+		return
+	}
+	if err := exporter.ExportSpan(span); err != nil && t.logger != nil {
+		t.logger.Errorf("error exporting span '%s'", err)
+	}
+}
+
+//StartSpan creates a span that is a child of the span in the context. This is meant to be used in command and event
+//handlers to add their own operations to the trace
+func StartSpan(ctx context.Context, name string) (context.Context, *Span) {
+	var tracer *Tracer
+	return tracer.StartSpan(ctx, name)
+}
+
+func newTraceID(size int) string {
+	id := make([]byte, size)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+//JSONSpanExporter writes each span as a line of JSON
+type JSONSpanExporter struct {
+	writer io.Writer
+	mutex  sync.Mutex
+}
+
+func NewJSONSpanExporter(writer io.Writer) *JSONSpanExporter {
+	return &JSONSpanExporter{writer: writer}
+}
+
+//NewStdoutSpanExporter writes spans to stdout which is useful for local development
+func NewStdoutSpanExporter() *JSONSpanExporter {
+	return NewJSONSpanExporter(os.Stdout)
+}
+
+func (e *JSONSpanExporter) ExportSpan(span *Span) error {
+	span.mutex.Lock()
+	spanJSON, err := json.Marshal(span)
+	span.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	_, err = e.writer.Write(append(spanJSON, '\n'))
+	return err
+}
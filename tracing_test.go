@@ -0,0 +1,134 @@
+package weos_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/wepala/weos"
+	"golang.org/x/net/context"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type testSpanExporter struct {
+	spans []*weos.Span
+	mutex sync.Mutex
+}
+
+func (e *testSpanExporter) ExportSpan(span *weos.Span) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.spans = append(e.spans, span)
+	return nil
+}
+
+func (e *testSpanExporter) span(name string) *weos.Span {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	for _, span := range e.spans {
+		if span.Name == name {
+			return span
+		}
+	}
+	return nil
+}
+
+func TestTracer_StartSpan(t *testing.T) {
+	exporter := &testSpanExporter{}
+	tracer := weos.NewTracer(exporter, log.New())
+
+	ctx, parent := tracer.StartSpan(context.TODO(), "parent")
+	_, child := weos.StartSpan(ctx, "child")
+	child.SetError(errors.New("some error"))
+	child.Finish()
+	parent.Finish()
+	parent.Finish()
+
+	if len(exporter.spans) != 2 {
+		t.Fatalf("expected %d spans to be exported, got %d", 2, len(exporter.spans))
+	}
+	if child.TraceID != parent.TraceID {
+		t.Errorf("expected the child to be in trace '%s', got '%s'", parent.TraceID, child.TraceID)
+	}
+	if child.ParentID != parent.SpanID {
+		t.Errorf("expected the child parent to be '%s', got '%s'", parent.SpanID, child.ParentID)
+	}
+	if child.Error != "some error" {
+		t.Errorf("expected the error to be recorded, got '%s'", child.Error)
+	}
+
+	t.Run("no span is created without a tracer", func(t *testing.T) {
+		ctx, span := weos.StartSpan(context.TODO(), "orphan")
+		if span != nil {
+			t.Error("expected no span to be created")
+		}
+		span.SetAttribute("key", "value")
+		span.Finish()
+		if weos.GetSpan(ctx) != nil {
+			t.Error("expected no span in the context")
+		}
+	})
+}
+
+func TestJSONSpanExporter_ExportSpan(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	tracer := weos.NewTracer(weos.NewJSONSpanExporter(buffer), log.New())
+	_, span := tracer.StartSpan(context.TODO(), "test")
+	span.SetAttribute("command.type", "CREATE_POST")
+	span.Finish()
+
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected %d line, got %d", 1, len(lines))
+	}
+	exported := &weos.Span{}
+	if err := json.Unmarshal([]byte(lines[0]), exported); err != nil {
+		t.Fatalf("unexpected error unmarshalling span '%s'", err)
+	}
+	if exported.Name != "test" || exported.Attributes["command.type"] != "CREATE_POST" {
+		t.Errorf("expected the span details to be exported, got '%s'", lines[0])
+	}
+}
+
+func TestTracing_Dispatch(t *testing.T) {
+	exporter := &testSpanExporter{}
+	tracer := weos.NewTracer(exporter, log.New())
+	repository, err := weos.NewBasicEventRepository(newMigrationTestDB(t), log.New(), false, "", "")
+	if err != nil {
+		t.Fatalf("unexpected error creating repository '%s'", err)
+	}
+	if err = repository.Migrate(context.TODO()); err != nil {
+		t.Fatalf("unexpected error migrating repository '%s'", err)
+	}
+	repository.(*weos.EventRepositoryGorm).SetTracer(tracer)
+	repository.AddSubscriber(func(ctx context.Context, event weos.Event) {})
+
+	dispatcher := &weos.DefaultCommandDispatcher{Tracer: tracer}
+	dispatcher.AddSubscriber(&weos.Command{Type: "CREATE_POST"}, func(ctx context.Context, command *weos.Command) error {
+		entity := &weos.AggregateRoot{BasicEntity: weos.BasicEntity{ID: "1wqoyqIRsZTtnP3wjKh2Mq1Qp03"}}
+		entity.NewChange(weos.NewEntityEvent("POST_CREATED", entity, entity.ID, nil))
+		return repository.Persist(ctx, entity)
+	})
+	if err = dispatcher.Dispatch(context.TODO(), &weos.Command{Type: "CREATE_POST"}); err != nil {
+		t.Fatalf("unexpected error dispatching command '%s'", err)
+	}
+
+	dispatch := exporter.span("command.dispatch")
+	handler := exporter.span("command.handler")
+	persist := exporter.span("event_store.persist")
+	eventHandler := exporter.span("event.handler")
+	if dispatch == nil || handler == nil || persist == nil || eventHandler == nil {
+		t.Fatalf("expected spans for the dispatch, command handler, persist and event handler")
+	}
+	if handler.ParentID != dispatch.SpanID || persist.ParentID != handler.SpanID || eventHandler.ParentID != persist.SpanID {
+		t.Error("expected the spans to follow the causal chain")
+	}
+	if eventHandler.TraceID != dispatch.TraceID {
+		t.Errorf("expected all spans to be in trace '%s'", dispatch.TraceID)
+	}
+	if eventHandler.Attributes["event.type"] != "POST_CREATED" {
+		t.Errorf("expected the event type to be recorded, got '%s'", eventHandler.Attributes["event.type"])
+	}
+}
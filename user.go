@@ -2,4 +2,26 @@ package weos
 
 type User struct {
 	BasicEntity
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+}
+
+//HasRole checks if the user has the role
+func (u *User) HasRole(role string) bool {
+	for _, r := range u.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+//HasPermission checks if the user was granted the permission. The "*" permission grants all permissions
+func (u *User) HasPermission(permission string) bool {
+	for _, p := range u.Permissions {
+		if p == permission || p == "*" {
+			return true
+		}
+	}
+	return false
 }
@@ -9,3 +9,11 @@ func GetType(myvar interface{}) string {
 		return t.Name()
 	}
 }
+
+//ProjectionName is the name of the projection if it has one (e.g. GormProjection) or its type
+func ProjectionName(projection Projection) string {
+	if named, ok := projection.(interface{ Name() string }); ok {
+		return named.Name()
+	}
+	return GetType(projection)
+}
@@ -0,0 +1,243 @@
+package weos
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+//ValidationTag is the struct tag the validation rules are declared in e.g. `validate:"required,min=3,max=50"`.
+//
+//The rules are
+//  required        the value can't be the zero value
+//  min=n, max=n    the length of strings, slices and maps or the value of numbers
+//  enum=a|b|c      the value must be one of the options
+//  nested          structs (or slices of structs) are validated as well
+//  omitempty       the other rules are skipped if the value is the zero value
+//  pattern=regex   strings must match the regular expression. It must be the last rule since the regex may contain commas
+//
+//Rules are checked for zero values too (e.g. min=1 fails for 0) so optional fields need omitempty or a pointer type.
+//Rules are skipped for nil pointers
+const ValidationTag = "validate"
+
+var validationPatterns sync.Map
+
+//Validate checks the validation rules of the entity's fields and adds an error for each field that is invalid. It
+//returns whether the entity is valid
+func Validate(entity ValueObject) bool {
+	entityID := ""
+	if e, ok := entity.(Entity); ok {
+		entityID = e.GetID()
+	}
+	for _, err := range validate(reflect.ValueOf(entity), "", entityID) {
+		entity.AddError(err)
+	}
+	return entity.IsValid()
+}
+
+//ValidateStruct checks the validation rules of the fields of a struct (e.g. a command payload) and returns a
+//DomainError for each field that is invalid
+func ValidateStruct(value interface{}) []error {
+	return validate(reflect.ValueOf(value), "", "")
+}
+
+func validate(value reflect.Value, prefix string, entityID string) []error {
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return nil
+	}
+	var errs []error
+	valueType := value.Type()
+	for i := 0; i < valueType.NumField(); i++ {
+		field := valueType.Field(i)
+		//unexported fields can't be read
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+		tag, hasTag := field.Tag.Lookup(ValidationTag)
+		//embedded structs (e.g. BasicEntity) are part of the entity
+		if field.Anonymous && !hasTag {
+			errs = append(errs, validate(value.Field(i), prefix, entityID)...)
+			continue
+		}
+		if !hasTag || tag == "" || tag == "-" {
+			continue
+		}
+		name := prefix + fieldName(field)
+		for _, message := range validateField(value.Field(i), tag) {
+			errs = append(errs, newFieldError(name+" "+message, valueType.Name(), entityID, name))
+		}
+		if hasRule(tag, "nested") {
+			errs = append(errs, validateNested(value.Field(i), name, entityID)...)
+		}
+	}
+	return errs
+}
+
+func validateNested(value reflect.Value, name string, entityID string) []error {
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+	switch value.Kind() {
+	case reflect.Struct:
+		return validate(value, name+".", entityID)
+	case reflect.Slice, reflect.Array:
+		var errs []error
+		for i := 0; i < value.Len(); i++ {
+			errs = append(errs, validateNested(value.Index(i), fmt.Sprintf("%s[%d]", name, i), entityID)...)
+		}
+		return errs
+	}
+	return nil
+}
+
+//validateField returns a message for each rule of the tag the value doesn't meet
+func validateField(value reflect.Value, tag string) []string {
+	rules := parseRules(tag)
+	if value.IsZero() {
+		if _, ok := rules["required"]; ok {
+			return []string{"is required"}
+		}
+		if _, ok := rules["omitempty"]; ok {
+			return nil
+		}
+	}
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+	var messages []string
+	for _, rule := range []string{"min", "max", "enum", "pattern"} {
+		argument, ok := rules[rule]
+		if !ok {
+			continue
+		}
+		var message string
+		switch rule {
+		case "min", "max":
+			message = validateRange(value, rule, argument)
+		case "enum":
+			options := strings.Split(argument, "|")
+			//the value is printed without Interface since fields of unexported embedded structs can't be interfaced
+			actual := fmt.Sprint(value)
+			valid := false
+			for _, option := range options {
+				if option == actual {
+					valid = true
+					break
+				}
+			}
+			if !valid {
+				message = "must be one of " + strings.Join(options, ", ")
+			}
+		case "pattern":
+			message = validatePattern(value, argument)
+		}
+		if message != "" {
+			messages = append(messages, message)
+		}
+	}
+	return messages
+}
+
+func validateRange(value reflect.Value, rule string, argument string) string {
+	limit, err := strconv.ParseFloat(argument, 64)
+	if err != nil {
+		return fmt.Sprintf("has an invalid %s rule '%s'", rule, argument)
+	}
+	var actual float64
+	unit := ""
+	switch value.Kind() {
+	case reflect.String:
+		actual = float64(utf8.RuneCountInString(value.String()))
+		unit = " characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		actual = float64(value.Len())
+		unit = " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		actual = float64(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		actual = float64(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		actual = value.Float()
+	default:
+		return ""
+	}
+	if rule == "min" && actual < limit {
+		return fmt.Sprintf("must be at least %s%s", argument, unit)
+	}
+	if rule == "max" && actual > limit {
+		return fmt.Sprintf("must be at most %s%s", argument, unit)
+	}
+	return ""
+}
+
+func validatePattern(value reflect.Value, pattern string) string {
+	if value.Kind() != reflect.String {
+		return ""
+	}
+	compiled, ok := validationPatterns.Load(pattern)
+	if !ok {
+		expression, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Sprintf("has an invalid pattern '%s'", pattern)
+		}
+		compiled, _ = validationPatterns.LoadOrStore(pattern, expression)
+	}
+	if !compiled.(*regexp.Regexp).MatchString(value.String()) {
+		return fmt.Sprintf("doesn't match the pattern '%s'", pattern)
+	}
+	return ""
+}
+
+func parseRules(tag string) map[string]string {
+	rules := make(map[string]string)
+	//everything after pattern= is the regular expression
+	if index := strings.Index(tag, "pattern="); index != -1 && (index == 0 || tag[index-1] == ',') {
+		rules["pattern"] = tag[index+len("pattern="):]
+		tag = strings.TrimSuffix(tag[:index], ",")
+	}
+	for _, rule := range strings.Split(tag, ",") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		parts := strings.SplitN(rule, "=", 2)
+		if len(parts) == 2 {
+			rules[parts[0]] = parts[1]
+		} else {
+			rules[parts[0]] = ""
+		}
+	}
+	return rules
+}
+
+func hasRule(tag string, rule string) bool {
+	_, ok := parseRules(tag)[rule]
+	return ok
+}
+
+//fieldName is the json name of the field so that errors match the payloads clients send
+func fieldName(field reflect.StructField) string {
+	if tag, ok := field.Tag.Lookup("json"); ok {
+		name := strings.Split(tag, ",")[0]
+		if name != "" && name != "-" {
+			return name
+		}
+	}
+	return field.Name
+}
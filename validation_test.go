@@ -0,0 +1,157 @@
+package weos_test
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/wepala/weos"
+	"golang.org/x/net/context"
+	"strings"
+	"testing"
+)
+
+type ValidatedAuthor struct {
+	Name  string `json:"name" validate:"required"`
+	Email string `json:"email" validate:"omitempty,pattern=^[^@]+@[^@]+$"`
+}
+
+type ValidatedPost struct {
+	weos.BasicEntity
+	Title    string             `json:"title" validate:"required,min=3,max=20"`
+	Status   string             `json:"status" validate:"omitempty,enum=draft|published"`
+	Rating   int                `json:"rating" validate:"omitempty,min=1,max=5"`
+	Slug     string             `json:"slug" validate:"omitempty,pattern=^[a-z0-9]+(-[a-z0-9]+){0,3}$"`
+	Tags     []string           `validate:"max=2"`
+	Author   *ValidatedAuthor   `json:"author" validate:"required,nested"`
+	Editors  []*ValidatedAuthor `json:"editors" validate:"nested"`
+	Comments int                `json:"-"`
+}
+
+func TestValidate(t *testing.T) {
+	t.Run("valid entity", func(t *testing.T) {
+		post := &ValidatedPost{
+			BasicEntity: weos.BasicEntity{ID: "post-1"},
+			Title:       "First Post",
+			Status:      "draft",
+			Slug:        "first-post",
+			Author:      &ValidatedAuthor{Name: "Jane", Email: "jane@example.com"},
+		}
+		if !weos.Validate(post) {
+			t.Errorf("expected the post to be valid, got errors %v", post.GetErrors())
+		}
+	})
+
+	t.Run("each invalid field is reported", func(t *testing.T) {
+		post := &ValidatedPost{
+			BasicEntity: weos.BasicEntity{ID: "post-2"},
+			Title:       "Hi",
+			Status:      "archived",
+			Rating:      6,
+			Slug:        "Not A Slug",
+			Tags:        []string{"one", "two", "three"},
+			Author:      &ValidatedAuthor{Email: "jane"},
+			Editors:     []*ValidatedAuthor{{Name: "Joe"}, {}},
+		}
+		if weos.Validate(post) {
+			t.Fatal("expected the post to be invalid")
+		}
+		expected := map[string]string{
+			"title":           "title must be at least 3 characters",
+			"status":          "status must be one of draft, published",
+			"rating":          "rating must be at most 5",
+			"slug":            "slug doesn't match the pattern '^[a-z0-9]+(-[a-z0-9]+){0,3}$'",
+			"Tags":            "Tags must be at most 2 items",
+			"author.name":     "author.name is required",
+			"author.email":    "author.email doesn't match the pattern '^[^@]+@[^@]+$'",
+			"editors[1].name": "editors[1].name is required",
+		}
+		if len(post.GetErrors()) != len(expected) {
+			t.Errorf("expected %d errors, got %d: %v", len(expected), len(post.GetErrors()), post.GetErrors())
+		}
+		for _, err := range post.GetErrors() {
+			var domainError *weos.DomainError
+			if !errors.As(err, &domainError) {
+				t.Fatalf("expected a domain error, got %T", err)
+			}
+			if message, ok := expected[domainError.Field]; !ok || message != domainError.Error() {
+				t.Errorf("unexpected error '%s' for field '%s'", domainError.Error(), domainError.Field)
+			}
+			if domainError.EntityID != "post-2" {
+				t.Errorf("expected the entity id to be '%s', got '%s'", "post-2", domainError.EntityID)
+			}
+		}
+	})
+
+	t.Run("required fields", func(t *testing.T) {
+		post := &ValidatedPost{}
+		weos.Validate(post)
+		fields := map[string]bool{}
+		for _, err := range post.GetErrors() {
+			fields[err.(*weos.DomainError).Field] = true
+		}
+		if len(fields) != 2 || !fields["title"] || !fields["author"] {
+			t.Errorf("expected the title and author to be required, got %v", post.GetErrors())
+		}
+	})
+}
+
+type validatedSource struct {
+	Source string `json:"source" validate:"enum=web|api"`
+}
+
+type ValidatedComment struct {
+	validatedSource
+	Likes int    `json:"likes" validate:"min=1"`
+	Body  string `json:"body" validate:"pattern=^.+$"`
+}
+
+func TestValidateStruct(t *testing.T) {
+	t.Run("rules are checked for zero values", func(t *testing.T) {
+		errs := weos.ValidateStruct(&ValidatedComment{})
+		fields := map[string]bool{}
+		for _, err := range errs {
+			fields[err.(*weos.DomainError).Field] = true
+		}
+		if len(fields) != 3 || !fields["source"] || !fields["likes"] || !fields["body"] {
+			t.Errorf("expected the zero values to be invalid, got %v", errs)
+		}
+	})
+
+	t.Run("fields of unexported embedded structs", func(t *testing.T) {
+		errs := weos.ValidateStruct(&ValidatedComment{validatedSource: validatedSource{Source: "email"}, Likes: 1, Body: "Nice post"})
+		if len(errs) != 1 || errs[0].Error() != "source must be one of web, api" {
+			t.Errorf("expected the source to be invalid, got %v", errs)
+		}
+	})
+}
+
+func TestCommandDisptacher_RegisterPayload(t *testing.T) {
+	dispatcher := &weos.DefaultCommandDispatcher{}
+	handlerCalled := false
+	dispatcher.AddSubscriber(&weos.Command{Type: "CREATE_POST"}, func(ctx context.Context, command *weos.Command) error {
+		handlerCalled = true
+		return nil
+	})
+	dispatcher.RegisterPayload("CREATE_POST", &ValidatedPost{})
+
+	err := dispatcher.Dispatch(context.TODO(), &weos.Command{Type: "CREATE_POST", Payload: json.RawMessage(`{"title":"Hi"}`)})
+	if err == nil {
+		t.Fatal("expected an error dispatching a command with an invalid payload")
+	}
+	if handlerCalled {
+		t.Error("expected the handler not to be called")
+	}
+	if !strings.Contains(err.Error(), "title must be at least 3 characters") || !strings.Contains(err.Error(), "author is required") {
+		t.Errorf("expected the error to list the invalid fields, got '%s'", err)
+	}
+	if cause := errors.Unwrap(err); cause != nil {
+		t.Errorf("expected the invalid fields not to be repeated in the cause, got '%s'", cause)
+	}
+
+	err = dispatcher.Dispatch(context.TODO(), &weos.Command{Type: "CREATE_POST", Payload: json.RawMessage(`{"title":"First Post","author":{"name":"Jane"}}`)})
+	if err != nil {
+		t.Fatalf("unexpected error dispatching command '%s'", err)
+	}
+	if !handlerCalled {
+		t.Error("expected the handler to be called")
+	}
+}
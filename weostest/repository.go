@@ -0,0 +1,240 @@
+package weostest
+
+import (
+	"fmt"
+	"github.com/wepala/weos"
+	"golang.org/x/net/context"
+	"sort"
+	"sync"
+	"time"
+)
+
+//EventRepository is an in memory event store for tests. It fills in the event metadata, scopes events to accounts and
+//dispatches events to subscribers like the Gorm event repository but nothing is written to a database
+type EventRepository struct {
+	*memoryStore
+	accountID string
+}
+
+//memoryStore is shared by a repository and the copies scoped to accounts
+type memoryStore struct {
+	events      []*weos.Event
+	subscribers []weos.EventHandler
+	clock       weos.Clock
+	mutex       sync.RWMutex
+}
+
+func NewEventRepository() *EventRepository {
+	return &EventRepository{memoryStore: &memoryStore{}}
+}
+
+//SetClock sets the clock used for the time events are stored at
+func (r *EventRepository) SetClock(clock weos.Clock) {
+	r.clock = clock
+}
+
+//WithContext returns a copy of the repository that only reads and writes the events of the account in the context
+func (r *EventRepository) WithContext(ctx context.Context) (weos.EventRepository, error) {
+	accountID, err := r.account(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if accountID == "" {
+		return nil, weos.NewUnauthorizedError(ctx, "account_required", "an account is required to scope the events", nil)
+	}
+	return &EventRepository{memoryStore: r.memoryStore, accountID: accountID}, nil
+}
+
+func (r *EventRepository) account(ctx context.Context) (string, error) {
+	ctxAccount := weos.GetAccount(ctx)
+	if r.accountID == "" {
+		return ctxAccount, nil
+	}
+	if ctxAccount != "" && ctxAccount != r.accountID {
+		return "", weos.NewUnauthorizedError(ctx, "account_mismatch", fmt.Sprintf("account '%s' can't access events for account '%s'", ctxAccount, r.accountID), nil)
+	}
+	return r.accountID, nil
+}
+
+func (r *EventRepository) Flush() error {
+	return nil
+}
+
+func (r *EventRepository) Migrate(ctx context.Context) error {
+	return nil
+}
+
+func (r *EventRepository) Persist(ctx context.Context, entity weos.AggregateInterface) error {
+	accountID, err := r.account(ctx)
+	if err != nil {
+		return err
+	}
+	entities := entity.GetNewChanges()
+	var events []*weos.Event
+	for _, e := range entities {
+		event := e.(*weos.Event)
+		//the metadata is stamped like EventRepositoryGorm does it
+		if event.Meta.User == "" {
+			event.Meta.User = weos.ContextUser(ctx)
+		}
+		if event.Meta.AccountID == "" {
+			event.Meta.AccountID = accountID
+		}
+		if event.Meta.AccountID == "" {
+			event.Meta.AccountID = weos.ContextAccount(ctx)
+		}
+		if accountID != "" && event.Meta.AccountID != accountID {
+			return weos.NewUnauthorizedError(ctx, "account_mismatch", fmt.Sprintf("event '%s' belongs to account '%s' not '%s'", event.ID, event.Meta.AccountID, accountID), nil)
+		}
+		if event.Meta.Module == "" {
+			event.Meta.Module = weos.GetModuleID(ctx)
+		}
+		if event.Meta.CorrelationID == "" {
+			event.Meta.CorrelationID = weos.GetCorrelationID(ctx)
+		}
+		if event.Meta.CausationID == "" {
+			event.Meta.CausationID = weos.GetCausationID(ctx)
+		}
+		if event.Meta.RequestID == "" {
+			event.Meta.RequestID = weos.GetRequestID(ctx)
+		}
+		if !event.IsValid() {
+			return event.GetErrors()[0]
+		}
+		event.Meta.Created = r.now().Format(time.RFC3339Nano)
+		events = append(events, event)
+	}
+	r.Store(events...)
+	entity.Persist()
+
+	for _, event := range events {
+		for _, subscriber := range r.getSubscribers() {
+			subscriber(ctx, *event)
+		}
+	}
+	return nil
+}
+
+//Store adds the events as they are without dispatching them (e.g. to set up the events that happened before a test).
+//Events without a creation time are stored at the current time of the clock
+func (r *EventRepository) Store(events ...*weos.Event) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, event := range events {
+		stored := *event
+		if stored.Meta.Created == "" {
+			stored.Meta.Created = r.now().Format(time.RFC3339Nano)
+		}
+		r.events = append(r.events, &stored)
+	}
+}
+
+func (r *EventRepository) now() time.Time {
+	if r.clock != nil {
+		return r.clock.Now()
+	}
+	return weos.DefaultClock.Now()
+}
+
+//Events returns all the stored events in the order they were stored
+func (r *EventRepository) Events() []*weos.Event {
+	return r.find(func(event *weos.Event) bool { return true })
+}
+
+func (r *EventRepository) GetByAggregate(ID string) ([]*weos.Event, error) {
+	return r.bySequence(r.find(func(event *weos.Event) bool {
+		return event.Meta.RootID == ID
+	})), nil
+}
+
+func (r *EventRepository) GetByEntityAndAggregate(entityID string, entityType string, rootID string) ([]*weos.Event, error) {
+	return r.bySequence(r.find(func(event *weos.Event) bool {
+		return event.Meta.EntityID == entityID && event.Meta.EntityType == entityType && event.Meta.RootID == rootID
+	})), nil
+}
+
+func (r *EventRepository) GetByAggregateAndType(ID string, entityType string) ([]*weos.Event, error) {
+	return r.bySequence(r.find(func(event *weos.Event) bool {
+		return event.Meta.EntityID == ID && event.Meta.EntityType == entityType
+	})), nil
+}
+
+func (r *EventRepository) GetAggregateSequenceNumber(ID string) (int64, error) {
+	var sequenceNo int64
+	for _, event := range r.find(func(event *weos.Event) bool { return event.Meta.RootID == ID }) {
+		if event.Meta.SequenceNo > sequenceNo {
+			sequenceNo = event.Meta.SequenceNo
+		}
+	}
+	return sequenceNo, nil
+}
+
+func (r *EventRepository) GetByAggregateAndSequenceRange(ID string, start int64, end int64) ([]*weos.Event, error) {
+	return r.bySequence(r.find(func(event *weos.Event) bool {
+		return event.Meta.EntityID == ID && event.Meta.SequenceNo >= start && event.Meta.SequenceNo <= end
+	})), nil
+}
+
+func (r *EventRepository) GetByCorrelationID(correlationID string) ([]*weos.Event, error) {
+	return r.find(func(event *weos.Event) bool {
+		return event.Meta.CorrelationID == correlationID
+	}), nil
+}
+
+func (r *EventRepository) GetEvents(filter weos.EventFilter) ([]*weos.Event, error) {
+	events := r.find(func(event *weos.Event) bool {
+		created, _ := time.Parse(time.RFC3339Nano, event.Meta.Created)
+		return (filter.ID == "" || event.ID == filter.ID) &&
+			(filter.ApplicationID == "" || event.Meta.Module == filter.ApplicationID) &&
+			(filter.RootID == "" || event.Meta.RootID == filter.RootID) &&
+			(filter.EntityID == "" || event.Meta.EntityID == filter.EntityID) &&
+			(filter.EntityType == "" || event.Meta.EntityType == filter.EntityType) &&
+			(filter.Type == "" || event.Type == filter.Type) &&
+			(filter.From.IsZero() || !created.Before(filter.From)) &&
+			(filter.To.IsZero() || created.Before(filter.To))
+	})
+	if filter.Limit > 0 && len(events) > filter.Limit {
+		events = events[:filter.Limit]
+	}
+	return events, nil
+}
+
+func (r *EventRepository) AddSubscriber(handler weos.EventHandler) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.subscribers = append(r.subscribers, handler)
+}
+
+func (r *EventRepository) GetSubscribers() ([]weos.EventHandler, error) {
+	return r.getSubscribers(), nil
+}
+
+func (r *EventRepository) getSubscribers() []weos.EventHandler {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return append([]weos.EventHandler(nil), r.subscribers...)
+}
+
+//find returns copies of the events of the repository account that match so that tests can't change the stored events
+func (r *EventRepository) find(match func(event *weos.Event) bool) []*weos.Event {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	var events []*weos.Event
+	for _, event := range r.events {
+		if r.accountID != "" && event.Meta.AccountID != r.accountID {
+			continue
+		}
+		if match(event) {
+			found := *event
+			events = append(events, &found)
+		}
+	}
+	return events
+}
+
+func (r *EventRepository) bySequence(events []*weos.Event) []*weos.Event {
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Meta.SequenceNo < events[j].Meta.SequenceNo
+	})
+	return events
+}
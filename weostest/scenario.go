@@ -0,0 +1,309 @@
+//Package weostest helps test aggregates and command handlers. A Scenario declares the events that already happened
+//(Given), dispatches a command (When) and checks the events, errors and aggregate state that result (Then) using an
+//in memory event store
+package weostest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/wepala/weos"
+	"golang.org/x/net/context"
+	"reflect"
+	"time"
+)
+
+//TestingT is the part of testing.T that scenarios use
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+	Fatalf(format string, args ...interface{})
+}
+
+//Scenario is a Given/When/Then test of command handlers
+type Scenario struct {
+	t          TestingT
+	repository *EventRepository
+	dispatcher *weos.DefaultCommandDispatcher
+	clock      *weos.FakeClock
+	generator  *weos.FakeIDGenerator
+	emitted    []*weos.Event
+	err        error
+	handled    bool
+}
+
+//NewScenario creates a scenario with an empty event store. Events and commands get predictable ids and times from a
+//fake clock and id generator
+func NewScenario(t TestingT) *Scenario {
+	clock := weos.NewFakeClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	generator := weos.NewFakeIDGenerator("id")
+	repository := NewEventRepository()
+	repository.SetClock(clock)
+	return &Scenario{
+		t:          t,
+		repository: repository,
+		dispatcher: &weos.DefaultCommandDispatcher{Clock: clock, IDGenerator: generator},
+		clock:      clock,
+		generator:  generator,
+	}
+}
+
+//Repository returns the event store that handlers should persist their aggregates to
+func (s *Scenario) Repository() *EventRepository {
+	return s.repository
+}
+
+//Dispatcher returns the dispatcher commands are sent to (e.g. to set an authorizer)
+func (s *Scenario) Dispatcher() *weos.DefaultCommandDispatcher {
+	return s.dispatcher
+}
+
+//Clock returns the fake clock of the scenario so that tests can move time forward between commands
+func (s *Scenario) Clock() *weos.FakeClock {
+	return s.clock
+}
+
+//Handle adds a handler for a command type
+func (s *Scenario) Handle(commandType string, handler weos.CommandHandler) *Scenario {
+	s.dispatcher.AddSubscriber(&weos.Command{Type: commandType}, handler)
+	return s
+}
+
+//Given stores events that happened before the command. They are not sent to subscribers. Ids and sequence numbers are
+//filled in when they are missing and the entity id defaults to the root id
+func (s *Scenario) Given(events ...*weos.Event) *Scenario {
+	s.t.Helper()
+	for _, event := range events {
+		if event.ID == "" {
+			event.ID = s.generator.NewID()
+		}
+		if event.Version == 0 {
+			event.Version = 1
+		}
+		if event.Meta.EntityID == "" {
+			event.Meta.EntityID = event.Meta.RootID
+		}
+		if event.Meta.SequenceNo == 0 {
+			sequenceNo, _ := s.repository.GetAggregateSequenceNumber(event.Meta.RootID)
+			event.Meta.SequenceNo = sequenceNo + 1
+		}
+		if !event.IsValid() {
+			s.t.Fatalf("invalid given event '%s': %s", event.Type, event.GetErrors()[0])
+		}
+		s.repository.Store(event)
+	}
+	return s
+}
+
+//When dispatches the command and records the events it emitted and the error it returned
+func (s *Scenario) When(command *weos.Command) *Scenario {
+	return s.WhenWithContext(context.Background(), command)
+}
+
+//WhenWithContext dispatches the command with a context (e.g. one with the current user)
+func (s *Scenario) WhenWithContext(ctx context.Context, command *weos.Command) *Scenario {
+	before := len(s.repository.Events())
+	s.err = s.dispatcher.Dispatch(ctx, command)
+	s.emitted = s.repository.Events()[before:]
+	s.handled = true
+	return s
+}
+
+//Emitted returns the events stored while the command was handled
+func (s *Scenario) Emitted() []*weos.Event {
+	return s.emitted
+}
+
+//ThenEvents checks that the command emitted the expected events in order. The type and payload of each event are
+//compared and the root id, entity id and entity type are only compared when they are set on the expected event.
+//Payloads are compared as JSON values so field order and formatting don't matter
+func (s *Scenario) ThenEvents(expected ...*weos.Event) *Scenario {
+	s.t.Helper()
+	s.mustHaveHandled()
+	if len(s.emitted) != len(expected) {
+		s.t.Fatalf("expected %d events, got %d %s", len(expected), len(s.emitted), eventTypes(s.emitted))
+		return s
+	}
+	for i, event := range expected {
+		actual := s.emitted[i]
+		if actual.Type != event.Type {
+			s.t.Errorf("expected event %d to be '%s', got '%s'", i, event.Type, actual.Type)
+			continue
+		}
+		if event.Meta.RootID != "" && actual.Meta.RootID != event.Meta.RootID {
+			s.t.Errorf("expected event '%s' to have the root id '%s', got '%s'", event.Type, event.Meta.RootID, actual.Meta.RootID)
+		}
+		if event.Meta.EntityID != "" && actual.Meta.EntityID != event.Meta.EntityID {
+			s.t.Errorf("expected event '%s' to have the entity id '%s', got '%s'", event.Type, event.Meta.EntityID, actual.Meta.EntityID)
+		}
+		if event.Meta.EntityType != "" && actual.Meta.EntityType != event.Meta.EntityType {
+			s.t.Errorf("expected event '%s' to have the entity type '%s', got '%s'", event.Type, event.Meta.EntityType, actual.Meta.EntityType)
+		}
+		equal, err := jsonEqual(event.Payload, actual.Payload)
+		if err != nil {
+			s.t.Errorf("unable to compare the payload of event '%s': %s", event.Type, err)
+		} else if !equal {
+			s.t.Errorf("expected event '%s' to have the payload %s, got %s", event.Type, event.Payload, actual.Payload)
+		}
+	}
+	return s
+}
+
+//ThenNoEvents checks that the command didn't emit any events
+func (s *Scenario) ThenNoEvents() *Scenario {
+	s.t.Helper()
+	return s.ThenEvents()
+}
+
+//ThenNoError checks that the command was handled without an error
+func (s *Scenario) ThenNoError() *Scenario {
+	s.t.Helper()
+	s.mustHaveHandled()
+	if s.err != nil {
+		s.t.Errorf("expected no error, got '%s'", s.err)
+	}
+	return s
+}
+
+//ThenError checks that the command returned the expected error or an error with the same message
+func (s *Scenario) ThenError(expected error) *Scenario {
+	s.t.Helper()
+	s.mustHaveHandled()
+	if s.err == nil {
+		s.t.Errorf("expected the error '%s', got none", expected)
+		return s
+	}
+	if !errors.Is(s.err, expected) && s.err.Error() != expected.Error() {
+		s.t.Errorf("expected the error '%s', got '%s'", expected, s.err)
+	}
+	return s
+}
+
+//ThenErrorCategory checks that the command returned an error of the category (e.g. weos.ErrorCategoryValidation)
+func (s *Scenario) ThenErrorCategory(category weos.ErrorCategory) *Scenario {
+	s.t.Helper()
+	s.mustHaveHandled()
+	if s.err == nil {
+		s.t.Errorf("expected a '%s' error, got none", category)
+		return s
+	}
+	if actual := weos.GetErrorCategory(s.err); actual != category {
+		s.t.Errorf("expected a '%s' error, got '%s' (%s)", category, actual, s.err)
+	}
+	return s
+}
+
+//ThenAggregate rebuilds the aggregate from all of its events and checks that it has the expected state. Only the
+//fields of the expected value are compared so that ids and timestamps can be left out
+func (s *Scenario) ThenAggregate(rootID string, aggregate weos.Entity, expected interface{}) *Scenario {
+	s.t.Helper()
+	events, _ := s.repository.GetByAggregate(rootID)
+	if len(events) == 0 {
+		s.t.Errorf("expected the aggregate '%s' to have events", rootID)
+		return s
+	}
+	aggregate = weos.NewAggregateFromEvents(aggregate, events)
+	if errs := aggregate.GetErrors(); len(errs) > 0 {
+		s.t.Errorf("unable to rebuild the aggregate '%s': %s", rootID, errs[0])
+		return s
+	}
+	actualBytes, err := json.Marshal(aggregate)
+	if err != nil {
+		s.t.Errorf("unable to marshal the aggregate '%s': %s", rootID, err)
+		return s
+	}
+	expectedBytes, err := json.Marshal(expected)
+	if err != nil {
+		s.t.Errorf("unable to marshal the expected state: %s", err)
+		return s
+	}
+	var actualValue, expectedValue interface{}
+	_ = json.Unmarshal(actualBytes, &actualValue)
+	_ = json.Unmarshal(expectedBytes, &expectedValue)
+	if path, ok := jsonSubset(expectedValue, actualValue, ""); !ok {
+		s.t.Errorf("expected the aggregate '%s' to be %s, got %s (difference at '%s')", rootID, expectedBytes, actualBytes, path)
+	}
+	return s
+}
+
+func (s *Scenario) mustHaveHandled() {
+	s.t.Helper()
+	if !s.handled {
+		s.t.Fatalf("a command must be dispatched with When before checking the results")
+	}
+}
+
+//Event creates the expected event of a root aggregate for ThenEvents. Given events also need an entity type so use
+//weos.NewEntityEvent for those e.g.
+//	weostest.Event("POST_CREATED", "post-1", map[string]interface{}{"title": "First Post"})
+func Event(eventType string, rootID string, payload interface{}) *weos.Event {
+	payloadBytes, _ := json.Marshal(payload)
+	return &weos.Event{
+		Type:    eventType,
+		Payload: payloadBytes,
+		Version: 1,
+		Meta: weos.EventMeta{
+			RootID:   rootID,
+			EntityID: rootID,
+		},
+	}
+}
+
+func eventTypes(events []*weos.Event) []string {
+	types := make([]string, len(events))
+	for i, event := range events {
+		types[i] = event.Type
+	}
+	return types
+}
+
+//jsonEqual compares json documents by value. Empty documents and null are treated as the same
+func jsonEqual(expected json.RawMessage, actual json.RawMessage) (bool, error) {
+	var expectedValue, actualValue interface{}
+	if len(expected) > 0 {
+		if err := json.Unmarshal(expected, &expectedValue); err != nil {
+			return false, err
+		}
+	}
+	if len(actual) > 0 {
+		if err := json.Unmarshal(actual, &actualValue); err != nil {
+			return false, err
+		}
+	}
+	return reflect.DeepEqual(expectedValue, actualValue), nil
+}
+
+//jsonSubset checks that the fields of expected have the same values in actual. It returns the path of the first
+//difference
+func jsonSubset(expected interface{}, actual interface{}, path string) (string, bool) {
+	switch expectedValue := expected.(type) {
+	case map[string]interface{}:
+		actualValue, ok := actual.(map[string]interface{})
+		if !ok {
+			return path, false
+		}
+		for key, value := range expectedValue {
+			fieldPath := key
+			if path != "" {
+				fieldPath = path + "." + key
+			}
+			if difference, ok := jsonSubset(value, actualValue[key], fieldPath); !ok {
+				return difference, false
+			}
+		}
+		return "", true
+	case []interface{}:
+		actualValue, ok := actual.([]interface{})
+		if !ok || len(actualValue) != len(expectedValue) {
+			return path, false
+		}
+		for i := range expectedValue {
+			if difference, ok := jsonSubset(expectedValue[i], actualValue[i], fmt.Sprintf("%s[%d]", path, i)); !ok {
+				return difference, false
+			}
+		}
+		return "", true
+	default:
+		return path, reflect.DeepEqual(expected, actual)
+	}
+}
@@ -0,0 +1,191 @@
+package weostest_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/wepala/weos"
+	"github.com/wepala/weos/weostest"
+	"golang.org/x/net/context"
+	"testing"
+)
+
+type Post struct {
+	weos.AggregateRoot
+	Title     string `json:"title"`
+	Published bool   `json:"published"`
+}
+
+//publishPost is a command handler that rebuilds the post from the event store before changing it
+func publishPost(repository weos.EventRepository) weos.CommandHandler {
+	return func(ctx context.Context, command *weos.Command) error {
+		var payload struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(command.Payload, &payload); err != nil {
+			return err
+		}
+		events, err := repository.GetByAggregate(payload.ID)
+		if err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			return weos.NewNotFoundError(ctx, "post_not_found", "post not found", nil)
+		}
+		post := weos.NewAggregateFromEvents(&Post{}, events).(*Post)
+		post.ID = payload.ID
+		post.SequenceNo = int64(len(events))
+		if post.Published {
+			return weos.NewConflictError(ctx, "already_published", "the post is already published", nil)
+		}
+		post.NewChange(weos.NewEntityEventWithContext(ctx, "POST_PUBLISHED", post, post.ID, map[string]interface{}{"published": true}))
+		return repository.Persist(ctx, post)
+	}
+}
+
+func TestScenario(t *testing.T) {
+	t.Run("events emitted by a command", func(t *testing.T) {
+		scenario := weostest.NewScenario(t)
+		scenario.Handle("PUBLISH_POST", publishPost(scenario.Repository()))
+		scenario.
+			Given(weos.NewEntityEvent("POST_CREATED", &Post{AggregateRoot: weos.AggregateRoot{BasicEntity: weos.BasicEntity{ID: "post-1"}}}, "post-1", map[string]interface{}{"title": "First Post"})).
+			When(&weos.Command{Type: "PUBLISH_POST", Payload: json.RawMessage(`{"id":"post-1"}`)}).
+			ThenNoError().
+			ThenEvents(weostest.Event("POST_PUBLISHED", "post-1", map[string]interface{}{"published": true})).
+			ThenAggregate("post-1", &Post{}, map[string]interface{}{"title": "First Post", "published": true})
+
+		emitted := scenario.Emitted()[0]
+		if emitted.Meta.SequenceNo != 2 {
+			t.Errorf("expected the sequence no to be %d, got %d", 2, emitted.Meta.SequenceNo)
+		}
+		if emitted.Meta.CausationID == "" {
+			t.Error("expected the command id to be the cause of the event")
+		}
+	})
+
+	t.Run("errors returned by a command", func(t *testing.T) {
+		post := &Post{AggregateRoot: weos.AggregateRoot{BasicEntity: weos.BasicEntity{ID: "post-1"}}}
+		scenario := weostest.NewScenario(t)
+		scenario.Handle("PUBLISH_POST", publishPost(scenario.Repository()))
+		scenario.
+			Given(
+				weos.NewEntityEvent("POST_CREATED", post, "post-1", map[string]interface{}{"title": "First Post"}),
+				weos.NewEntityEvent("POST_PUBLISHED", post, "post-1", map[string]interface{}{"published": true}),
+			).
+			When(&weos.Command{Type: "PUBLISH_POST", Payload: json.RawMessage(`{"id":"post-1"}`)}).
+			ThenErrorCategory(weos.ErrorCategoryConflict).
+			ThenError(fmt.Errorf("the post is already published")).
+			ThenNoEvents()
+	})
+
+	t.Run("differences are reported", func(t *testing.T) {
+		fake := &fakeT{}
+		scenario := weostest.NewScenario(fake)
+		scenario.Handle("PUBLISH_POST", publishPost(scenario.Repository()))
+		scenario.
+			Given(weos.NewEntityEvent("POST_CREATED", &Post{AggregateRoot: weos.AggregateRoot{BasicEntity: weos.BasicEntity{ID: "post-1"}}}, "post-1", map[string]interface{}{"title": "First Post"})).
+			When(&weos.Command{Type: "PUBLISH_POST", Payload: json.RawMessage(`{"id":"post-1"}`)}).
+			ThenEvents(weostest.Event("POST_PUBLISHED", "post-1", map[string]interface{}{"published": false})).
+			ThenAggregate("post-1", &Post{}, map[string]interface{}{"title": "Second Post"}).
+			ThenErrorCategory(weos.ErrorCategoryValidation)
+		if len(fake.errors) != 3 {
+			t.Errorf("expected %d failures, got %d %v", 3, len(fake.errors), fake.errors)
+		}
+	})
+
+	t.Run("results can't be checked before a command is dispatched", func(t *testing.T) {
+		fake := &fakeT{}
+		weostest.NewScenario(fake).ThenNoError()
+		if !fake.fatal {
+			t.Error("expected the test to be stopped")
+		}
+	})
+}
+
+func TestEventRepository(t *testing.T) {
+	var repository weos.EventRepository = weostest.NewEventRepository()
+	var received []string
+	repository.AddSubscriber(func(ctx context.Context, event weos.Event) {
+		received = append(received, event.Type)
+	})
+	post := &Post{AggregateRoot: weos.AggregateRoot{BasicEntity: weos.BasicEntity{ID: "post-1"}}}
+	post.NewChange(weos.NewEntityEvent("POST_CREATED", post, post.ID, map[string]interface{}{"title": "First Post"}))
+	post.NewChange(weos.NewEntityEvent("POST_PUBLISHED", post, post.ID, map[string]interface{}{"published": true}))
+	ctx := context.WithValue(context.TODO(), weos.ACCOUNT_ID, "account-1")
+	if err := repository.Persist(ctx, post); err != nil {
+		t.Fatalf("unexpected error persisting post '%s'", err)
+	}
+	if len(post.GetNewChanges()) != 0 {
+		t.Error("expected the new changes to be cleared")
+	}
+	if len(received) != 2 {
+		t.Errorf("expected %d events to be sent to subscribers, got %d", 2, len(received))
+	}
+	events, err := repository.GetEvents(weos.EventFilter{RootID: "post-1", Type: "POST_PUBLISHED"})
+	if err != nil {
+		t.Fatalf("unexpected error getting events '%s'", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected %d event, got %d", 1, len(events))
+	}
+	if events[0].Meta.AccountID != "account-1" {
+		t.Errorf("expected the account id to be '%s', got '%s'", "account-1", events[0].Meta.AccountID)
+	}
+	if sequenceNo, _ := repository.GetAggregateSequenceNumber("post-1"); sequenceNo != 2 {
+		t.Errorf("expected the sequence no to be %d, got %d", 2, sequenceNo)
+	}
+
+	t.Run("reads are scoped to the account in the context", func(t *testing.T) {
+		other := &Post{AggregateRoot: weos.AggregateRoot{BasicEntity: weos.BasicEntity{ID: "post-1"}}}
+		other.NewChange(weos.NewEntityEvent("POST_CREATED", other, other.ID, map[string]interface{}{"title": "Other Post"}))
+		if err := repository.Persist(context.WithValue(context.TODO(), weos.ACCOUNT_ID, "account-2"), other); err != nil {
+			t.Fatalf("unexpected error persisting post '%s'", err)
+		}
+		scoped, err := repository.WithContext(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error scoping repository '%s'", err)
+		}
+		events, _ := scoped.GetByAggregate("post-1")
+		if len(events) != 2 {
+			t.Errorf("expected %d events for the account, got %d", 2, len(events))
+		}
+		if _, err = scoped.WithContext(context.WithValue(context.TODO(), weos.ACCOUNT_ID, "account-2")); err == nil {
+			t.Error("expected an error scoping the repository to another account")
+		}
+	})
+
+	t.Run("the metadata only stamps events without a user in the context", func(t *testing.T) {
+		//an empty user in the context (e.g. an anonymous request) isn't replaced by the metadata, like EventRepositoryGorm
+		ctx := context.WithValue(context.WithValue(context.TODO(), weos.USER_ID, ""), weos.COMMAND_METADATA, weos.CommandMetadata{UserID: "user-2"})
+		anonymous := &Post{AggregateRoot: weos.AggregateRoot{BasicEntity: weos.BasicEntity{ID: "post-3"}}}
+		anonymous.NewChange(weos.NewEntityEvent("POST_CREATED", anonymous, anonymous.ID, map[string]interface{}{"title": "Anonymous Post"}))
+		if err := repository.Persist(ctx, anonymous); err != nil {
+			t.Fatalf("unexpected error persisting post '%s'", err)
+		}
+		events, _ := repository.GetByAggregate("post-3")
+		if len(events) != 1 || events[0].Meta.User != "" {
+			t.Errorf("expected the event not to be stamped with the metadata user, got %v", events)
+		}
+	})
+
+	invalid := &Post{AggregateRoot: weos.AggregateRoot{BasicEntity: weos.BasicEntity{ID: "post-2"}}}
+	invalid.NewChange(&weos.Event{Type: "POST_CREATED"})
+	if err = repository.Persist(ctx, invalid); err == nil {
+		t.Error("expected an error persisting an invalid event")
+	}
+}
+
+type fakeT struct {
+	errors []string
+	fatal  bool
+}
+
+func (f *fakeT) Helper() {}
+
+func (f *fakeT) Errorf(format string, args ...interface{}) {
+	f.errors = append(f.errors, fmt.Sprintf(format, args...))
+}
+
+func (f *fakeT) Fatalf(format string, args ...interface{}) {
+	f.fatal = true
+	f.errors = append(f.errors, fmt.Sprintf(format, args...))
+}